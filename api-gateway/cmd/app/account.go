@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	au "github.com/yerlans/us-protos/gen/auth-service"
+)
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+	Cookie      bool   `json:"cookie"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	// Code is a TOTP or recovery code, required with two-factor authentication.
+	Code string `json:"code"`
+	// KeepLinks keeps the links of the account working without an owner
+	// instead of deleting them.
+	KeepLinks bool `json:"keep_links"`
+}
+
+type DeleteAccountResponse struct {
+	DeletedLinks int64 `json:"deleted_links"`
+}
+
+// ChangePassword sets a new password. All sessions end, the response holds
+// the tokens of a new one.
+func (a *APIGateway) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.OldPassword == "" || req.NewPassword == "" {
+		writeError(w, http.StatusBadRequest, "old_password and new_password are required")
+		return
+	}
+
+	grpcResp, err := a.authClient.ChangePassword(r.Context(), &au.ChangePasswordRequest{
+		OldPassword: req.OldPassword,
+		NewPassword: req.NewPassword,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	a.forgetToken(r)
+
+	a.writeLogin(w, grpcResp, req.Cookie)
+}
+
+// ChangeEmail mails a confirmation link to the new email, it changes once the
+// link is followed.
+func (a *APIGateway) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.NewEmail == "" || req.Password == "" {
+		writeError(w, http.StatusBadRequest, "new_email and password are required")
+		return
+	}
+
+	_, err := a.authClient.ChangeEmail(r.Context(), &au.ChangeEmailRequest{
+		NewEmail: req.NewEmail,
+		Password: req.Password,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConfirmEmailChange changes the email with the mailed token, taken from the
+// "token" query parameter of the link or the JSON body.
+func (a *APIGateway) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	req := ConfirmEmailChangeRequest{Token: r.URL.Query().Get("token")}
+	if req.Token == "" && r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if req.Token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	_, err := a.authClient.ConfirmEmailChange(r.Context(), &au.ConfirmEmailChangeRequest{Token: req.Token})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"changed": true})
+}
+
+// DeleteAccount deletes the account of the request together with its links,
+// unless they are kept without an owner, and clears the cookies.
+func (a *APIGateway) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Password == "" {
+		writeError(w, http.StatusBadRequest, "password is required")
+		return
+	}
+
+	grpcResp, err := a.authClient.DeleteAccount(r.Context(), &au.DeleteAccountRequest{
+		Password:  req.Password,
+		Code:      req.Code,
+		KeepLinks: req.KeepLinks,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	a.forgetToken(r)
+
+	a.clearTokenCookies(w)
+	writeJSON(w, http.StatusOK, DeleteAccountResponse{DeletedLinks: grpcResp.GetDeletedLinks()})
+}
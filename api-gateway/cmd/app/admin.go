@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	us "github.com/yerlans/us-protos/gen/us-service"
+)
+
+type UserResponse struct {
+	ID          int64    `json:"id"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	Verified    bool     `json:"verified"`
+	Disabled    bool     `json:"disabled"`
+	TOTPEnabled bool     `json:"totp_enabled"`
+}
+
+type ListUsersResponse struct {
+	Users []UserResponse `json:"users"`
+	Total int64          `json:"total"`
+}
+
+// UpdateUserRequest changes only the fields present in the body.
+type UpdateUserRequest struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// CacheStatsResponse holds the link cache counters of one URL shortener instance.
+type CacheStatsResponse struct {
+	LocalHits            int64 `json:"local_hits"`
+	LocalMisses          int64 `json:"local_misses"`
+	RemoteHits           int64 `json:"remote_hits"`
+	RemoteMisses         int64 `json:"remote_misses"`
+	NegativeHits         int64 `json:"negative_hits"`
+	Loads                int64 `json:"loads"`
+	LoadErrors           int64 `json:"load_errors"`
+	PendingInvalidations int64 `json:"pending_invalidations"`
+	LocalSize            int64 `json:"local_size"`
+}
+
+// ListUsers lists all users, the auth service checks the users:read permission again.
+func (a *APIGateway) ListUsers(w http.ResponseWriter, r *http.Request) {
+	grpcReq := &au.ListUsersRequest{}
+	query := r.URL.Query()
+	for param, target := range map[string]*int64{"limit": &grpcReq.Limit, "offset": &grpcReq.Offset} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid "+param+" parameter")
+			return
+		}
+		*target = n
+	}
+
+	grpcResp, err := a.authClient.ListUsers(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	resp := ListUsersResponse{Users: []UserResponse{}, Total: grpcResp.GetTotal()}
+	for _, user := range grpcResp.GetUsers() {
+		resp.Users = append(resp.Users, userResponse(user))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// UpdateUser changes the role of a user or disables them.
+func (a *APIGateway) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	grpcResp, err := a.authClient.UpdateUser(r.Context(), &au.UpdateUserRequest{
+		Id:       id,
+		Role:     req.Role,
+		Disabled: req.Disabled,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userResponse(grpcResp))
+}
+
+func userResponse(user *au.User) UserResponse {
+	return UserResponse{
+		ID:          user.GetId(),
+		Email:       user.GetEmail(),
+		Role:        user.GetRole(),
+		Permissions: append([]string{}, user.GetPermissions()...),
+		Verified:    user.GetVerified(),
+		Disabled:    user.GetDisabled(),
+		TOTPEnabled: user.GetTotpEnabled(),
+	}
+}
+
+// AdminCacheStats returns the link cache counters of the URL shortener
+// instance the request is balanced to.
+func (a *APIGateway) AdminCacheStats(w http.ResponseWriter, r *http.Request) {
+	grpcResp, err := a.urlShortenerClient.GetCacheStats(r.Context(), &us.GetCacheStatsRequest{})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CacheStatsResponse{
+		LocalHits:            grpcResp.GetLocalHits(),
+		LocalMisses:          grpcResp.GetLocalMisses(),
+		RemoteHits:           grpcResp.GetRemoteHits(),
+		RemoteMisses:         grpcResp.GetRemoteMisses(),
+		NegativeHits:         grpcResp.GetNegativeHits(),
+		Loads:                grpcResp.GetLoads(),
+		LoadErrors:           grpcResp.GetLoadErrors(),
+		PendingInvalidations: grpcResp.GetPendingInvalidations(),
+		LocalSize:            grpcResp.GetLocalSize(),
+	})
+}
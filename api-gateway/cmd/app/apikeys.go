@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyHeader carries a personal API key on the endpoints that accept one.
+const apiKeyHeader = "X-API-Key"
+
+// scopeLinksCreate allows API keys to shorten URLs.
+const scopeLinksCreate = "links:create"
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateAPIKeyResponse carries the key itself, it is shown only once.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+type ListAPIKeysResponse struct {
+	APIKeys []APIKeyResponse `json:"api_keys"`
+}
+
+func (a *APIGateway) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{scopeLinksCreate}
+	}
+
+	grpcReq := &au.CreateAPIKeyRequest{Name: req.Name, Scopes: req.Scopes}
+	if req.ExpiresAt != nil {
+		grpcReq.ExpiresAt = req.ExpiresAt.Unix()
+	}
+
+	grpcResp, err := a.authClient.CreateAPIKey(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, CreateAPIKeyResponse{
+		APIKeyResponse: apiKeyResponse(grpcResp.GetApiKey()),
+		Key:            grpcResp.GetKey(),
+	})
+}
+
+func (a *APIGateway) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	grpcResp, err := a.authClient.ListAPIKeys(r.Context(), &au.ListAPIKeysRequest{})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	resp := ListAPIKeysResponse{APIKeys: []APIKeyResponse{}}
+	for _, key := range grpcResp.GetApiKeys() {
+		resp.APIKeys = append(resp.APIKeys, apiKeyResponse(key))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *APIGateway) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	_, err := a.authClient.RevokeAPIKey(r.Context(), &au.RevokeAPIKeyRequest{Id: mux.Vars(r)["id"]})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIKeyAuth authenticates requests carrying an X-API-Key header instead of a
+// bearer token, the key must have the scope. It must run after AuthMiddleware.
+func (a *APIGateway) APIKeyAuth(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(apiKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, ok := IdentityFromContext(r.Context()); ok {
+				writeError(w, http.StatusBadRequest, "Use either a bearer token or an API key")
+				return
+			}
+
+			identity, err := a.authenticateAPIKey(r.Context(), key)
+			if err != nil {
+				if status.Code(err) == codes.Unauthenticated {
+					writeError(w, http.StatusUnauthorized, "Invalid API key")
+					return
+				}
+				writeGRPCError(w, err)
+				return
+			}
+			if !slices.Contains(identity.Scopes, scope) {
+				writeError(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// authenticateAPIKey exchanges the key for a scoped access token that is
+// forwarded to downstream services. Results share the token cache, so a
+// revoked key is rejected after at most the cache TTL. Entries never outlive
+// half the lifetime of the exchanged token.
+func (a *APIGateway) authenticateAPIKey(ctx context.Context, key string) (Identity, error) {
+	cacheKey := sha256.Sum256([]byte("api-key:" + key))
+	if entry, ok := a.tokens.get(cacheKey); ok {
+		return entry.identity, entry.err
+	}
+
+	resp, err := a.authClient.AuthenticateAPIKey(ctx, &au.AuthenticateAPIKeyRequest{Key: key})
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			a.tokens.set(cacheKey, tokenCacheEntry{err: err})
+		}
+		return Identity{}, err
+	}
+
+	identity := Identity{
+		UserID: resp.GetUserId(),
+		Email:  resp.GetEmail(),
+		Scopes: resp.GetScopes(),
+		Token:  resp.GetToken(),
+	}
+	a.tokens.set(cacheKey, tokenCacheEntry{
+		identity:  identity,
+		expiresAt: time.Now().Add(time.Duration(resp.GetExpiresIn()) * time.Second / 2),
+	})
+
+	return identity, nil
+}
+
+func apiKeyResponse(key *au.APIKey) APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:        key.GetId(),
+		Name:      key.GetName(),
+		Scopes:    append([]string{}, key.GetScopes()...),
+		CreatedAt: time.Unix(key.GetCreatedAt(), 0).UTC(),
+	}
+	if key.GetExpiresAt() != 0 {
+		expiresAt := time.Unix(key.GetExpiresAt(), 0).UTC()
+		resp.ExpiresAt = &expiresAt
+	}
+	if key.GetLastUsedAt() != 0 {
+		lastUsedAt := time.Unix(key.GetLastUsedAt(), 0).UTC()
+		resp.LastUsedAt = &lastUsedAt
+	}
+	return resp
+}
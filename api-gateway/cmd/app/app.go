@@ -1,89 +1,162 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
-	"google.golang.org/grpc/credentials/insecure"
+	"apiGW/internal/config"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	au "github.com/yerlans/us-protos/gen/auth-service"
 	us "github.com/yerlans/us-protos/gen/us-service"
+	"github.com/yerlans/us-protos/jwks"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 type APIGateway struct {
 	urlShortenerClient us.UrlShorteningServiceClient
 	authClient         au.AuthServiceClient
+	cfg                *config.Config
+	tokens             *tokenCache
+	// verifier checks tokens locally, nil when no JWKS URL is configured.
+	verifier *jwks.Verifier
 }
 
-func NewAPIGateway(authConn *grpc.ClientConn) *APIGateway {
-	return &APIGateway{
-		authClient: au.NewAuthServiceClient(authConn),
+func NewAPIGateway(cfg *config.Config, authConn, urlShortenerConn *grpc.ClientConn) *APIGateway {
+	gw := &APIGateway{
+		urlShortenerClient: us.NewUrlShorteningServiceClient(urlShortenerConn),
+		authClient:         au.NewAuthServiceClient(authConn),
+		cfg:                cfg,
+		tokens:             newTokenCache(cfg.Auth.TokenCacheTTL, cfg.Auth.TokenCacheSize),
 	}
+	if cfg.Auth.JWKS.URL != "" {
+		gw.verifier = jwks.NewVerifier(jwks.Options{
+			URL:                cfg.Auth.JWKS.URL,
+			Issuer:             cfg.Auth.JWKS.Issuer,
+			Refresh:            cfg.Auth.JWKS.Refresh,
+			Timeout:            cfg.Auth.JWKS.Timeout,
+			RevocationsURL:     cfg.Auth.JWKS.RevocationsURL,
+			RevocationsRefresh: cfg.Auth.JWKS.RevocationsRefresh,
+		})
+	}
+	return gw
 }
 
-type CreateShortUrlRequest struct {
-	OriginalUrl string `json:"original_url"`
-}
+// newRouter registers the routes of the gateway. The public auth routes are
+// matched before the others and skip AuthMiddleware: an expired or invalid
+// token left in a cookie mustn't keep a user from logging in again.
+func newRouter(apiGateway *APIGateway) *mux.Router {
+	r := mux.NewRouter()
 
-func (a *APIGateway) CreateShortUrl(w http.ResponseWriter, r *http.Request) {
-	var req CreateShortUrlRequest
-	// Parse request body and map to req
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
-	}
-	grpcReq := &us.ShortenUrlRequest{OriginalUrl: req.OriginalUrl}
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/auth/register", apiGateway.Register).Methods("POST")
+	api.HandleFunc("/auth/login", apiGateway.Login).Methods("POST")
+	api.HandleFunc("/auth/refresh", apiGateway.Refresh).Methods("POST")
+	api.HandleFunc("/auth/logout", apiGateway.Logout).Methods("POST")
+	api.HandleFunc("/auth/verify-email", apiGateway.VerifyEmail).Methods("GET", "POST")
+	api.HandleFunc("/auth/password-reset", apiGateway.RequestPasswordReset).Methods("POST")
+	api.HandleFunc("/auth/password-reset/confirm", apiGateway.ResetPassword).Methods("POST")
+	api.HandleFunc("/auth/email/confirm", apiGateway.ConfirmEmailChange).Methods("GET", "POST")
+	api.HandleFunc("/auth/oidc/login", apiGateway.StartOIDCLogin).Methods("GET")
+	api.HandleFunc("/auth/oidc/callback", apiGateway.FinishOIDCLogin).Methods("GET")
+	api.HandleFunc("/auth/totp/verify", apiGateway.VerifyTOTP).Methods("POST")
 
-	grpcResp, err := a.urlShortenerClient.ShortenUrl(context.Background(), grpcReq)
-	if err != nil {
-		grpcError, _ := status.FromError(err)
-		http.Error(w, grpcError.Message(), 500)
-		return
-	}
-	// Write response to HTTP
-	json.NewEncoder(w).Encode(grpcResp)
+	authed := api.NewRoute().Subrouter()
+	authed.Use(apiGateway.AuthMiddleware)
+	authed.Handle("/auth/me", RequireAuth(http.HandlerFunc(apiGateway.Me))).Methods("GET")
+	authed.Handle("/auth/password", RequireAuth(http.HandlerFunc(apiGateway.ChangePassword))).Methods("POST")
+	authed.Handle("/auth/email", RequireAuth(http.HandlerFunc(apiGateway.ChangeEmail))).Methods("POST")
+	authed.Handle("/auth/account", RequireAuth(http.HandlerFunc(apiGateway.DeleteAccount))).Methods("DELETE")
+	authed.Handle("/shorten", apiGateway.APIKeyAuth(scopeLinksCreate)(http.HandlerFunc(apiGateway.CreateShortUrl))).Methods("POST")
+	authed.HandleFunc("/links/{alias}/stats", apiGateway.LinkStats).Methods("GET")
+
+	totp := authed.PathPrefix("/auth/totp").Subrouter()
+	totp.Use(RequireAuth)
+	totp.HandleFunc("/enroll", apiGateway.EnrollTOTP).Methods("POST")
+	totp.HandleFunc("/confirm", apiGateway.ConfirmTOTP).Methods("POST")
+	totp.HandleFunc("/disable", apiGateway.DisableTOTP).Methods("POST")
+
+	apiKeys := authed.PathPrefix("/auth/api-keys").Subrouter()
+	apiKeys.Use(RequireAuth)
+	apiKeys.HandleFunc("", apiGateway.CreateAPIKey).Methods("POST")
+	apiKeys.HandleFunc("", apiGateway.ListAPIKeys).Methods("GET")
+	apiKeys.HandleFunc("/{id}", apiGateway.RevokeAPIKey).Methods("DELETE")
+
+	links := authed.PathPrefix("/links").Subrouter()
+	links.Use(RequireAuth)
+	links.HandleFunc("", apiGateway.ListLinks).Methods("GET")
+	links.HandleFunc("/{alias}", apiGateway.GetLink).Methods("GET")
+	links.HandleFunc("/{alias}", apiGateway.UpdateLink).Methods("PATCH")
+	links.HandleFunc("/{alias}", apiGateway.DeleteLink).Methods("DELETE")
+
+	orgs := authed.PathPrefix("/orgs").Subrouter()
+	orgs.Use(RequireAuth)
+	orgs.HandleFunc("", apiGateway.CreateOrg).Methods("POST")
+	orgs.HandleFunc("", apiGateway.ListOrgs).Methods("GET")
+	orgs.HandleFunc("/invitations/accept", apiGateway.AcceptInvitation).Methods("GET", "POST")
+	orgs.HandleFunc("/{id}/members", apiGateway.ListMembers).Methods("GET")
+	orgs.HandleFunc("/{id}/members/{userId}", apiGateway.UpdateMember).Methods("PATCH")
+	orgs.HandleFunc("/{id}/members/{userId}", apiGateway.RemoveMember).Methods("DELETE")
+	orgs.HandleFunc("/{id}/invitations", apiGateway.InviteMember).Methods("POST")
+	orgs.HandleFunc("/{id}/links", apiGateway.ListOrgLinks).Methods("GET")
+
+	admin := authed.PathPrefix("/admin").Subrouter()
+	admin.Use(RequireAuth)
+	admin.Handle("/users", RequirePermission(permUsersRead)(http.HandlerFunc(apiGateway.ListUsers))).Methods("GET")
+	admin.Handle("/users/{id}", RequirePermission(permUsersWrite)(http.HandlerFunc(apiGateway.UpdateUser))).Methods("PATCH")
+	admin.Handle("/links", RequirePermission(permLinksReadAny)(http.HandlerFunc(apiGateway.AdminListLinks))).Methods("GET")
+	admin.Handle("/links/{alias}", RequirePermission(permLinksReadAny)(http.HandlerFunc(apiGateway.GetLink))).Methods("GET")
+	admin.Handle("/links/{alias}", RequirePermission(permLinksWriteAny)(http.HandlerFunc(apiGateway.UpdateLink))).Methods("PATCH")
+	admin.Handle("/links/{alias}", RequirePermission(permLinksWriteAny)(http.HandlerFunc(apiGateway.DeleteLink))).Methods("DELETE")
+	admin.Handle("/cache/stats", RequirePermission(permLinksReadAny)(http.HandlerFunc(apiGateway.AdminCacheStats))).Methods("GET")
+
+	r.HandleFunc("/register", apiGateway.Register).Methods("POST")
+	r.HandleFunc("/{alias}", apiGateway.Redirect).Methods("GET", "HEAD")
+
+	return r
 }
 
-type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+// dial creates a client connection to a gRPC service described by the config.
+func dial(client config.Client) (*grpc.ClientConn, error) {
+	return grpc.NewClient(client.Address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			timeoutInterceptor(client.Timeout),
+			identityInterceptor,
+		),
+	)
 }
 
-func (a *APIGateway) Register(w http.ResponseWriter, r *http.Request) {
-	var req RegisterRequest
-	// Parse request body and map to req
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
-	}
-	grpcReq := &au.RegisterRequest{Email: req.Email, Password: req.Password}
+func main() {
+	cfg := config.MustLoad()
 
-	grpcResp, err := a.authClient.Register(context.Background(), grpcReq)
+	// Connect to gRPC services
+	authConn, err := dial(cfg.Clients.Auth)
 	if err != nil {
-		grpcError, _ := status.FromError(err)
-		http.Error(w, grpcError.Message(), 500)
-		return
+		log.Fatalf("failed to connect to auth service: %v", err)
 	}
-	// Write response to HTTP
-	json.NewEncoder(w).Encode(grpcResp)
-}
+	defer authConn.Close()
 
-func main() {
-	// Connect to gRPC service
-	conn, err := grpc.NewClient("localhost:44044", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	usConn, err := dial(cfg.Clients.URLShortener)
 	if err != nil {
-		log.Fatalf("failed to connect to gRPC service: %v", err)
+		log.Fatalf("failed to connect to url shortener service: %v", err)
 	}
-	defer conn.Close()
+	defer usConn.Close()
 
-	apiGateway := NewAPIGateway(conn)
+	apiGateway := NewAPIGateway(cfg, authConn, usConn)
 
-	r := mux.NewRouter()
-	//r.HandleFunc("/shorten", apiGateway.CreateShortUrl).Methods("POST")
-	r.HandleFunc("/register", apiGateway.Register).Methods("POST")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	r := newRouter(apiGateway)
+
+	srv := &http.Server{
+		Addr:              cfg.HTTP.Address,
+		Handler:           r,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       time.Minute,
+	}
+
+	log.Printf("api gateway listening on %s", cfg.HTTP.Address)
+	log.Fatal(srv.ListenAndServe())
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"apiGW/internal/config"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// publicRoutesClient rejects every token, the other AuthServiceClient
+// methods aren't used by the tests.
+type publicRoutesClient struct {
+	au.AuthServiceClient
+}
+
+func (publicRoutesClient) ValidateToken(context.Context, *au.ValidateTokenRequest, ...grpc.CallOption) (*au.ValidateTokenResponse, error) {
+	return nil, status.Error(codes.Unauthenticated, "invalid token")
+}
+
+func (publicRoutesClient) Login(context.Context, *au.LoginRequest, ...grpc.CallOption) (*au.LoginResponse, error) {
+	return &au.LoginResponse{Token: "access", RefreshToken: "refresh"}, nil
+}
+
+func (publicRoutesClient) Refresh(context.Context, *au.RefreshRequest, ...grpc.CallOption) (*au.RefreshResponse, error) {
+	return &au.RefreshResponse{Token: "access", RefreshToken: "refresh"}, nil
+}
+
+func (publicRoutesClient) Logout(context.Context, *au.LogoutRequest, ...grpc.CallOption) (*au.LogoutResponse, error) {
+	return &au.LogoutResponse{}, nil
+}
+
+func TestPublicRoutesIgnoreStaleTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"login", http.MethodPost, "/api/v1/auth/login", `{"email":"a@example.com","password":"secret"}`, http.StatusOK},
+		{"refresh", http.MethodPost, "/api/v1/auth/refresh", `{"refresh_token":"refresh"}`, http.StatusOK},
+		{"logout", http.MethodPost, "/api/v1/auth/logout", `{"refresh_token":"refresh"}`, http.StatusNoContent},
+		{"authenticated route", http.MethodGet, "/api/v1/auth/me", "", http.StatusUnauthorized},
+	}
+
+	cfg := &config.Config{}
+	cfg.Auth.Cookie.Name = "token"
+	gw := &APIGateway{authClient: publicRoutesClient{}, cfg: cfg, tokens: newTokenCache(time.Minute, 10)}
+	router := newRouter(gw)
+
+	for _, tt := range tests {
+		for _, credential := range []string{"header", "cookie"} {
+			t.Run(tt.name+" with expired "+credential, func(t *testing.T) {
+				req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				if credential == "header" {
+					req.Header.Set("Authorization", "Bearer expired")
+				} else {
+					req.AddCookie(&http.Cookie{Name: "token", Value: "expired"})
+				}
+
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (a *APIGateway) Register(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	// Parse request body and map to req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	grpcReq := &au.RegisterRequest{Email: req.Email, Password: req.Password}
+
+	grpcResp, err := a.authClient.Register(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	// Write response to HTTP
+	writeJSON(w, http.StatusOK, grpcResp)
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Cookie additionally stores the token in an HttpOnly cookie for browser clients.
+	Cookie bool `json:"cookie"`
+}
+
+type LoginResponse struct {
+	Token        string `json:"token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (a *APIGateway) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		writeError(w, http.StatusBadRequest, "email and password are required")
+		return
+	}
+
+	grpcResp, err := a.authClient.Login(r.Context(), &au.LoginRequest{
+		Email:    req.Email,
+		Password: req.Password,
+		ClientIp: a.clientIP(r),
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound, codes.InvalidArgument, codes.Unauthenticated:
+			// Do not tell unknown emails apart from wrong passwords.
+			writeError(w, http.StatusUnauthorized, "invalid credentials")
+		case codes.FailedPrecondition:
+			writeError(w, http.StatusForbidden, "email not verified")
+		default:
+			writeGRPCError(w, err)
+		}
+		return
+	}
+
+	if grpcResp.GetTotpRequired() {
+		writeJSON(w, http.StatusOK, TOTPChallengeResponse{
+			TOTPRequired:   true,
+			ChallengeToken: grpcResp.GetChallengeToken(),
+		})
+		return
+	}
+
+	a.writeLogin(w, grpcResp, req.Cookie)
+}
+
+// writeLogin writes the tokens of a new session, and stores them in cookies
+// if the client asked for it.
+func (a *APIGateway) writeLogin(w http.ResponseWriter, resp *au.LoginResponse, cookie bool) {
+	if cookie {
+		a.setTokenCookies(w, resp.GetToken(), resp.GetRefreshToken())
+	}
+
+	writeJSON(w, http.StatusOK, LoginResponse{
+		Token:        resp.GetToken(),
+		TokenType:    "Bearer",
+		RefreshToken: resp.GetRefreshToken(),
+		ExpiresIn:    resp.GetExpiresIn(),
+	})
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh exchanges a refresh token, from the body or the refresh cookie, for
+// a new token pair. Cookies are renewed when the refresh token came from one.
+func (a *APIGateway) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+
+	fromCookie := false
+	if req.RefreshToken == "" {
+		if cookie, err := r.Cookie(a.cfg.Auth.Cookie.RefreshName); err == nil {
+			req.RefreshToken, fromCookie = cookie.Value, true
+		}
+	}
+	if req.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	grpcResp, err := a.authClient.Refresh(r.Context(), &au.RefreshRequest{RefreshToken: req.RefreshToken})
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			a.clearTokenCookies(w)
+			unauthorized(w, "Invalid or expired refresh token")
+			return
+		}
+		writeGRPCError(w, err)
+		return
+	}
+
+	if fromCookie {
+		a.setTokenCookies(w, grpcResp.GetToken(), grpcResp.GetRefreshToken())
+	}
+
+	writeJSON(w, http.StatusOK, LoginResponse{
+		Token:        grpcResp.GetToken(),
+		TokenType:    "Bearer",
+		RefreshToken: grpcResp.GetRefreshToken(),
+		ExpiresIn:    grpcResp.GetExpiresIn(),
+	})
+}
+
+// Logout revokes the request's access token and the session of the refresh
+// token, from the body or the refresh cookie, and clears the cookies. The
+// route skips AuthMiddleware, an expired access token doesn't stand in the way
+// of ending the session, the auth service ignores it.
+func (a *APIGateway) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		if cookie, err := r.Cookie(a.cfg.Auth.Cookie.RefreshName); err == nil {
+			req.RefreshToken = cookie.Value
+		}
+	}
+
+	token, ok := a.requestToken(r)
+	if !ok {
+		token = ""
+	}
+	if token == "" && req.RefreshToken == "" {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	_, err := a.authClient.Logout(r.Context(), &au.LogoutRequest{Token: token, RefreshToken: req.RefreshToken})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	a.forgetToken(r)
+
+	a.clearTokenCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgetToken drops the validation of the request's token from the cache
+// once the auth service has revoked it.
+func (a *APIGateway) forgetToken(r *http.Request) {
+	if token, ok := a.requestToken(r); ok && token != "" {
+		a.tokens.delete(sha256.Sum256([]byte(token)))
+	}
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail verifies the email of a user with the mailed token, taken from
+// the "token" query parameter of the link or the JSON body.
+func (a *APIGateway) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	req := VerifyEmailRequest{Token: r.URL.Query().Get("token")}
+	if req.Token == "" && r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if req.Token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	if _, err := a.authClient.VerifyEmail(r.Context(), &au.VerifyEmailRequest{Token: req.Token}); err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"verified": true})
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// RequestPasswordReset mails a reset link. It answers 202 whether or not the
+// email belongs to an account.
+func (a *APIGateway) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	_, err := a.authClient.RequestPasswordReset(r.Context(), &au.RequestPasswordResetRequest{Email: req.Email})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ResetPassword sets a new password with the mailed reset token.
+func (a *APIGateway) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	_, err := a.authClient.ResetPassword(r.Context(), &au.ResetPasswordRequest{Token: req.Token, Password: req.Password})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type MeResponse struct {
+	UserID      string            `json:"user_id"`
+	Email       string            `json:"email"`
+	Role        string            `json:"role,omitempty"`
+	Permissions []string          `json:"permissions"`
+	Orgs        map[string]string `json:"orgs,omitempty"`
+}
+
+// Me returns the user the request is authenticated as.
+func (a *APIGateway) Me(w http.ResponseWriter, r *http.Request) {
+	identity, _ := IdentityFromContext(r.Context())
+
+	writeJSON(w, http.StatusOK, MeResponse{
+		UserID:      identity.UserID,
+		Email:       identity.Email,
+		Role:        identity.Role,
+		Permissions: append([]string{}, identity.Permissions...),
+		Orgs:        identity.Orgs,
+	})
+}
+
+// setTokenCookies stores the access token for all paths and the refresh token
+// only for the auth endpoints that consume it.
+func (a *APIGateway) setTokenCookies(w http.ResponseWriter, token, refreshToken string) {
+	cookie := a.cfg.Auth.Cookie
+	http.SetCookie(w, a.cookie(cookie.Name, token, "/", int(cookie.MaxAge.Seconds())))
+	http.SetCookie(w, a.cookie(cookie.RefreshName, refreshToken, refreshCookiePath, int(cookie.RefreshMaxAge.Seconds())))
+}
+
+func (a *APIGateway) clearTokenCookies(w http.ResponseWriter) {
+	cookie := a.cfg.Auth.Cookie
+	http.SetCookie(w, a.cookie(cookie.Name, "", "/", -1))
+	http.SetCookie(w, a.cookie(cookie.RefreshName, "", refreshCookiePath, -1))
+}
+
+// refreshCookiePath limits the refresh cookie to the refresh and logout endpoints.
+const refreshCookiePath = "/api/v1/auth"
+
+func (a *APIGateway) cookie(name, value, path string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   a.cfg.Auth.Cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   a.cfg.Auth.Cookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpStatusFromGRPC translates a gRPC status code into the closest HTTP status code.
+func httpStatusFromGRPC(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ErrorResponse is the JSON body of every error returned by the gateway API.
+type ErrorResponse struct {
+	// Error is a machine-readable code derived from the HTTP status, e.g. "not_found".
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// writeJSON writes v as the JSON body of a response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an ErrorResponse with the given status code.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	errorCode := strings.ToLower(strings.ReplaceAll(http.StatusText(code), " ", "_"))
+	if errorCode == "" {
+		errorCode = "error"
+	}
+	writeJSON(w, code, ErrorResponse{Error: errorCode, Message: msg})
+}
+
+// writeGRPCError writes err, returned by a downstream gRPC call, as an HTTP error.
+func writeGRPCError(w http.ResponseWriter, err error) {
+	grpcError, _ := status.FromError(err)
+	for _, detail := range grpcError.Details() {
+		if retry, ok := detail.(*errdetails.RetryInfo); ok {
+			seconds := int64(math.Ceil(retry.GetRetryDelay().AsDuration().Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		}
+	}
+	writeError(w, httpStatusFromGRPC(grpcError.Code()), grpcError.Message())
+}
+
+// timeoutInterceptor bounds every outgoing call that has no deadline of its own.
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
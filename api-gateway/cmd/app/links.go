@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	us "github.com/yerlans/us-protos/gen/us-service"
+)
+
+type LinkResponse struct {
+	ShortUrl    string     `json:"short_url"`
+	Alias       string     `json:"alias"`
+	OriginalUrl string     `json:"original_url"`
+	Permanent   bool       `json:"permanent"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	MaxClicks   int64      `json:"max_clicks,omitempty"`
+	Clicks      int64      `json:"clicks"`
+	TotalClicks int64      `json:"total_clicks"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	OrgID       string     `json:"org_id,omitempty"`
+	// OwnerID is only shown to administrators and members of the
+	// organization of the link, Disabled only to administrators.
+	OwnerID  string `json:"owner_id,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+type ListLinksResponse struct {
+	Links []LinkResponse `json:"links"`
+	Total int64          `json:"total"`
+}
+
+// UpdateLinkRequest changes only the fields present in the body.
+// A null expires_at or a zero max_clicks removes the limit.
+type UpdateLinkRequest struct {
+	OriginalUrl *string          `json:"original_url"`
+	Permanent   *bool            `json:"permanent"`
+	ExpiresAt   optional[string] `json:"expires_at"`
+	MaxClicks   *int64           `json:"max_clicks"`
+	// Disabled needs the links:write:any permission.
+	Disabled *bool `json:"disabled"`
+}
+
+// optional tells a field explicitly set to null apart from an absent one.
+type optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (a *APIGateway) ListLinks(w http.ResponseWriter, r *http.Request) {
+	a.listLinks(w, r, &us.ListLinksRequest{})
+}
+
+// AdminListLinks lists the links of all users, or of the one in the owner_id parameter.
+func (a *APIGateway) AdminListLinks(w http.ResponseWriter, r *http.Request) {
+	ownerID := r.URL.Query().Get("owner_id")
+	a.listLinks(w, r, &us.ListLinksRequest{All: ownerID == "", OwnerId: ownerID})
+}
+
+func (a *APIGateway) listLinks(w http.ResponseWriter, r *http.Request, grpcReq *us.ListLinksRequest) {
+	query := r.URL.Query()
+	for param, target := range map[string]*int64{"limit": &grpcReq.Limit, "offset": &grpcReq.Offset} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid "+param+" parameter")
+			return
+		}
+		*target = n
+	}
+
+	grpcResp, err := a.urlShortenerClient.ListLinks(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	resp := ListLinksResponse{Links: []LinkResponse{}, Total: grpcResp.GetTotal()}
+	for _, link := range grpcResp.GetLinks() {
+		resp.Links = append(resp.Links, a.linkResponse(r, link))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *APIGateway) GetLink(w http.ResponseWriter, r *http.Request) {
+	grpcResp, err := a.urlShortenerClient.GetLink(r.Context(),
+		&us.GetLinkRequest{ShortUrl: mux.Vars(r)["alias"]})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.linkResponse(r, grpcResp))
+}
+
+func (a *APIGateway) UpdateLink(w http.ResponseWriter, r *http.Request) {
+	var req UpdateLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	grpcReq := &us.UpdateLinkRequest{
+		ShortUrl:    mux.Vars(r)["alias"],
+		OriginalUrl: req.OriginalUrl,
+		Permanent:   req.Permanent,
+		MaxClicks:   req.MaxClicks,
+		Disabled:    req.Disabled,
+	}
+	if req.ExpiresAt.Set {
+		var expiresAt int64
+		if req.ExpiresAt.Value != nil {
+			t, err := time.Parse(time.RFC3339, *req.ExpiresAt.Value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid expires_at, RFC 3339 time expected")
+				return
+			}
+			expiresAt = t.Unix()
+		}
+		grpcReq.ExpiresAt = &expiresAt
+	}
+
+	grpcResp, err := a.urlShortenerClient.UpdateLink(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.linkResponse(r, grpcResp))
+}
+
+func (a *APIGateway) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	_, err := a.urlShortenerClient.DeleteLink(r.Context(),
+		&us.DeleteLinkRequest{ShortUrl: mux.Vars(r)["alias"]})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *APIGateway) linkResponse(r *http.Request, link *us.Link) LinkResponse {
+	resp := LinkResponse{
+		ShortUrl:    a.shortURL(link.GetShortUrl()),
+		Alias:       link.GetShortUrl(),
+		OriginalUrl: link.GetOriginalUrl(),
+		Permanent:   link.GetPermanent(),
+		MaxClicks:   link.GetMaxClicks(),
+		Clicks:      link.GetClicks(),
+		TotalClicks: link.GetTotalClicks(),
+		OrgID:       link.GetOrgId(),
+		Disabled:    link.GetDisabled(),
+	}
+	identity, _ := IdentityFromContext(r.Context())
+	if identity.Can(permLinksReadAny) || (resp.OrgID != "" && identity.Orgs[resp.OrgID] != "") {
+		resp.OwnerID = link.GetOwnerId()
+	}
+	if link.GetExpiresAt() != 0 {
+		expiresAt := time.Unix(link.GetExpiresAt(), 0).UTC()
+		resp.ExpiresAt = &expiresAt
+	}
+	if link.GetCreatedAt() != 0 {
+		createdAt := time.Unix(link.GetCreatedAt(), 0).UTC()
+		resp.CreatedAt = &createdAt
+	}
+	return resp
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	"github.com/yerlans/us-protos/jwks"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys carrying the authenticated user to downstream services.
+// The token itself is forwarded too so services can verify it on their own.
+const (
+	userIDMetadataKey        = "x-user-id"
+	userEmailMetadataKey     = "x-user-email"
+	userRoleMetadataKey      = "x-user-role"
+	permissionsMetadataKey   = "x-user-permissions"
+	orgsMetadataKey          = "x-user-orgs"
+	scopesMetadataKey        = "x-user-scopes"
+	authorizationMetadataKey = "authorization"
+)
+
+// Permissions checked by the gateway before admin calls, granted by the auth service.
+const (
+	permUsersRead     = "users:read"
+	permUsersWrite    = "users:write"
+	permLinksReadAny  = "links:read:any"
+	permLinksWriteAny = "links:write:any"
+)
+
+// Identity is the authenticated user of a request.
+type Identity struct {
+	UserID      string
+	Email       string
+	Role        string
+	Permissions []string
+	// Orgs maps the IDs of the organizations of the user to their role.
+	Orgs map[string]string
+	// Scopes limit identities authenticated with an API key.
+	Scopes []string
+	Token  string
+}
+
+// Can reports whether the user holds the permission.
+func (i Identity) Can(permission string) bool {
+	return slices.Contains(i.Permissions, permission)
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the user injected by the auth middleware.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+func withIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// AuthMiddleware validates the "Authorization: Bearer" token of a request, or
+// the token cookie set at login, and injects the user into the request context.
+// Requests without a token pass through anonymously, requests with an invalid
+// token are rejected with 401.
+func (a *APIGateway) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := a.requestToken(r)
+		if !ok {
+			unauthorized(w, "Invalid authorization header")
+			return
+		}
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, err := a.validateToken(r.Context(), token)
+		identity.Token = token
+		if err != nil {
+			if status.Code(err) == codes.Unauthenticated {
+				unauthorized(w, "Invalid or expired token")
+				return
+			}
+			writeGRPCError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), identity)))
+	})
+}
+
+// RequireAuth rejects anonymous requests, it must run after AuthMiddleware.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := IdentityFromContext(r.Context()); !ok {
+			unauthorized(w, "Authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission rejects requests of users without the permission with 403.
+// It must run after AuthMiddleware, anonymous requests are rejected with 401.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := IdentityFromContext(r.Context())
+			if !ok {
+				unauthorized(w, "Authentication required")
+				return
+			}
+			if !identity.Can(permission) {
+				writeError(w, http.StatusForbidden, "Insufficient permissions")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestToken returns the token from the Authorization header or, without
+// the header, from the token cookie. ok is false for a malformed header.
+func (a *APIGateway) requestToken(r *http.Request) (token string, ok bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok = strings.CutPrefix(header, "Bearer ")
+		return token, ok && token != ""
+	}
+	if cookie, err := r.Cookie(a.cfg.Auth.Cookie.Name); err == nil {
+		return cookie.Value, true
+	}
+	return "", true
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeError(w, http.StatusUnauthorized, msg)
+}
+
+// validateToken verifies the token locally against the auth service's JWKS
+// when configured. Otherwise, or when the keys can't be fetched, it resolves
+// the token through the auth service, remembering the outcome for a short
+// time so that bursts of requests cost one call.
+func (a *APIGateway) validateToken(ctx context.Context, token string) (Identity, error) {
+	if a.verifier != nil {
+		claims, err := a.verifier.Verify(ctx, token)
+		switch {
+		case err == nil && len(claims.Scopes) > 0:
+			// Tokens minted for API keys never leave the gateway.
+			return Identity{}, status.Error(codes.Unauthenticated, "scoped token")
+		case err == nil:
+			return Identity{
+				UserID:      strconv.FormatInt(claims.UserID, 10),
+				Email:       claims.Email,
+				Role:        claims.Role,
+				Permissions: claims.Permissions,
+				Orgs:        claims.Orgs,
+			}, nil
+		case !errors.Is(err, jwks.ErrUnavailable):
+			return Identity{}, status.Error(codes.Unauthenticated, err.Error())
+		}
+	}
+
+	key := sha256.Sum256([]byte(token))
+	if entry, ok := a.tokens.get(key); ok {
+		return entry.identity, entry.err
+	}
+
+	resp, err := a.authClient.ValidateToken(ctx, &au.ValidateTokenRequest{Token: token})
+	if err != nil {
+		// Only a definite rejection is cached, transient failures are retried.
+		if status.Code(err) == codes.Unauthenticated {
+			a.tokens.set(key, tokenCacheEntry{err: err})
+		}
+		return Identity{}, err
+	}
+
+	identity := Identity{
+		UserID:      resp.GetUserId(),
+		Email:       resp.GetEmail(),
+		Role:        resp.GetRole(),
+		Permissions: resp.GetPermissions(),
+		Orgs:        resp.GetOrgs(),
+	}
+	a.tokens.set(key, tokenCacheEntry{identity: identity})
+
+	return identity, nil
+}
+
+type tokenCacheEntry struct {
+	identity  Identity
+	err       error
+	expiresAt time.Time
+}
+
+// tokenCache is a bounded in-memory cache of token validation results keyed by token hash.
+type tokenCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[[sha256.Size]byte]tokenCacheEntry
+}
+
+func newTokenCache(ttl time.Duration, size int) *tokenCache {
+	return &tokenCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[[sha256.Size]byte]tokenCacheEntry),
+	}
+}
+
+func (c *tokenCache) get(key [sha256.Size]byte) (tokenCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return tokenCacheEntry{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return tokenCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *tokenCache) set(key [sha256.Size]byte, entry tokenCacheEntry) {
+	if c.ttl <= 0 || c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		c.evict()
+	}
+	// An entry may come with an earlier expiry of its own.
+	if expiresAt := time.Now().Add(c.ttl); entry.expiresAt.IsZero() || expiresAt.Before(entry.expiresAt) {
+		entry.expiresAt = expiresAt
+	}
+	c.entries[key] = entry
+}
+
+func (c *tokenCache) delete(key [sha256.Size]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// evict drops expired entries and, if the cache is still full, an arbitrary one.
+func (c *tokenCache) evict() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.size {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
+
+// identityInterceptor forwards the user of the request context to downstream services as metadata.
+func identityInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			userIDMetadataKey, identity.UserID,
+			userEmailMetadataKey, identity.Email,
+			userRoleMetadataKey, identity.Role,
+			permissionsMetadataKey, strings.Join(identity.Permissions, ","),
+			orgsMetadataKey, formatOrgs(identity.Orgs),
+			scopesMetadataKey, strings.Join(identity.Scopes, ","),
+			authorizationMetadataKey, "Bearer "+identity.Token,
+		)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// formatOrgs encodes the organization roles as "id:role" pairs separated by commas.
+func formatOrgs(orgs map[string]string) string {
+	pairs := make([]string, 0, len(orgs))
+	for id, role := range orgs {
+		pairs = append(pairs, id+":"+role)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
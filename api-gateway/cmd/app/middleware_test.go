@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validatingClient answers ValidateToken with err, the other AuthServiceClient
+// methods aren't used by the tests.
+type validatingClient struct {
+	au.AuthServiceClient
+	err   error
+	calls int
+}
+
+func (c *validatingClient) ValidateToken(context.Context, *au.ValidateTokenRequest, ...grpc.CallOption) (*au.ValidateTokenResponse, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &au.ValidateTokenResponse{UserId: "42"}, nil
+}
+
+func TestValidateTokenCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		{"valid token", nil, codes.OK, 1},
+		{"rejected token", status.Error(codes.Unauthenticated, "invalid token"), codes.Unauthenticated, 1},
+		{"failed validation", status.Error(codes.Internal, "failed to validate token"), codes.Internal, 2},
+		{"auth service unavailable", status.Error(codes.Unavailable, "connection refused"), codes.Unavailable, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &validatingClient{err: tt.err}
+			gw := &APIGateway{authClient: client, tokens: newTokenCache(time.Minute, 10)}
+
+			for i := 0; i < 2; i++ {
+				_, err := gw.validateToken(context.Background(), "token")
+				if got := status.Code(err); got != tt.wantCode {
+					t.Fatalf("validateToken() code = %v, want %v", got, tt.wantCode)
+				}
+			}
+			if client.calls != tt.wantCalls {
+				t.Errorf("ValidateToken calls = %d, want %d", client.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	au "github.com/yerlans/us-protos/gen/auth-service"
+)
+
+// oidcCookiePath limits the session cookie of single sign-on to its routes.
+const oidcCookiePath = "/api/v1/auth/oidc"
+
+// StartOIDCLogin redirects the browser to the login page of the identity
+// provider. The login session is kept in a cookie until the callback.
+func (a *APIGateway) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	grpcResp, err := a.authClient.StartOIDCLogin(r.Context(), &au.StartOIDCLoginRequest{})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	http.SetCookie(w, a.cookie(a.cfg.Auth.OIDC.SessionCookie, grpcResp.GetSession(), oidcCookiePath, int(grpcResp.GetExpiresIn())))
+	http.Redirect(w, r, grpcResp.GetAuthUrl(), http.StatusFound)
+}
+
+// FinishOIDCLogin handles the redirect back from the identity provider. With
+// a success redirect configured the tokens are stored in cookies and the
+// browser is sent there, a two-factor challenge is passed in the URL fragment
+// so it stays out of server logs. Otherwise it responds like Login.
+func (a *APIGateway) FinishOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		msg := query.Get("error_description")
+		if msg == "" {
+			msg = query.Get("error")
+		}
+		writeError(w, http.StatusUnauthorized, "single sign-on failed: "+msg)
+		return
+	}
+
+	sessionName := a.cfg.Auth.OIDC.SessionCookie
+	session, err := r.Cookie(sessionName)
+	if err != nil || session.Value == "" {
+		writeError(w, http.StatusUnauthorized, "no single sign-on in progress")
+		return
+	}
+	// The session can be used once, whatever the outcome.
+	http.SetCookie(w, a.cookie(sessionName, "", oidcCookiePath, -1))
+
+	if query.Get("code") == "" || query.Get("state") == "" {
+		writeError(w, http.StatusBadRequest, "code and state are required")
+		return
+	}
+
+	grpcResp, err := a.authClient.FinishOIDCLogin(r.Context(), &au.FinishOIDCLoginRequest{
+		Session:  session.Value,
+		Code:     query.Get("code"),
+		State:    query.Get("state"),
+		ClientIp: a.clientIP(r),
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	redirect := a.cfg.Auth.OIDC.SuccessRedirect
+	if grpcResp.GetTotpRequired() {
+		if redirect != "" {
+			fragment := url.Values{"totp_challenge": {grpcResp.GetChallengeToken()}}
+			http.Redirect(w, r, redirect+"#"+fragment.Encode(), http.StatusFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, TOTPChallengeResponse{
+			TOTPRequired:   true,
+			ChallengeToken: grpcResp.GetChallengeToken(),
+		})
+		return
+	}
+
+	if redirect != "" {
+		a.setTokenCookies(w, grpcResp.GetToken(), grpcResp.GetRefreshToken())
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+	a.writeLogin(w, grpcResp, false)
+}
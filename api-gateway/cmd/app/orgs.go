@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	us "github.com/yerlans/us-protos/gen/us-service"
+)
+
+type CreateOrgRequest struct {
+	Name string `json:"name"`
+}
+
+type OrgResponse struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role is the role of the user of the request in the organization.
+	Role string `json:"role"`
+}
+
+type ListOrgsResponse struct {
+	Organizations []OrgResponse `json:"organizations"`
+}
+
+type MemberResponse struct {
+	UserID   int64     `json:"user_id"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type ListMembersResponse struct {
+	Members []MemberResponse `json:"members"`
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email"`
+	// Role is "member" when empty.
+	Role string `json:"role"`
+}
+
+type InviteMemberResponse struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+type RemoveMemberResponse struct {
+	TransferredLinks int64 `json:"transferred_links"`
+}
+
+func (a *APIGateway) CreateOrg(w http.ResponseWriter, r *http.Request) {
+	var req CreateOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	grpcResp, err := a.authClient.CreateOrganization(r.Context(), &au.CreateOrganizationRequest{Name: req.Name})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	a.forgetToken(r)
+
+	writeJSON(w, http.StatusCreated, orgResponse(grpcResp))
+}
+
+func (a *APIGateway) ListOrgs(w http.ResponseWriter, r *http.Request) {
+	grpcResp, err := a.authClient.ListOrganizations(r.Context(), &au.ListOrganizationsRequest{})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	resp := ListOrgsResponse{Organizations: []OrgResponse{}}
+	for _, org := range grpcResp.GetOrganizations() {
+		resp.Organizations = append(resp.Organizations, orgResponse(org))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *APIGateway) ListMembers(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	grpcResp, err := a.authClient.ListMembers(r.Context(), &au.ListMembersRequest{OrgId: orgID})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	resp := ListMembersResponse{Members: []MemberResponse{}}
+	for _, member := range grpcResp.GetMembers() {
+		resp.Members = append(resp.Members, memberResponse(member))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// InviteMember mails an invitation to join the organization.
+func (a *APIGateway) InviteMember(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var req InviteMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Email == "" {
+		writeError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	grpcResp, err := a.authClient.InviteMember(r.Context(), &au.InviteMemberRequest{
+		OrgId: orgID,
+		Email: req.Email,
+		Role:  req.Role,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, InviteMemberResponse{
+		ExpiresAt: time.Unix(grpcResp.GetExpiresAt(), 0).UTC(),
+	})
+}
+
+// AcceptInvitation adds the user of the request to the organization of the
+// mailed token, taken from the "token" query parameter of the link or the
+// JSON body. Memberships are part of access tokens issued afterwards, the
+// cached token is dropped so that validation through the auth service sees
+// the new one right away.
+func (a *APIGateway) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	req := AcceptInvitationRequest{Token: r.URL.Query().Get("token")}
+	if req.Token == "" && r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if req.Token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	grpcResp, err := a.authClient.AcceptInvitation(r.Context(), &au.AcceptInvitationRequest{Token: req.Token})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	a.forgetToken(r)
+
+	writeJSON(w, http.StatusOK, orgResponse(grpcResp))
+}
+
+func (a *APIGateway) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(w, r, "userId")
+	if !ok {
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	grpcResp, err := a.authClient.UpdateMember(r.Context(), &au.UpdateMemberRequest{
+		OrgId:  orgID,
+		UserId: userID,
+		Role:   req.Role,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	a.forgetToken(r)
+
+	writeJSON(w, http.StatusOK, memberResponse(grpcResp))
+}
+
+// RemoveMember removes a member, or the user of the request leaving the
+// organization. The links of the member stay in the organization.
+func (a *APIGateway) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(w, r, "userId")
+	if !ok {
+		return
+	}
+
+	grpcResp, err := a.authClient.RemoveMember(r.Context(), &au.RemoveMemberRequest{OrgId: orgID, UserId: userID})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	a.forgetToken(r)
+
+	writeJSON(w, http.StatusOK, RemoveMemberResponse{TransferredLinks: grpcResp.GetTransferredLinks()})
+}
+
+// ListOrgLinks lists the links of an organization of the user.
+func (a *APIGateway) ListOrgLinks(w http.ResponseWriter, r *http.Request) {
+	a.listLinks(w, r, &us.ListLinksRequest{OrgId: mux.Vars(r)["id"]})
+}
+
+// pathID parses the numeric path variable, answering 400 when it isn't one.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+func orgResponse(org *au.Organization) OrgResponse {
+	return OrgResponse{
+		ID:        org.GetId(),
+		Name:      org.GetName(),
+		CreatedAt: time.Unix(org.GetCreatedAt(), 0).UTC(),
+		Role:      org.GetRole(),
+	}
+}
+
+func memberResponse(member *au.Member) MemberResponse {
+	return MemberResponse{
+		UserID:   member.GetUserId(),
+		Email:    member.GetEmail(),
+		Role:     member.GetRole(),
+		JoinedAt: time.Unix(member.GetJoinedAt(), 0).UTC(),
+	}
+}
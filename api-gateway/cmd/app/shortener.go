@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	us "github.com/yerlans/us-protos/gen/us-service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type CreateShortUrlRequest struct {
+	OriginalUrl string `json:"original_url"`
+	// Permanent makes the short URL answer with 301 instead of 302.
+	Permanent bool `json:"permanent"`
+	// Alias is an optional custom alias, e.g. "promo2026".
+	Alias string `json:"alias,omitempty"`
+	// ExpiresAt is an optional RFC 3339 time after which the link stops working.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// MaxClicks optionally limits how many times the link can be followed.
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// OrgID optionally creates the link in an organization of the user.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+type CreateShortUrlResponse struct {
+	ShortUrl string `json:"short_url"`
+	Alias    string `json:"alias"`
+}
+
+func (a *APIGateway) CreateShortUrl(w http.ResponseWriter, r *http.Request) {
+	var req CreateShortUrlRequest
+	// Parse request body and map to req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	grpcReq := &us.ShortenUrlRequest{
+		OriginalUrl: req.OriginalUrl,
+		Permanent:   req.Permanent,
+		Alias:       req.Alias,
+		MaxClicks:   req.MaxClicks,
+		OrgId:       req.OrgID,
+	}
+	if req.ExpiresAt != nil {
+		grpcReq.ExpiresAt = req.ExpiresAt.Unix()
+	}
+
+	// Anonymous links are allowed, an authenticated user becomes the owner of the link.
+	grpcResp, err := a.urlShortenerClient.ShortenUrl(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	// Write response to HTTP
+	writeJSON(w, http.StatusCreated, CreateShortUrlResponse{
+		ShortUrl: a.shortURL(grpcResp.GetShortUrl()),
+		Alias:    grpcResp.GetShortUrl(),
+	})
+}
+
+// shortURL builds the fully qualified short URL for alias.
+func (a *APIGateway) shortURL(alias string) string {
+	return strings.TrimSuffix(a.cfg.HTTP.PublicURL, "/") + "/" + alias
+}
+
+const notFoundPage = `<!DOCTYPE html>
+<html>
+<head><title>404 Not Found</title></head>
+<body>
+<h1>Not Found</h1>
+<p>The short link you followed does not exist.</p>
+</body>
+</html>
+`
+
+const gonePage = `<!DOCTYPE html>
+<html>
+<head><title>410 Gone</title></head>
+<body>
+<h1>Gone</h1>
+<p>The short link you followed has expired.</p>
+</body>
+</html>
+`
+
+func writePage(w http.ResponseWriter, code int, page string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write([]byte(page))
+}
+
+// Redirect resolves the alias from the path and redirects the client to the original URL.
+func (a *APIGateway) Redirect(w http.ResponseWriter, r *http.Request) {
+	alias := mux.Vars(r)["alias"]
+
+	grpcResp, err := a.urlShortenerClient.GetOriginalUrl(r.Context(), &us.GetOriginalUrlRequest{
+		ShortUrl:  alias,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		ClientIp:  a.clientIP(r),
+		// HEAD requests from link checkers and previews aren't clicks.
+		Peek: r.Method == http.MethodHead,
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound:
+			writePage(w, http.StatusNotFound, notFoundPage)
+		case codes.FailedPrecondition:
+			// The us-microservice reports expired links with FailedPrecondition.
+			writePage(w, http.StatusGone, gonePage)
+		default:
+			writeGRPCError(w, err)
+		}
+		return
+	}
+
+	code := http.StatusFound
+	if grpcResp.GetPermanent() {
+		code = http.StatusMovedPermanently
+	}
+	http.Redirect(w, r, grpcResp.GetOriginalUrl(), code)
+}
+
+// clientIP returns the address of the client. Behind trusted proxies it is
+// the right-most address of X-Forwarded-For not belonging to one of them,
+// the addresses left of it may be forged by the client.
+func (a *APIGateway) clientIP(r *http.Request) string {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	addr := remote.Addr().Unmap()
+	if !a.trustedProxy(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if hop = hop.Unmap(); !a.trustedProxy(hop) {
+			return hop.String()
+		}
+	}
+	return addr.String()
+}
+
+func (a *APIGateway) trustedProxy(addr netip.Addr) bool {
+	for _, network := range a.cfg.HTTP.TrustedProxies {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type LinkStatsResponse struct {
+	TotalClicks int64            `json:"total_clicks"`
+	LastClickAt *time.Time       `json:"last_click_at,omitempty"`
+	Buckets     []TimeBucketJSON `json:"buckets"`
+	Countries   []CounterJSON    `json:"countries"`
+	Referrers   []CounterJSON    `json:"referrers"`
+}
+
+type TimeBucketJSON struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+type CounterJSON struct {
+	Key    string `json:"key"`
+	Clicks int64  `json:"clicks"`
+}
+
+// LinkStats returns click statistics of the alias. The optional "from" and
+// "to" query parameters are RFC 3339 times.
+func (a *APIGateway) LinkStats(w http.ResponseWriter, r *http.Request) {
+	grpcReq := &us.GetLinkStatsRequest{ShortUrl: mux.Vars(r)["alias"]}
+
+	query := r.URL.Query()
+	for param, target := range map[string]*int64{"from": &grpcReq.From, "to": &grpcReq.To} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid "+param+" parameter, RFC 3339 time expected")
+			return
+		}
+		*target = t.Unix()
+	}
+
+	grpcResp, err := a.urlShortenerClient.GetLinkStats(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	resp := LinkStatsResponse{
+		TotalClicks: grpcResp.GetTotalClicks(),
+		Buckets:     []TimeBucketJSON{},
+		Countries:   []CounterJSON{},
+		Referrers:   []CounterJSON{},
+	}
+	if grpcResp.GetLastClickAt() != 0 {
+		lastClickAt := time.Unix(grpcResp.GetLastClickAt(), 0).UTC()
+		resp.LastClickAt = &lastClickAt
+	}
+	for _, b := range grpcResp.GetBuckets() {
+		resp.Buckets = append(resp.Buckets, TimeBucketJSON{Start: time.Unix(b.GetStart(), 0).UTC(), Clicks: b.GetClicks()})
+	}
+	for _, c := range grpcResp.GetCountries() {
+		resp.Countries = append(resp.Countries, CounterJSON{Key: c.GetKey(), Clicks: c.GetClicks()})
+	}
+	for _, c := range grpcResp.GetReferrers() {
+		resp.Referrers = append(resp.Referrers, CounterJSON{Key: c.GetKey(), Clicks: c.GetClicks()})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"apiGW/internal/config"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	gw := &APIGateway{cfg: &config.Config{HTTP: config.HTTP{
+		TrustedProxies: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("192.0.2.1/32"),
+		},
+	}}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:5000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "forwarded header from untrusted client",
+			remoteAddr: "203.0.113.7:5000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "forged hops left of the client",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"1.1.1.1, 198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"1.1.1.1, 198.51.100.1, 192.0.2.1, 10.9.9.9"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "repeated headers",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"1.1.1.1", "198.51.100.1, 10.9.9.9"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "only trusted hops",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"10.9.9.9"},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "malformed hop",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"198.51.100.1, unknown"},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "trusted proxy without header",
+			remoteAddr: "10.1.2.3:5000",
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "ipv6 client",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"2001:db8::1"},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "ipv4-mapped proxy address",
+			remoteAddr: "[::ffff:10.1.2.3]:5000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/abc", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := gw.clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	au "github.com/yerlans/us-protos/gen/auth-service"
+)
+
+// TOTPChallengeResponse is returned by Login instead of the tokens when the
+// user has two-factor authentication, the login continues at /auth/totp/verify.
+type TOTPChallengeResponse struct {
+	TOTPRequired   bool   `json:"totp_required"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+type VerifyTOTPRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	// Code is a six digit TOTP code or a recovery code.
+	Code   string `json:"code"`
+	Cookie bool   `json:"cookie"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type ConfirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// VerifyTOTP completes a two-step login with the challenge token and a code.
+func (a *APIGateway) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	var req VerifyTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.ChallengeToken == "" || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "challenge_token and code are required")
+		return
+	}
+
+	grpcResp, err := a.authClient.VerifyTOTP(r.Context(), &au.VerifyTOTPRequest{
+		ChallengeToken: req.ChallengeToken,
+		Code:           req.Code,
+		ClientIp:       a.clientIP(r),
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	a.writeLogin(w, grpcResp, req.Cookie)
+}
+
+// EnrollTOTP starts two-factor enrollment, the secret is usually shown to the
+// user as a QR code of the URI.
+func (a *APIGateway) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	grpcResp, err := a.authClient.EnrollTOTP(r.Context(), &au.EnrollTOTPRequest{})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, EnrollTOTPResponse{Secret: grpcResp.GetSecret(), URI: grpcResp.GetUri()})
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the recovery codes.
+func (a *APIGateway) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	grpcResp, err := a.authClient.ConfirmTOTP(r.Context(), &au.ConfirmTOTPRequest{Code: req.Code})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, ConfirmTOTPResponse{RecoveryCodes: grpcResp.GetRecoveryCodes()})
+}
+
+func (a *APIGateway) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if _, err := a.authClient.DisableTOTP(r.Context(), &au.DisableTOTPRequest{Code: req.Code}); err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
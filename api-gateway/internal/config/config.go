@@ -0,0 +1,130 @@
+package config
+
+import (
+	"flag"
+	"net/netip"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Config struct {
+	Env     string  `yaml:"env"`
+	HTTP    HTTP    `yaml:"http"`
+	Auth    Auth    `yaml:"auth"`
+	Clients Clients `yaml:"clients"`
+}
+
+type HTTP struct {
+	Address      string        `yaml:"address" env-default:":8080"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" env-default:"5s"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"10s"`
+	// PublicURL is the scheme and host short links are built with, e.g. "http://localhost:8080".
+	// It is required, deriving it from the Host header would let clients
+	// choose where short links point.
+	PublicURL string `yaml:"public_url" env-required:"true"`
+	// TrustedProxies are the networks of the reverse proxies in front of the
+	// gateway, e.g. "10.0.0.0/8" or "192.0.2.1/32". X-Forwarded-For is only
+	// read on requests coming from them.
+	TrustedProxies []netip.Prefix `yaml:"trusted_proxies"`
+}
+
+type Auth struct {
+	// TokenCacheTTL is how long token validation results are reused, zero disables the cache.
+	TokenCacheTTL  time.Duration `yaml:"token_cache_ttl" env-default:"30s"`
+	TokenCacheSize int           `yaml:"token_cache_size" env-default:"10000"`
+	Cookie         Cookie        `yaml:"cookie"`
+	JWKS           JWKS          `yaml:"jwks"`
+	OIDC           OIDC          `yaml:"oidc"`
+}
+
+// OIDC configures the single sign-on routes. The login started by the gateway
+// is tied to the browser with a short-lived cookie. With a SuccessRedirect the
+// callback stores the tokens in cookies and redirects the browser there,
+// otherwise it responds with the tokens like a login does.
+type OIDC struct {
+	SessionCookie   string `yaml:"session_cookie" env-default:"oidc_session"`
+	SuccessRedirect string `yaml:"success_redirect"`
+}
+
+// JWKS configures local token verification with the keys published by the
+// auth service. With an empty URL every token is checked with ValidateToken.
+// Locally verified tokens are checked against the revocation list synced from
+// RevocationsURL every RevocationsRefresh, which is required with a URL: a
+// token revoked on logout is rejected once the list is synced.
+type JWKS struct {
+	URL                string        `yaml:"url"`
+	Issuer             string        `yaml:"issuer" env-default:"auth"`
+	Refresh            time.Duration `yaml:"refresh" env-default:"5m"`
+	Timeout            time.Duration `yaml:"timeout" env-default:"3s"`
+	RevocationsURL     string        `yaml:"revocations_url"`
+	RevocationsRefresh time.Duration `yaml:"revocations_refresh" env-default:"5s"`
+}
+
+// Cookie configures the HttpOnly cookies the tokens are stored in on login.
+type Cookie struct {
+	Name          string        `yaml:"name" env-default:"token"`
+	RefreshName   string        `yaml:"refresh_name" env-default:"refresh_token"`
+	Domain        string        `yaml:"domain"`
+	MaxAge        time.Duration `yaml:"max_age" env-default:"15m"`
+	RefreshMaxAge time.Duration `yaml:"refresh_max_age" env-default:"720h"`
+	Secure        bool          `yaml:"secure"`
+}
+
+type Clients struct {
+	Auth         Client `yaml:"auth"`
+	URLShortener Client `yaml:"url_shortener"`
+}
+
+type Client struct {
+	Address string        `yaml:"address"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
+func MustLoad() *Config {
+	configPath := fetchConfigPath()
+	if configPath == "" {
+		panic("config path is empty")
+	}
+
+	return MustLoadPath(configPath)
+}
+
+func MustLoadPath(configPath string) *Config {
+	// check if file exists
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		panic("config file does not exist: " + configPath)
+	}
+
+	var cfg Config
+
+	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
+		panic("cannot read config: " + err.Error())
+	}
+	if u, err := url.Parse(cfg.HTTP.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+		panic("http.public_url must be an absolute URL: " + cfg.HTTP.PublicURL)
+	}
+	if cfg.Auth.JWKS.URL != "" && cfg.Auth.JWKS.RevocationsURL == "" {
+		panic("auth.jwks.revocations_url is required with auth.jwks.url")
+	}
+
+	return &cfg
+}
+
+// fetchConfigPath fetches config path from command line flag or environment variable.
+// Priority: flag > env > default.
+// Default value is empty string.
+func fetchConfigPath() string {
+	var res string
+
+	flag.StringVar(&res, "config", "", "path to config file")
+	flag.Parse()
+
+	if res == "" {
+		res = os.Getenv("CONFIG_PATH")
+	}
+
+	return res
+}
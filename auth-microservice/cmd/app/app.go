@@ -19,6 +19,9 @@ func main() {
 	go func() {
 		application.GRPCServer.MustRun()
 	}()
+	go func() {
+		application.HTTPServer.MustRun()
+	}()
 
 	// Graceful shutdown
 
@@ -28,5 +31,6 @@ func main() {
 	<-done
 
 	application.GRPCServer.Stop()
+	application.HTTPServer.Stop()
 	log.Info("Gracefully stopped")
 }
@@ -2,14 +2,25 @@ package app
 
 import (
 	grpcapp "auth/internal/app/grpc"
+	httpapp "auth/internal/app/http"
+	"auth/internal/clients/links"
 	"auth/internal/config"
+	"auth/internal/keys"
+	"auth/internal/mailer"
+	"auth/internal/oidc"
 	"auth/internal/services"
+	"auth/internal/storage/memory"
 	"auth/internal/storage/mongodb"
+	"auth/internal/storage/redis"
+	"context"
+	"crypto/rand"
+	"fmt"
 	"log/slog"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	HTTPServer *httpapp.App
 }
 
 func New(log *slog.Logger, cfg *config.Config) *App {
@@ -18,11 +29,175 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 		panic(err)
 	}
 
-	authService := services.New(log, storage)
+	tokens, err := storage.Tokens(cfg.Storage.RefreshTokens, cfg.Storage.RevokedTokens, cfg.Storage.RevokedUsers)
+	if err != nil {
+		panic(err)
+	}
+
+	apiKeys, err := storage.APIKeys(cfg.Storage.APIKeys)
+	if err != nil {
+		panic(err)
+	}
+
+	orgs, err := storage.Orgs(cfg.Storage.Orgs, cfg.Storage.Invitations)
+	if err != nil {
+		panic(err)
+	}
+
+	keySet, err := loadKeys(log, cfg.JWT)
+	if err != nil {
+		panic(err)
+	}
+
+	mail, err := mailer.New(log, cfg.Mailer)
+	if err != nil {
+		panic(err)
+	}
+
+	passwords, err := newPasswords(cfg.Password)
+	if err != nil {
+		panic(err)
+	}
+
+	authService := services.New(log, storage, tokens, attemptStore(log, cfg.CachePath), keySet, services.TokenPolicy{
+		Issuer:     cfg.JWT.Issuer,
+		AccessTTL:  cfg.JWT.TokenTTL,
+		RefreshTTL: cfg.JWT.RefreshTTL,
+	}, services.LockoutPolicy{
+		MaxFailures:   cfg.Lockout.MaxFailures,
+		MaxIPFailures: cfg.Lockout.MaxIPFailures,
+		Window:        cfg.Lockout.Window,
+		BaseLockout:   cfg.Lockout.BaseLockout,
+		MaxLockout:    cfg.Lockout.MaxLockout,
+	}, mail, services.ActionPolicy{
+		Secret:          actionSecret(log, cfg.Actions.Secret),
+		VerifyTTL:       cfg.Actions.VerifyTTL,
+		ResetTTL:        cfg.Actions.ResetTTL,
+		VerifyURL:       cfg.Actions.VerifyURL,
+		ResetURL:        cfg.Actions.ResetURL,
+		ChangeEmailURL:  cfg.Actions.ChangeEmailURL,
+		RequireVerified: cfg.Actions.RequireVerified,
+	}, passwords, apiKeys, services.APIKeyPolicy{
+		MaxPerUser: cfg.APIKeys.MaxPerUser,
+		TokenTTL:   cfg.APIKeys.TokenTTL,
+	}, services.TOTPPolicy{
+		Issuer:        cfg.TOTP.Issuer,
+		Skew:          cfg.TOTP.Skew,
+		RecoveryCodes: cfg.TOTP.RecoveryCodes,
+		ChallengeTTL:  cfg.TOTP.ChallengeTTL,
+	}, linkCleaner(log, cfg.Clients.URLShortener), identityProvider(cfg.OIDC), services.OIDCPolicy{
+		StateTTL:     cfg.OIDC.StateTTL,
+		AutoRegister: cfg.OIDC.AutoRegister,
+	}, orgs, services.OrgPolicy{
+		InviteTTL: cfg.Orgs.InviteTTL,
+		InviteURL: cfg.Orgs.InviteURL,
+	})
+
+	if err := authService.EnsureAdmins(context.Background(), cfg.Admins); err != nil {
+		panic(err)
+	}
 
 	grpcApp := grpcapp.New(log, cfg, authService)
+	httpApp := httpapp.New(log, cfg, keySet.Handler(), authService)
 
 	return &App{
 		GRPCServer: grpcApp,
+		HTTPServer: httpApp,
+	}
+}
+
+func loadKeys(log *slog.Logger, cfg config.JWT) (*keys.KeySet, error) {
+	if len(cfg.Keys) == 0 {
+		log.Warn("no signing keys configured, using an ephemeral key")
+		return keys.Ephemeral()
+	}
+	return keys.Load(cfg)
+}
+
+// attemptStore counts failed logins in Redis when it's configured and
+// reachable, falling back to memory.
+func attemptStore(log *slog.Logger, addr string) services.AttemptStore {
+	fallback := memory.NewAttemptStore()
+	if addr == "" {
+		return fallback
+	}
+
+	store, err := redis.New(addr)
+	if err != nil {
+		log.Warn("redis unavailable, counting login attempts in memory", slog.String("err", err.Error()))
+		return fallback
+	}
+
+	return services.NewFallbackAttemptStore(log, store, fallback)
+}
+
+// linkCleaner connects to the URL shortener service that removes the links of
+// deleted accounts, nil when it isn't configured.
+func linkCleaner(log *slog.Logger, cfg config.Client) services.LinkCleaner {
+	if cfg.Address == "" {
+		log.Warn("no url shortener configured, links of deleted accounts are kept")
+		return nil
+	}
+
+	client, err := links.New(cfg.Address, cfg.Timeout)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// identityProvider returns the external identity provider, nil when single
+// sign-on isn't configured.
+func identityProvider(cfg config.OIDC) services.IdentityProvider {
+	if cfg.Issuer == "" {
+		return nil
+	}
+	return oidc.New(cfg)
+}
+
+// actionSecret returns the configured secret of action tokens or, without
+// one, a random secret: mailed links then stop working on restart.
+func actionSecret(log *slog.Logger, secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+
+	log.Warn("no action token secret configured, using an ephemeral secret")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// newPasswords prefers the configured algorithm and keeps verifying hashes
+// of the other one until they are upgraded.
+func newPasswords(cfg config.Password) (*services.Passwords, error) {
+	breached, err := services.LoadBreachedPasswords(cfg.BreachedListPath)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := services.PasswordPolicy{
+		MinLength: cfg.MinLength,
+		MaxLength: cfg.MaxLength,
+		Breached:  breached,
+	}
+	argon2id := services.Argon2idHasher{
+		Time:       cfg.Argon2.Time,
+		MemoryKiB:  cfg.Argon2.MemoryKiB,
+		Threads:    cfg.Argon2.Threads,
+		KeyLength:  cfg.Argon2.KeyLength,
+		SaltLength: cfg.Argon2.SaltLength,
+	}
+	bcrypt := services.BcryptHasher{Cost: cfg.BcryptCost}
+
+	switch cfg.Algorithm {
+	case services.HashArgon2id:
+		return services.NewPasswords(policy, argon2id, bcrypt), nil
+	case services.HashBcrypt:
+		return services.NewPasswords(policy, bcrypt, argon2id), nil
+	default:
+		return nil, fmt.Errorf("unknown password algorithm %q", cfg.Algorithm)
 	}
 }
@@ -0,0 +1,87 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"auth/internal/config"
+)
+
+// JWKSPath is where the public signing keys are published.
+const JWKSPath = "/.well-known/jwks.json"
+
+type App struct {
+	log        *slog.Logger
+	config     *config.Config
+	httpServer *http.Server
+}
+
+// New creates new HTTP server app publishing the JWKS document and the
+// revoked access tokens.
+func New(
+	log *slog.Logger,
+	config *config.Config,
+	jwks http.Handler,
+	revocations RevocationSource,
+) *App {
+	mux := http.NewServeMux()
+	mux.Handle(JWKSPath, jwks)
+	mux.Handle(RevocationsPath, revocationsHandler(log, revocations))
+
+	httpServer := &http.Server{
+		Addr:         fmt.Sprintf(":%d", config.HTTP.Port),
+		Handler:      mux,
+		ReadTimeout:  config.HTTP.Timeout,
+		WriteTimeout: config.HTTP.Timeout,
+	}
+
+	return &App{
+		log:        log,
+		config:     config,
+		httpServer: httpServer,
+	}
+}
+
+// MustRun runs HTTP server and panics if any error occurs.
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run runs HTTP server.
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	l, err := net.Listen("tcp", a.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("http server started", slog.String("addr", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Stop stops HTTP server.
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(slog.String("op", op)).
+		Info("stopping HTTP server", slog.Int("port", a.config.HTTP.Port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.HTTP.Timeout)
+	defer cancel()
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.log.Error("failed to stop HTTP server", slog.String("err", err.Error()))
+	}
+}
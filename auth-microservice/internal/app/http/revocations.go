@@ -0,0 +1,65 @@
+package httpapp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth/internal/domain/models"
+
+	"github.com/yerlans/us-protos/jwks"
+)
+
+// RevocationsPath is where the revoked access tokens are published.
+const RevocationsPath = "/revocations"
+
+// RevocationSource lists the access tokens revoked since some time.
+type RevocationSource interface {
+	Revocations(ctx context.Context, since time.Time) (models.Revocations, error)
+}
+
+// revocationsHandler publishes the revocations since the Unix time of the
+// since parameter, all that are still in effect without it.
+func revocationsHandler(log *slog.Logger, source RevocationSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var since int64
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			if since, err = strconv.ParseInt(s, 10, 64); err != nil {
+				http.Error(w, "invalid since parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		revocations, err := source.Revocations(r.Context(), time.Unix(since, 0))
+		if err != nil {
+			http.Error(w, "revocations unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		doc := jwks.Revocations{
+			AsOf:   revocations.AsOf.Unix(),
+			Tokens: make([]jwks.RevokedToken, 0, len(revocations.Tokens)),
+			Users:  make([]jwks.UserRevocation, 0, len(revocations.Users)),
+		}
+		for _, t := range revocations.Tokens {
+			doc.Tokens = append(doc.Tokens, jwks.RevokedToken{ID: t.ID, ExpiresAt: t.ExpiresAt.Unix()})
+		}
+		for _, u := range revocations.Users {
+			doc.Users = append(doc.Users, jwks.UserRevocation{
+				UserID:    u.UserID,
+				NotBefore: u.NotBefore.Unix(),
+				ExpiresAt: u.ExpiresAt.Unix(),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(doc); err != nil {
+			log.Error("failed to write revocations", slog.String("err", err.Error()))
+		}
+	})
+}
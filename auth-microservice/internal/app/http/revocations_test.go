@@ -0,0 +1,83 @@
+package httpapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"auth/internal/domain/models"
+
+	"github.com/yerlans/us-protos/jwks"
+)
+
+type revocationSource struct {
+	since time.Time
+	err   error
+}
+
+func (s *revocationSource) Revocations(_ context.Context, since time.Time) (models.Revocations, error) {
+	s.since = since
+	if s.err != nil {
+		return models.Revocations{}, s.err
+	}
+	return models.Revocations{
+		AsOf:   time.Unix(200, 0),
+		Tokens: []models.RevokedToken{{ID: "jti", ExpiresAt: time.Unix(300, 0)}},
+		Users:  []models.UserRevocation{{UserID: 7, NotBefore: time.Unix(150, 0), ExpiresAt: time.Unix(400, 0)}},
+	}, nil
+}
+
+func TestRevocationsHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		err        error
+		wantStatus int
+		wantSince  int64
+	}{
+		{"since", "?since=100", nil, http.StatusOK, 100},
+		{"everything", "", nil, http.StatusOK, 0},
+		{"invalid since", "?since=yesterday", nil, http.StatusBadRequest, 0},
+		{"storage failure", "?since=100", errors.New("down"), http.StatusServiceUnavailable, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &revocationSource{err: tt.err}
+			h := revocationsHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), source)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RevocationsPath+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if source.since.Unix() != tt.wantSince {
+				t.Errorf("since = %d, want %d", source.since.Unix(), tt.wantSince)
+			}
+
+			var got jwks.Revocations
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			want := jwks.Revocations{
+				AsOf:   200,
+				Tokens: []jwks.RevokedToken{{ID: "jti", ExpiresAt: 300}},
+				Users:  []jwks.UserRevocation{{UserID: 7, NotBefore: 150, ExpiresAt: 400}},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Package links is the client of the URL shortener service, the auth service
+// calls it to clean up the links of deleted accounts and to hand over the
+// links of members leaving an organization.
+package links
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	us "github.com/yerlans/us-protos/gen/us-service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata the URL shortener service identifies the calling user by, the
+// same the API gateway sets.
+const (
+	userIDMetadataKey        = "x-user-id"
+	orgsMetadataKey          = "x-user-orgs"
+	scopesMetadataKey        = "x-user-scopes"
+	authorizationMetadataKey = "authorization"
+)
+
+// Scopes the tokens of the calls are minted for, the URL shortener service
+// accepts them on these calls only.
+const (
+	scopeAccountDeletion = "account:delete"
+	scopeLinkTransfer    = "links:transfer"
+)
+
+type Client struct {
+	conn    *grpc.ClientConn
+	api     us.UrlShorteningServiceClient
+	timeout time.Duration
+}
+
+func New(addr string, timeout time.Duration) (*Client, error) {
+	const op = "clients.links.New"
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Client{
+		conn:    conn,
+		api:     us.NewUrlShorteningServiceClient(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// DeleteUserLinks deletes the links of the user, or keeps them without an
+// owner with anonymize, and returns how many there were. The call is made on
+// behalf of the user with the given access token, scoped to account deletion.
+func (c *Client) DeleteUserLinks(ctx context.Context, userID int64, token string, anonymize bool) (int64, error) {
+	const op = "clients.links.DeleteUserLinks"
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		userIDMetadataKey, strconv.FormatInt(userID, 10),
+		scopesMetadataKey, scopeAccountDeletion,
+		authorizationMetadataKey, "Bearer "+token,
+	)
+
+	resp, err := c.api.DeleteUserLinks(ctx, &us.DeleteUserLinksRequest{Anonymize: anonymize})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resp.GetCount(), nil
+}
+
+// TransferOrgLinks hands the links fromID created in the organization over to
+// toID and returns how many there were. The call is made on behalf of the
+// user with the given access token, scoped to link transfers, and role in the
+// organization.
+func (c *Client) TransferOrgLinks(ctx context.Context, userID int64, token string, orgID int64, role string, fromID, toID int64) (int64, error) {
+	const op = "clients.links.TransferOrgLinks"
+
+	org := strconv.FormatInt(orgID, 10)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		userIDMetadataKey, strconv.FormatInt(userID, 10),
+		orgsMetadataKey, org+":"+role,
+		scopesMetadataKey, scopeLinkTransfer,
+		authorizationMetadataKey, "Bearer "+token,
+	)
+
+	resp, err := c.api.TransferOrgLinks(ctx, &us.TransferOrgLinksRequest{
+		OrgId:       org,
+		FromOwnerId: strconv.FormatInt(fromID, 10),
+		ToOwnerId:   strconv.FormatInt(toID, 10),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resp.GetCount(), nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
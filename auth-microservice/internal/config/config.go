@@ -14,12 +14,33 @@ type Config struct {
 	CachePath string        `yaml:"cache_path"`
 	Grpc      Grpc          `yaml:"grpc"`
 	Ttl       time.Duration `yaml:"ttl"`
+	HTTP      HTTP          `yaml:"http"`
+	JWT       JWT           `yaml:"jwt"`
+	Lockout   Lockout       `yaml:"lockout"`
+	Mailer    Mailer        `yaml:"mailer"`
+	Actions   Actions       `yaml:"actions"`
+	Password  Password      `yaml:"password"`
+	APIKeys   APIKeys       `yaml:"api_keys"`
+	TOTP      TOTP          `yaml:"totp"`
+	Clients   Clients       `yaml:"clients"`
+	OIDC      OIDC          `yaml:"oidc"`
+	Orgs      Orgs          `yaml:"orgs"`
+	// Admins are the emails of users promoted to admins on startup.
+	Admins []string `yaml:"admins"`
 }
 
 type Storage struct {
 	Path       string `yaml:"path"`
 	Database   string `yaml:"db"`
 	Collection string `yaml:"collection"`
+	// RefreshTokens, RevokedTokens and RevokedUsers hold the server-side
+	// token state.
+	RefreshTokens string `yaml:"refresh_tokens_collection" env-default:"refresh_tokens"`
+	RevokedTokens string `yaml:"revoked_tokens_collection" env-default:"revoked_tokens"`
+	RevokedUsers  string `yaml:"revoked_users_collection" env-default:"revoked_users"`
+	APIKeys       string `yaml:"api_keys_collection" env-default:"api_keys"`
+	Orgs          string `yaml:"orgs_collection" env-default:"organizations"`
+	Invitations   string `yaml:"invitations_collection" env-default:"org_invitations"`
 }
 
 type Grpc struct {
@@ -27,6 +48,146 @@ type Grpc struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+// HTTP configures the HTTP server publishing the JWKS document and the
+// revoked access tokens.
+type HTTP struct {
+	Port    int           `yaml:"port" env-default:"44080"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
+// JWT configures token signing. The active key signs new tokens, the other
+// keys only verify: retired keys keep verifying for GracePeriod after their
+// retirement so tokens issued before a rotation stay valid until they expire.
+type JWT struct {
+	Issuer      string        `yaml:"issuer" env-default:"auth"`
+	TokenTTL    time.Duration `yaml:"token_ttl" env-default:"15m"`
+	RefreshTTL  time.Duration `yaml:"refresh_ttl" env-default:"720h"`
+	ActiveKey   string        `yaml:"active_key"`
+	GracePeriod time.Duration `yaml:"grace_period" env-default:"24h"`
+	Keys        []SigningKey  `yaml:"keys"`
+}
+
+// SigningKey is a PEM encoded private key together with its JWS algorithm
+// (RS256 or EdDSA). The ID is published as the "kid" header of tokens.
+type SigningKey struct {
+	ID             string    `yaml:"id"`
+	Algorithm      string    `yaml:"algorithm"`
+	PrivateKeyPath string    `yaml:"private_key_path"`
+	RetiredAt      time.Time `yaml:"retired_at"`
+}
+
+// Lockout configures brute-force protection of logins. Failed attempts are
+// counted in Redis at CachePath, or in memory when it is empty or unreachable.
+type Lockout struct {
+	MaxFailures   int64         `yaml:"max_failures" env-default:"5"`
+	MaxIPFailures int64         `yaml:"max_ip_failures" env-default:"50"`
+	Window        time.Duration `yaml:"window" env-default:"1h"`
+	BaseLockout   time.Duration `yaml:"base_lockout" env-default:"30s"`
+	MaxLockout    time.Duration `yaml:"max_lockout" env-default:"15m"`
+}
+
+// Mailer configures how emails are delivered. Driver is "log", "file"
+// (one .eml file per message in Dir) or "smtp".
+type Mailer struct {
+	Driver string `yaml:"driver" env-default:"log"`
+	From   string `yaml:"from" env-default:"no-reply@localhost"`
+	Dir    string `yaml:"dir" env-default:"./mail"`
+	SMTP   SMTP   `yaml:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
+// Actions configures the single-use tokens mailed for email verification,
+// password reset and email changes. The token is appended to VerifyURL,
+// ResetURL and ChangeEmailURL as the "token" query parameter.
+type Actions struct {
+	Secret          string        `yaml:"secret" env:"ACTION_TOKEN_SECRET"`
+	VerifyTTL       time.Duration `yaml:"verify_ttl" env-default:"48h"`
+	ResetTTL        time.Duration `yaml:"reset_ttl" env-default:"1h"`
+	VerifyURL       string        `yaml:"verify_url" env-default:"http://localhost:8080/api/v1/auth/verify-email"`
+	ResetURL        string        `yaml:"reset_url" env-default:"http://localhost:8080/reset-password"`
+	ChangeEmailURL  string        `yaml:"change_email_url" env-default:"http://localhost:8080/api/v1/auth/email/confirm"`
+	RequireVerified bool          `yaml:"require_verified"`
+}
+
+// Password configures how passwords are hashed and what they must satisfy.
+// Algorithm is "argon2id" or "bcrypt", hashes of the other algorithm or with
+// other parameters are upgraded on the next successful login.
+type Password struct {
+	Algorithm  string `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int    `yaml:"bcrypt_cost" env-default:"12"`
+	Argon2     Argon2 `yaml:"argon2"`
+	MinLength  int    `yaml:"min_length" env-default:"8"`
+	MaxLength  int    `yaml:"max_length" env-default:"128"`
+	// BreachedListPath is a file of breached passwords or their SHA-1 hashes, one per line.
+	BreachedListPath string `yaml:"breached_list_path"`
+}
+
+type Argon2 struct {
+	Time       uint32 `yaml:"time" env-default:"3"`
+	MemoryKiB  uint32 `yaml:"memory_kib" env-default:"65536"`
+	Threads    uint8  `yaml:"threads" env-default:"2"`
+	KeyLength  uint32 `yaml:"key_length" env-default:"32"`
+	SaltLength int    `yaml:"salt_length" env-default:"16"`
+}
+
+// APIKeys configures personal API keys. Keys are exchanged for access tokens
+// living TokenTTL, revoking a key takes up to that long to take full effect.
+type APIKeys struct {
+	MaxPerUser int64         `yaml:"max_per_user" env-default:"20"`
+	TokenTTL   time.Duration `yaml:"token_ttl" env-default:"5m"`
+}
+
+// TOTP configures two-factor authentication with time-based one-time codes.
+type TOTP struct {
+	// Issuer is the name authenticator apps show for the account.
+	Issuer        string        `yaml:"issuer" env-default:"URL Shortener"`
+	Skew          int           `yaml:"skew" env-default:"1"`
+	RecoveryCodes int           `yaml:"recovery_codes" env-default:"10"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+// OIDC configures login with an external OpenID Connect provider, it is off
+// without an issuer. RedirectURL is the callback route of the API gateway and
+// must be registered with the provider.
+type OIDC struct {
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string   `yaml:"redirect_url" env-default:"http://localhost:8080/api/v1/auth/oidc/callback"`
+	Scopes       []string `yaml:"scopes" env-default:"openid,email,profile"`
+	// StateTTL bounds the time a user has to log in at the provider.
+	StateTTL time.Duration `yaml:"state_ttl" env-default:"10m"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"10s"`
+	// AutoRegister creates accounts for provider users without one.
+	AutoRegister bool `yaml:"auto_register" env-default:"true"`
+}
+
+// Orgs configures organizations. The invitation token is appended to
+// InviteURL as the "token" query parameter.
+type Orgs struct {
+	InviteTTL time.Duration `yaml:"invite_ttl" env-default:"168h"`
+	InviteURL string        `yaml:"invite_url" env-default:"http://localhost:8080/api/v1/orgs/invitations/accept"`
+}
+
+// Clients configures the services the auth service calls.
+type Clients struct {
+	// URLShortener removes the links of deleted accounts and hands over the
+	// links of members leaving an organization, without an address they are
+	// left in place.
+	URLShortener Client `yaml:"url_shortener"`
+}
+
+type Client struct {
+	Address string        `yaml:"address"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
 func MustLoad() *Config {
 	configPath := fetchConfigPath()
 	if configPath == "" {
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Scopes API keys can be limited to.
+const (
+	ScopeLinksCreate = "links:create"
+)
+
+// APIKeyScopes are all scopes API keys can be created with.
+var APIKeyScopes = []string{ScopeLinksCreate}
+
+// ValidScope reports whether scope is a known API key scope.
+func ValidScope(scope string) bool {
+	return contains(APIKeyScopes, scope)
+}
+
+// APIKey is a personal API key. Only the hash of the key is stored, the
+// public Prefix identifies it and finds it on use.
+type APIKey struct {
+	Prefix     string
+	Hash       string
+	UserID     int64
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+// Expired reports whether the key no longer works at now.
+func (k APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
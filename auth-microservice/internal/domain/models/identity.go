@@ -0,0 +1,9 @@
+package models
+
+// ExternalIdentity is a user as asserted by an external OpenID Connect provider.
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
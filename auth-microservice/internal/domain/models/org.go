@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Roles of organization members. Members read and create the links of the
+// organization, admins also change any of them and manage members, owners
+// manage admins and owners too.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// ValidOrgRole reports whether role is a known organization role.
+func ValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+// Organization is a workspace whose members share links.
+type Organization struct {
+	ID        int64
+	Name      string
+	CreatedBy int64
+	CreatedAt time.Time
+}
+
+// Membership is the role of a user in an organization.
+type Membership struct {
+	OrgID    int64
+	Role     string
+	JoinedAt time.Time
+}
+
+// Member is a user as listed among the members of an organization.
+type Member struct {
+	UserID   int64
+	Email    string
+	Role     string
+	JoinedAt time.Time
+}
+
+// Invitation invites an email to join an organization. Only the hash of the
+// mailed token is stored.
+type Invitation struct {
+	Hash      string
+	OrgID     int64
+	Email     string
+	Role      string
+	InvitedBy int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
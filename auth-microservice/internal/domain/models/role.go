@@ -0,0 +1,30 @@
+package models
+
+// Roles of users.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Permissions beyond managing one's own links, enforced by the gateway and
+// the services.
+const (
+	PermLinksReadAny  = "links:read:any"
+	PermLinksWriteAny = "links:write:any"
+	PermUsersRead     = "users:read"
+	PermUsersWrite    = "users:write"
+)
+
+// RolePermissions are the permissions every user of a role holds.
+var RolePermissions = map[string][]string{
+	RoleUser:    nil,
+	RoleSupport: {PermLinksReadAny, PermUsersRead},
+	RoleAdmin:   {PermLinksReadAny, PermLinksWriteAny, PermUsersRead, PermUsersWrite},
+}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
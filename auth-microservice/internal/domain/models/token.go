@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// RefreshToken is a server-side refresh token. Only the hash of the token is
+// stored. All tokens rotated from the same login share a FamilyID.
+type RefreshToken struct {
+	Hash      string
+	FamilyID  string
+	UserID    int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	Revoked   bool
+}
+
+// TokenPair is an access token together with the refresh token to renew it.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// Revocations are the access tokens revoked since some time, published to the
+// services verifying tokens locally. AsOf is where the next listing starts.
+type Revocations struct {
+	AsOf   time.Time
+	Tokens []RevokedToken
+	Users  []UserRevocation
+}
+
+// RevokedToken is an access token revoked by its ID.
+type RevokedToken struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// UserRevocation revokes the access tokens of the user issued before
+// NotBefore, until ExpiresAt when the last of them expires.
+type UserRevocation struct {
+	UserID    int64
+	NotBefore time.Time
+	ExpiresAt time.Time
+}
@@ -4,4 +4,71 @@ type User struct {
 	ID       int64
 	Email    string
 	PassHash []byte
+	Verified bool
+	Role     string
+	// Permissions are granted to the user on top of those of the role.
+	Permissions []string
+	Disabled    bool
+
+	TOTPSecret        string
+	TOTPPendingSecret string
+	TOTPLastStep      int64
+	// RecoveryCodes are the hashes of the unused recovery codes.
+	RecoveryCodes []string
+
+	// OIDCIssuer and OIDCSubject identify the account linked at the
+	// external identity provider, if any.
+	OIDCIssuer  string
+	OIDCSubject string
+
+	// Orgs are the organizations the user is a member of.
+	Orgs []Membership
+}
+
+// TOTPEnabled reports whether logins of the user need a second factor.
+func (u User) TOTPEnabled() bool {
+	return u.TOTPSecret != ""
+}
+
+// OrgRole returns the role of the user in the organization, empty for
+// non-members.
+func (u User) OrgRole(orgID int64) string {
+	for _, m := range u.Orgs {
+		if m.OrgID == orgID {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// EffectivePermissions returns the permissions of the role together with
+// those granted to the user directly.
+func (u User) EffectivePermissions() []string {
+	perms := append([]string(nil), RolePermissions[u.Role]...)
+	for _, p := range u.Permissions {
+		if !contains(perms, p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// Can reports whether the user holds the permission.
+func (u User) Can(permission string) bool {
+	return contains(u.EffectivePermissions(), permission)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// UserUpdate holds the changes administrators make to a user, nil fields stay unchanged.
+type UserUpdate struct {
+	Role     *string
+	Disabled *bool
 }
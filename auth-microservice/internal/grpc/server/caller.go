@@ -0,0 +1,61 @@
+package server
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/services"
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationMetadataKey carries the caller's bearer token, the API gateway
+// forwards it with every call.
+const authorizationMetadataKey = "authorization"
+
+// caller validates the bearer token of the call and returns its user.
+func (s *serverAPI) caller(ctx context.Context) (models.User, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.authService.ValidateJWT(ctx, token)
+	if err != nil {
+		return models.User{}, tokenError(err)
+	}
+
+	return user, nil
+}
+
+// tokenError converts errors of token validation into gRPC status errors.
+// Only rejected tokens are Unauthenticated, which the gateway remembers, a
+// failing lookup must not log valid users out.
+func tokenError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidToken),
+		errors.Is(err, services.ErrTokenRevoked),
+		errors.Is(err, services.ErrUserDisabled):
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return status.Error(codes.Internal, "failed to validate token")
+}
+
+// bearerToken returns the token of the "authorization" metadata.
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authorizationMetadataKey)
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return "", status.Error(codes.Unauthenticated, "invalid authorization metadata")
+	}
+
+	return token, nil
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"auth/internal/services"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"bad signature or expired", fmt.Errorf("%w: token is expired", services.ErrInvalidToken), codes.Unauthenticated},
+		{"revoked", services.ErrTokenRevoked, codes.Unauthenticated},
+		{"disabled user", services.ErrUserDisabled, codes.Unauthenticated},
+		{"failed lookup", errors.New("server selection timeout"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tokenError(tt.err)); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/services"
+	"auth/internal/storage"
+	"context"
+	"errors"
+	pb "github.com/yerlans/us-protos/gen/auth-service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+)
+
+func (s *serverAPI) CreateOrganization(
+	ctx context.Context,
+	in *pb.CreateOrganizationRequest,
+) (*pb.Organization, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := s.authService.CreateOrg(ctx, caller, in.GetName())
+	if err != nil {
+		return nil, orgError(err, "failed to create organization")
+	}
+
+	return orgToProto(org, models.OrgRoleOwner), nil
+}
+
+func (s *serverAPI) ListOrganizations(
+	ctx context.Context,
+	in *pb.ListOrganizationsRequest,
+) (*pb.ListOrganizationsResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs, err := s.authService.ListOrgs(ctx, caller)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list organizations")
+	}
+
+	resp := &pb.ListOrganizationsResponse{}
+	for _, org := range orgs {
+		resp.Organizations = append(resp.Organizations, orgToProto(org, caller.OrgRole(org.ID)))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListMembers(
+	ctx context.Context,
+	in *pb.ListMembersRequest,
+) (*pb.ListMembersResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.authService.ListMembers(ctx, caller, in.GetOrgId())
+	if err != nil {
+		return nil, orgError(err, "failed to list members")
+	}
+
+	resp := &pb.ListMembersResponse{}
+	for _, member := range members {
+		resp.Members = append(resp.Members, memberToProto(member))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) InviteMember(
+	ctx context.Context,
+	in *pb.InviteMemberRequest,
+) (*pb.InviteMemberResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	expiresAt, err := s.authService.InviteMember(ctx, caller, in.GetOrgId(), in.GetEmail(), in.GetRole())
+	if err != nil {
+		return nil, orgError(err, "failed to invite member")
+	}
+
+	return &pb.InviteMemberResponse{ExpiresAt: expiresAt.Unix()}, nil
+}
+
+func (s *serverAPI) AcceptInvitation(
+	ctx context.Context,
+	in *pb.AcceptInvitationRequest,
+) (*pb.Organization, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	org, role, err := s.authService.AcceptInvitation(ctx, caller, in.GetToken())
+	if err != nil {
+		return nil, orgError(err, "failed to accept invitation")
+	}
+
+	return orgToProto(org, role), nil
+}
+
+func (s *serverAPI) UpdateMember(
+	ctx context.Context,
+	in *pb.UpdateMemberRequest,
+) (*pb.Member, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.authService.UpdateMember(ctx, caller, in.GetOrgId(), in.GetUserId(), in.GetRole())
+	if err != nil {
+		return nil, orgError(err, "failed to update member")
+	}
+
+	return memberToProto(member), nil
+}
+
+func (s *serverAPI) RemoveMember(
+	ctx context.Context,
+	in *pb.RemoveMemberRequest,
+) (*pb.RemoveMemberResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transferred, err := s.authService.RemoveMember(ctx, caller, in.GetOrgId(), in.GetUserId())
+	if err != nil {
+		return nil, orgError(err, "failed to remove member")
+	}
+
+	return &pb.RemoveMemberResponse{TransferredLinks: transferred}, nil
+}
+
+func (s *serverAPI) GetOrgRoles(
+	ctx context.Context,
+	in *pb.GetOrgRolesRequest,
+) (*pb.GetOrgRolesResponse, error) {
+	if in.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	user, err := s.authService.TokenUser(ctx, in.Token)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	return &pb.GetOrgRolesResponse{Orgs: orgRoles(user.Orgs)}, nil
+}
+
+// orgError converts errors of organization management into gRPC status errors.
+func orgError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, services.ErrNotOrgMember), errors.Is(err, storage.ErrOrgNotFound):
+		return status.Error(codes.NotFound, "organization not found")
+	case errors.Is(err, storage.ErrMemberNotFound):
+		return status.Error(codes.NotFound, "member not found")
+	case errors.Is(err, services.ErrPermissionDenied),
+		errors.Is(err, services.ErrInviteForOthers),
+		errors.Is(err, services.ErrEmailNotVerified):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, services.ErrInvalidOrgName),
+		errors.Is(err, services.ErrInvalidOrgRole),
+		errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrInvalidInvite):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrMemberExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, services.ErrLastOwner):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, services.ErrLinkTransferFailed):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func orgToProto(org models.Organization, role string) *pb.Organization {
+	return &pb.Organization{
+		Id:        org.ID,
+		Name:      org.Name,
+		CreatedAt: org.CreatedAt.Unix(),
+		Role:      role,
+	}
+}
+
+func memberToProto(member models.Member) *pb.Member {
+	return &pb.Member{
+		UserId:   member.UserID,
+		Email:    member.Email,
+		Role:     member.Role,
+		JoinedAt: member.JoinedAt.Unix(),
+	}
+}
+
+// orgRoles maps the organization IDs of the memberships to their role.
+func orgRoles(memberships []models.Membership) map[string]string {
+	roles := make(map[string]string, len(memberships))
+	for _, m := range memberships {
+		roles[strconv.FormatInt(m.OrgID, 10)] = m.Role
+	}
+	return roles
+}
@@ -2,22 +2,53 @@ package server
 
 import (
 	"auth/internal/domain/models"
+	"auth/internal/services"
 	"auth/internal/storage"
 	"context"
 	"errors"
 	pb "github.com/yerlans/us-protos/gen/auth-service"
-	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"strconv"
+	"time"
 )
 
 type AuthService interface {
 	SaveUser(ctx context.Context, email string, pass string) (uid int64, err error)
-	GetUser(ctx context.Context, email string) (models.User, error)
-	GenerateJWT(user models.User) (string, error)
-	ValidateJWT(token string) (models.User, error)
+	Login(ctx context.Context, email, password, clientIP string) (models.TokenPair, error)
+	ValidateJWT(ctx context.Context, token string) (models.User, error)
+	TokenUser(ctx context.Context, token string) (models.User, error)
+	Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error)
+	Logout(ctx context.Context, accessToken, refreshToken string) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	ListUsers(ctx context.Context, caller models.User, limit, offset int64) ([]models.User, int64, error)
+	UpdateUser(ctx context.Context, caller models.User, id int64, update models.UserUpdate) (models.User, error)
+	CreateAPIKey(ctx context.Context, caller models.User, name string, scopes []string, expiresAt time.Time) (models.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, caller models.User) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, caller models.User, prefix string) error
+	AuthenticateAPIKey(ctx context.Context, key string) (models.User, models.APIKey, models.TokenPair, error)
+	EnrollTOTP(ctx context.Context, caller models.User) (secret, uri string, err error)
+	ConfirmTOTP(ctx context.Context, caller models.User, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, caller models.User, code string) error
+	VerifyTOTP(ctx context.Context, challenge, code, clientIP string) (models.TokenPair, error)
+	ChangePassword(ctx context.Context, caller models.User, accessToken, oldPassword, newPassword string) (models.TokenPair, error)
+	ChangeEmail(ctx context.Context, caller models.User, password, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	DeleteAccount(ctx context.Context, caller models.User, password, code string, keepLinks bool) (int64, error)
+	StartOIDCLogin(ctx context.Context) (authURL, session string, expiresIn time.Duration, err error)
+	FinishOIDCLogin(ctx context.Context, session, state, code, clientIP string) (models.TokenPair, error)
+	CreateOrg(ctx context.Context, caller models.User, name string) (models.Organization, error)
+	ListOrgs(ctx context.Context, caller models.User) ([]models.Organization, error)
+	ListMembers(ctx context.Context, caller models.User, orgID int64) ([]models.Member, error)
+	InviteMember(ctx context.Context, caller models.User, orgID int64, email, role string) (time.Time, error)
+	AcceptInvitation(ctx context.Context, caller models.User, token string) (models.Organization, string, error)
+	UpdateMember(ctx context.Context, caller models.User, orgID, userID int64, role string) (models.Member, error)
+	RemoveMember(ctx context.Context, caller models.User, orgID, userID int64) (int64, error)
 }
 
 type serverAPI struct {
@@ -43,10 +74,16 @@ func (s *serverAPI) Register(
 		if errors.Is(err, storage.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, services.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, "invalid email")
+		}
+		if errors.Is(err, services.ErrWeakPassword) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, "failed to save user")
 	}
 
-	return &pb.RegisterResponse{UserId: int32(userID)}, nil
+	return &pb.RegisterResponse{UserId: userID}, nil
 }
 
 func (s *serverAPI) Login(
@@ -57,26 +94,59 @@ func (s *serverAPI) Login(
 		return nil, status.Error(codes.InvalidArgument, "email and password are required")
 	}
 
-	user, err := s.authService.GetUser(ctx, in.Email)
+	tokens, err := s.authService.Login(ctx, in.Email, in.Password, in.ClientIp)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			return nil, status.Error(codes.NotFound, "user not found")
+		var lockout *services.LockoutError
+		var challenge *services.ChallengeError
+		switch {
+		case errors.As(err, &challenge):
+			return &pb.LoginResponse{TotpRequired: true, ChallengeToken: challenge.Token}, nil
+		case errors.Is(err, services.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		case errors.As(err, &lockout):
+			return nil, lockoutStatus(lockout)
+		case errors.Is(err, services.ErrEmailNotVerified):
+			return nil, status.Error(codes.FailedPrecondition, "email not verified")
+		case errors.Is(err, services.ErrUserDisabled):
+			return nil, status.Error(codes.PermissionDenied, "user disabled")
 		}
-		return nil, status.Error(codes.Internal, "failed to get user")
+		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
-	// Compare password
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(in.Password)); err != nil {
-		return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+	return loginResponse(tokens), nil
+}
+
+func (s *serverAPI) VerifyTOTP(
+	ctx context.Context,
+	in *pb.VerifyTOTPRequest,
+) (*pb.LoginResponse, error) {
+	if in.ChallengeToken == "" || in.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "challengeToken and code are required")
 	}
 
-	// Generate JWT
-	token, err := s.authService.GenerateJWT(user)
+	tokens, err := s.authService.VerifyTOTP(ctx, in.GetChallengeToken(), in.GetCode(), in.GetClientIp())
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to generate token")
+		var lockout *services.LockoutError
+		switch {
+		case errors.Is(err, services.ErrInvalidActionToken):
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired challenge")
+		case errors.Is(err, services.ErrInvalidTOTPCode):
+			return nil, status.Error(codes.Unauthenticated, "invalid code")
+		case errors.As(err, &lockout):
+			return nil, lockoutStatus(lockout)
+		}
+		return nil, status.Error(codes.Internal, "failed to verify code")
 	}
 
-	return &pb.LoginResponse{Token: token}, nil
+	return loginResponse(tokens), nil
+}
+
+func loginResponse(tokens models.TokenPair) *pb.LoginResponse {
+	return &pb.LoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}
 }
 
 func (s *serverAPI) ValidateToken(
@@ -87,13 +157,536 @@ func (s *serverAPI) ValidateToken(
 		return nil, status.Error(codes.InvalidArgument, "token is required")
 	}
 
-	user, err := s.authService.ValidateJWT(in.Token)
+	user, err := s.authService.ValidateJWT(ctx, in.Token)
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "invalid token")
+		return nil, tokenError(err)
 	}
-	//TODO: edit proto userId- int
 	return &pb.ValidateTokenResponse{
-		Email:  user.Email,
-		UserId: strconv.FormatInt(user.ID, 10),
+		Email:       user.Email,
+		UserId:      strconv.FormatInt(user.ID, 10),
+		Role:        user.Role,
+		Permissions: user.EffectivePermissions(),
+		Orgs:        orgRoles(user.Orgs),
+	}, nil
+}
+
+func (s *serverAPI) Refresh(
+	ctx context.Context,
+	in *pb.RefreshRequest,
+) (*pb.RefreshResponse, error) {
+	if in.RefreshToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh token is required")
+	}
+
+	tokens, err := s.authService.Refresh(ctx, in.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) ||
+			errors.Is(err, services.ErrUserDisabled) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, status.Error(codes.Internal, "failed to refresh token")
+	}
+
+	return &pb.RefreshResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) Logout(
+	ctx context.Context,
+	in *pb.LogoutRequest,
+) (*pb.LogoutResponse, error) {
+	if in.Token == "" && in.RefreshToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "token or refresh token is required")
+	}
+
+	if err := s.authService.Logout(ctx, in.Token, in.RefreshToken); err != nil {
+		return nil, status.Error(codes.Internal, "failed to logout")
+	}
+
+	return &pb.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) VerifyEmail(
+	ctx context.Context,
+	in *pb.VerifyEmailRequest,
+) (*pb.VerifyEmailResponse, error) {
+	if in.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if err := s.authService.VerifyEmail(ctx, in.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidActionToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired token")
+		}
+		return nil, status.Error(codes.Internal, "failed to verify email")
+	}
+
+	return &pb.VerifyEmailResponse{}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(
+	ctx context.Context,
+	in *pb.RequestPasswordResetRequest,
+) (*pb.RequestPasswordResetResponse, error) {
+	if in.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if err := s.authService.RequestPasswordReset(ctx, in.Email); err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, "invalid email")
+		}
+		return nil, status.Error(codes.Internal, "failed to request password reset")
+	}
+
+	return &pb.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ResetPassword(
+	ctx context.Context,
+	in *pb.ResetPasswordRequest,
+) (*pb.ResetPasswordResponse, error) {
+	if in.Token == "" || in.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "token and password are required")
+	}
+
+	if err := s.authService.ResetPassword(ctx, in.Token, in.Password); err != nil {
+		if errors.Is(err, services.ErrInvalidActionToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired token")
+		}
+		if errors.Is(err, services.ErrWeakPassword) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to reset password")
+	}
+
+	return &pb.ResetPasswordResponse{}, nil
+}
+
+func (s *serverAPI) ListUsers(
+	ctx context.Context,
+	in *pb.ListUsersRequest,
+) (*pb.ListUsersResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.authService.ListUsers(ctx, caller, in.GetLimit(), in.GetOffset())
+	if err != nil {
+		return nil, userError(err, "failed to list users")
+	}
+
+	resp := &pb.ListUsersResponse{Total: total}
+	for _, user := range users {
+		resp.Users = append(resp.Users, userToProto(user))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) UpdateUser(
+	ctx context.Context,
+	in *pb.UpdateUserRequest,
+) (*pb.User, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	user, err := s.authService.UpdateUser(ctx, caller, in.GetId(), models.UserUpdate{
+		Role:     in.Role,
+		Disabled: in.Disabled,
+	})
+	if err != nil {
+		return nil, userError(err, "failed to update user")
+	}
+
+	return userToProto(user), nil
+}
+
+// userError converts errors of user management into gRPC status errors.
+func userError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, services.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "permission denied")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrSelfLockout):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func userToProto(user models.User) *pb.User {
+	return &pb.User{
+		Id:          user.ID,
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: user.Permissions,
+		Verified:    user.Verified,
+		Disabled:    user.Disabled,
+		TotpEnabled: user.TOTPEnabled(),
+	}
+}
+
+func (s *serverAPI) CreateAPIKey(
+	ctx context.Context,
+	in *pb.CreateAPIKeyRequest,
+) (*pb.CreateAPIKeyResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt time.Time
+	if in.GetExpiresAt() != 0 {
+		expiresAt = time.Unix(in.GetExpiresAt(), 0)
+	}
+
+	key, raw, err := s.authService.CreateAPIKey(ctx, caller, in.GetName(), in.GetScopes(), expiresAt)
+	if err != nil {
+		return nil, apiKeyError(err, "failed to create api key")
+	}
+
+	return &pb.CreateAPIKeyResponse{ApiKey: apiKeyToProto(key), Key: raw}, nil
+}
+
+func (s *serverAPI) ListAPIKeys(
+	ctx context.Context,
+	in *pb.ListAPIKeysRequest,
+) (*pb.ListAPIKeysResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := s.authService.ListAPIKeys(ctx, caller)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list api keys")
+	}
+
+	resp := &pb.ListAPIKeysResponse{}
+	for _, key := range keys {
+		resp.ApiKeys = append(resp.ApiKeys, apiKeyToProto(key))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeAPIKey(
+	ctx context.Context,
+	in *pb.RevokeAPIKeyRequest,
+) (*pb.RevokeAPIKeyResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := s.authService.RevokeAPIKey(ctx, caller, in.GetId()); err != nil {
+		return nil, apiKeyError(err, "failed to revoke api key")
+	}
+
+	return &pb.RevokeAPIKeyResponse{}, nil
+}
+
+func (s *serverAPI) AuthenticateAPIKey(
+	ctx context.Context,
+	in *pb.AuthenticateAPIKeyRequest,
+) (*pb.AuthenticateAPIKeyResponse, error) {
+	if in.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+
+	user, key, token, err := s.authService.AuthenticateAPIKey(ctx, in.GetKey())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) || errors.Is(err, services.ErrUserDisabled) {
+			return nil, status.Error(codes.Unauthenticated, "invalid api key")
+		}
+		return nil, status.Error(codes.Internal, "failed to authenticate api key")
+	}
+
+	return &pb.AuthenticateAPIKeyResponse{
+		UserId:    strconv.FormatInt(user.ID, 10),
+		Email:     user.Email,
+		Scopes:    key.Scopes,
+		Token:     token.AccessToken,
+		ExpiresIn: int64(token.ExpiresIn.Seconds()),
 	}, nil
 }
+
+func (s *serverAPI) EnrollTOTP(
+	ctx context.Context,
+	in *pb.EnrollTOTPRequest,
+) (*pb.EnrollTOTPResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, uri, err := s.authService.EnrollTOTP(ctx, caller)
+	if err != nil {
+		return nil, totpError(err, "failed to enroll totp")
+	}
+
+	return &pb.EnrollTOTPResponse{Secret: secret, Uri: uri}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(
+	ctx context.Context,
+	in *pb.ConfirmTOTPRequest,
+) (*pb.ConfirmTOTPResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	recoveryCodes, err := s.authService.ConfirmTOTP(ctx, caller, in.GetCode())
+	if err != nil {
+		return nil, totpError(err, "failed to confirm totp")
+	}
+
+	return &pb.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) DisableTOTP(
+	ctx context.Context,
+	in *pb.DisableTOTPRequest,
+) (*pb.DisableTOTPResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	if err := s.authService.DisableTOTP(ctx, caller, in.GetCode()); err != nil {
+		return nil, totpError(err, "failed to disable totp")
+	}
+
+	return &pb.DisableTOTPResponse{}, nil
+}
+
+// totpError converts errors of two-factor management into gRPC status errors.
+func totpError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, services.ErrTOTPAlreadyEnabled),
+		errors.Is(err, services.ErrTOTPNotEnabled),
+		errors.Is(err, services.ErrTOTPNotEnrolled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, services.ErrInvalidTOTPCode):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func (s *serverAPI) ChangePassword(
+	ctx context.Context,
+	in *pb.ChangePasswordRequest,
+) (*pb.LoginResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.OldPassword == "" || in.NewPassword == "" {
+		return nil, status.Error(codes.InvalidArgument, "oldPassword and newPassword are required")
+	}
+
+	tokens, err := s.authService.ChangePassword(ctx, caller, token, in.GetOldPassword(), in.GetNewPassword())
+	if err != nil {
+		return nil, accountError(err, "failed to change password")
+	}
+
+	return loginResponse(tokens), nil
+}
+
+func (s *serverAPI) ChangeEmail(
+	ctx context.Context,
+	in *pb.ChangeEmailRequest,
+) (*pb.ChangeEmailResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.NewEmail == "" || in.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "newEmail and password are required")
+	}
+
+	if err := s.authService.ChangeEmail(ctx, caller, in.GetPassword(), in.GetNewEmail()); err != nil {
+		return nil, accountError(err, "failed to change email")
+	}
+
+	return &pb.ChangeEmailResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmEmailChange(
+	ctx context.Context,
+	in *pb.ConfirmEmailChangeRequest,
+) (*pb.ConfirmEmailChangeResponse, error) {
+	if in.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if err := s.authService.ConfirmEmailChange(ctx, in.GetToken()); err != nil {
+		if errors.Is(err, services.ErrInvalidActionToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired token")
+		}
+		return nil, accountError(err, "failed to change email")
+	}
+
+	return &pb.ConfirmEmailChangeResponse{}, nil
+}
+
+func (s *serverAPI) DeleteAccount(
+	ctx context.Context,
+	in *pb.DeleteAccountRequest,
+) (*pb.DeleteAccountResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	removed, err := s.authService.DeleteAccount(ctx, caller, in.GetPassword(), in.GetCode(), in.GetKeepLinks())
+	if err != nil {
+		return nil, accountError(err, "failed to delete account")
+	}
+
+	return &pb.DeleteAccountResponse{DeletedLinks: removed}, nil
+}
+
+// accountError converts errors of account management into gRPC status errors.
+// A wrong password fails with PERMISSION_DENIED rather than UNAUTHENTICATED,
+// the caller's token is fine.
+func accountError(err error, internalMsg string) error {
+	var lockout *services.LockoutError
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		return status.Error(codes.PermissionDenied, "wrong password")
+	case errors.As(err, &lockout):
+		return lockoutStatus(lockout)
+	case errors.Is(err, services.ErrInvalidTOTPCode):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, services.ErrWeakPassword),
+		errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrEmailUnchanged):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrUserExists):
+		return status.Error(codes.AlreadyExists, "email already in use")
+	case errors.Is(err, services.ErrLinkCleanupFailed):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func (s *serverAPI) StartOIDCLogin(
+	ctx context.Context,
+	in *pb.StartOIDCLoginRequest,
+) (*pb.StartOIDCLoginResponse, error) {
+	authURL, session, expiresIn, err := s.authService.StartOIDCLogin(ctx)
+	if err != nil {
+		return nil, oidcError(err, "failed to start single sign-on")
+	}
+
+	return &pb.StartOIDCLoginResponse{
+		AuthUrl:   authURL,
+		Session:   session,
+		ExpiresIn: int64(expiresIn.Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) FinishOIDCLogin(
+	ctx context.Context,
+	in *pb.FinishOIDCLoginRequest,
+) (*pb.LoginResponse, error) {
+	if in.Session == "" || in.Code == "" || in.State == "" {
+		return nil, status.Error(codes.InvalidArgument, "session, code and state are required")
+	}
+
+	tokens, err := s.authService.FinishOIDCLogin(ctx, in.GetSession(), in.GetState(), in.GetCode(), in.GetClientIp())
+	if err != nil {
+		var challenge *services.ChallengeError
+		if errors.As(err, &challenge) {
+			return &pb.LoginResponse{TotpRequired: true, ChallengeToken: challenge.Token}, nil
+		}
+		return nil, oidcError(err, "failed to finish single sign-on")
+	}
+
+	return loginResponse(tokens), nil
+}
+
+// oidcError converts errors of single sign-on into gRPC status errors.
+func oidcError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, services.ErrOIDCDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, services.ErrInvalidOIDCLogin):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, services.ErrOIDCEmailNotVerified),
+		errors.Is(err, services.ErrOIDCAccountLinked),
+		errors.Is(err, services.ErrOIDCNotRegistered),
+		errors.Is(err, services.ErrUserDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+// apiKeyError converts errors of API key management into gRPC status errors.
+func apiKeyError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, storage.ErrAPIKeyNotFound):
+		return status.Error(codes.NotFound, "api key not found")
+	case errors.Is(err, services.ErrInvalidAPIKeyName),
+		errors.Is(err, services.ErrInvalidScope),
+		errors.Is(err, services.ErrInvalidExpiration):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, services.ErrTooManyAPIKeys):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func apiKeyToProto(key models.APIKey) *pb.APIKey {
+	resp := &pb.APIKey{
+		Id:        key.Prefix,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Unix(),
+	}
+	if !key.ExpiresAt.IsZero() {
+		resp.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	if !key.LastUsedAt.IsZero() {
+		resp.LastUsedAt = key.LastUsedAt.Unix()
+	}
+	return resp
+}
+
+// lockoutStatus tells the client when to retry with a RetryInfo detail.
+func lockoutStatus(lockout *services.LockoutError) error {
+	st := status.New(codes.ResourceExhausted, "too many failed login attempts")
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(lockout.RetryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,217 @@
+// Package keys manages the keys JWTs are signed with and publishes their
+// public halves as a JWKS document.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"auth/internal/config"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported JWS algorithms.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrNoActiveKey      = errors.New("active signing key is not configured")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrKeyAlgMismatch   = errors.New("private key does not match algorithm")
+	ErrActiveKeyRetired = errors.New("active signing key is retired")
+)
+
+// Key is a signing key with its identifier.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	RetiredAt time.Time
+}
+
+// Public returns the public half of the key.
+func (k Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// KeySet is the set of keys tokens are signed and verified with.
+type KeySet struct {
+	active Key
+	keys   map[string]Key
+	grace  time.Duration
+}
+
+// Load reads the keys listed in the config from disk.
+func Load(cfg config.JWT) (*KeySet, error) {
+	const op = "keys.Load"
+
+	set := &KeySet{
+		keys:  make(map[string]Key, len(cfg.Keys)),
+		grace: cfg.GracePeriod,
+	}
+
+	for _, k := range cfg.Keys {
+		key, err := loadKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", op, k.ID, err)
+		}
+		set.keys[key.ID] = key
+	}
+
+	active, ok := set.keys[cfg.ActiveKey]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, ErrNoActiveKey)
+	}
+	if !active.RetiredAt.IsZero() {
+		return nil, fmt.Errorf("%s: %w", op, ErrActiveKeyRetired)
+	}
+	set.active = active
+
+	return set, nil
+}
+
+// Ephemeral creates a key set with a single Ed25519 key generated in memory.
+// Tokens signed with it don't survive a restart, it's meant for development.
+func Ephemeral() (*KeySet, error) {
+	const op = "keys.Ephemeral"
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: generate key: %w", op, err)
+	}
+
+	key := Key{
+		ID:      "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+		Method:  jwt.SigningMethodEdDSA,
+		Private: private,
+	}
+
+	return &KeySet{
+		active: key,
+		keys:   map[string]Key{key.ID: key},
+	}, nil
+}
+
+func loadKey(cfg config.SigningKey) (Key, error) {
+	if cfg.ID == "" {
+		return Key{}, errors.New("key id is empty")
+	}
+
+	data, err := os.ReadFile(cfg.PrivateKeyPath)
+	if err != nil {
+		return Key{}, fmt.Errorf("read private key: %w", err)
+	}
+
+	key := Key{ID: cfg.ID, RetiredAt: cfg.RetiredAt}
+
+	switch cfg.Algorithm {
+	case AlgorithmRS256:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return Key{}, fmt.Errorf("parse private key: %w", err)
+		}
+		key.Method, key.Private = jwt.SigningMethodRS256, private
+	case AlgorithmEdDSA:
+		parsed, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return Key{}, fmt.Errorf("parse private key: %w", err)
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return Key{}, ErrKeyAlgMismatch
+		}
+		key.Method, key.Private = jwt.SigningMethodEdDSA, private
+	default:
+		return Key{}, fmt.Errorf("%w: %q", ErrUnsupportedAlg, cfg.Algorithm)
+	}
+
+	return key, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (s *KeySet) Active() Key {
+	return s.active
+}
+
+// Verification returns the key with the given id if it may still verify
+// tokens at now, i.e. it is not retired or within its grace period.
+func (s *KeySet) Verification(kid string, now time.Time) (Key, error) {
+	key, ok := s.keys[kid]
+	if !ok || !s.verifies(key, now) {
+		return Key{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (s *KeySet) verifies(key Key, now time.Time) bool {
+	return key.RetiredAt.IsZero() || now.Before(key.RetiredAt.Add(s.grace))
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that verify tokens at now.
+func (s *KeySet) JWKS(now time.Time) JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		if !s.verifies(key, now) {
+			continue
+		}
+
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch public := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// Handler serves the JWKS document.
+func (s *KeySet) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Verifiers refetch on unknown key ids, so a short cache lifetime is enough.
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_ = json.NewEncoder(w).Encode(s.JWKS(time.Now()))
+	})
+}
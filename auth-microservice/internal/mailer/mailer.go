@@ -0,0 +1,45 @@
+// Package mailer sends the transactional emails of the auth service.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"auth/internal/config"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Supported drivers.
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+// New creates the mailer of the configured driver.
+func New(log *slog.Logger, cfg config.Mailer) (Mailer, error) {
+	const op = "mailer.New"
+
+	switch cfg.Driver {
+	case DriverLog, "":
+		return NewLogMailer(log), nil
+	case DriverFile:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case DriverSMTP:
+		return NewSMTPMailer(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown driver %q", op, cfg.Driver)
+	}
+}
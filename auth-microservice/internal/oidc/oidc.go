@@ -0,0 +1,145 @@
+// Package oidc signs users in with an external OpenID Connect provider using
+// the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"auth/internal/config"
+	"auth/internal/domain/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNoIDToken     = errors.New("token response without id_token")
+	ErrNonceMismatch = errors.New("id token nonce mismatch")
+)
+
+// Provider is the configured identity provider. Its discovery document is
+// fetched on first use and kept once fetched, so the service starts while
+// the provider is unreachable.
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func New(cfg config.OIDC) *Provider {
+	return &Provider{
+		issuer:       cfg.Issuer,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURL:  cfg.RedirectURL,
+		scopes:       cfg.Scopes,
+		client:       &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// AuthCodeURL returns the URL of the provider's login page. The verifier is
+// sent as its S256 challenge and must be presented again to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the authorization code and verifies the ID token of the
+// response. The email is taken from the userinfo endpoint when the ID token
+// doesn't carry it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (models.ExternalIdentity, error) {
+	const op = "oidc.Exchange"
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return models.ExternalIdentity{}, err
+	}
+	ctx = oidc.ClientContext(ctx, p.client)
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return models.ExternalIdentity{}, fmt.Errorf("%s: exchange code: %w", op, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return models.ExternalIdentity{}, fmt.Errorf("%s: %w", op, ErrNoIDToken)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.clientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return models.ExternalIdentity{}, fmt.Errorf("%s: verify id token: %w", op, err)
+	}
+	if idToken.Nonce != nonce {
+		return models.ExternalIdentity{}, fmt.Errorf("%s: %w", op, ErrNonceMismatch)
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return models.ExternalIdentity{}, fmt.Errorf("%s: decode claims: %w", op, err)
+	}
+
+	if claims.Email == "" {
+		info, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return models.ExternalIdentity{}, fmt.Errorf("%s: userinfo: %w", op, err)
+		}
+		// Userinfo of another subject must not be trusted for this token.
+		if info.Subject == idToken.Subject {
+			claims.Email, claims.EmailVerified = info.Email, info.EmailVerified
+		}
+	}
+
+	return models.ExternalIdentity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, error) {
+	const op = "oidc.discover"
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), p.issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	p.provider = provider
+
+	return provider, nil
+}
+
+func (p *Provider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		RedirectURL:  p.redirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.scopes,
+	}
+}
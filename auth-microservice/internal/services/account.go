@@ -0,0 +1,256 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/mailer"
+	"auth/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrEmailUnchanged = errors.New("new email is the current one")
+	// ErrLinkCleanupFailed is returned when the links of an account to be
+	// deleted couldn't be removed, the account is kept so that it can be retried.
+	ErrLinkCleanupFailed = errors.New("failed to remove the links of the account")
+)
+
+// scopeAccountDeletion limits the token presented to the URL shortener service
+// when removing the links of a deleted account. API keys can't have it.
+const scopeAccountDeletion = "account:delete"
+
+// linkCleanupTokenTTL is the lifetime of the token of the link cleanup call.
+const linkCleanupTokenTTL = time.Minute
+
+// LinkCleaner removes the links of deleted accounts from the URL shortener
+// service and hands over the links of members leaving an organization.
+type LinkCleaner interface {
+	DeleteUserLinks(ctx context.Context, userID int64, token string, anonymize bool) (int64, error)
+	TransferOrgLinks(ctx context.Context, userID int64, token string, orgID int64, role string, fromID, toID int64) (int64, error)
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// session of the user ends, including the one of accessToken, and the tokens
+// of a new session are returned. Wrong passwords count as failed logins.
+func (u *Auth) ChangePassword(ctx context.Context, caller models.User, accessToken, oldPassword, newPassword string) (models.TokenPair, error) {
+	if err := u.checkPassword(ctx, caller, oldPassword); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if err := u.passwords.Validate(newPassword); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	passHash, err := u.passwords.Hash(newPassword)
+	if err != nil {
+		u.log.Error("failed to hash password", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	if err := u.storage.UpdatePassword(ctx, caller.ID, passHash); err != nil {
+		u.log.Error("failed to update password", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+	if err := u.revokeSessions(ctx, caller.ID); err != nil {
+		u.log.Error("failed to revoke sessions", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+	if err := u.Logout(ctx, accessToken, ""); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	u.audit(ctx, "password.changed", slog.Int64("user_id", caller.ID))
+	u.sendMail(mailer.Message{
+		To:      caller.Email,
+		Subject: "Your password was changed",
+		Body: "The password of your account was just changed and all other sessions were ended.\n\n" +
+			"If it wasn't you, reset your password right away.\n",
+	})
+
+	return u.IssueTokens(ctx, caller)
+}
+
+// ChangeEmail mails a confirmation link to the new email, the email changes
+// once ConfirmEmailChange is called with the token of the link.
+func (u *Auth) ChangeEmail(ctx context.Context, caller models.User, password, newEmail string) error {
+	if err := validateEmail(newEmail); err != nil {
+		return err
+	}
+	if newEmail == caller.Email {
+		return ErrEmailUnchanged
+	}
+
+	if err := u.checkPassword(ctx, caller, password); err != nil {
+		return err
+	}
+
+	_, err := u.storage.GetUser(ctx, newEmail)
+	if err == nil {
+		return storage.ErrUserExists
+	}
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return err
+	}
+
+	claims, err := u.newActionClaims(caller, purposeChangeEmail, u.actions.VerifyTTL)
+	if err != nil {
+		return err
+	}
+	claims.NewEmail = newEmail
+	token, err := u.signActionToken(claims)
+	if err != nil {
+		return err
+	}
+
+	u.audit(ctx, "email.change_requested", slog.Int64("user_id", caller.ID))
+	u.sendMail(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Someone asked to change the email of an account to this address.\n\n"+
+			"Open the link below within %s to confirm the change:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email.\n",
+			u.actions.VerifyTTL, actionURL(u.actions.ChangeEmailURL, token)),
+	})
+
+	return nil
+}
+
+// ConfirmEmailChange changes the email to the one the token was mailed to,
+// which also verifies it. Tokens stop working once the email changed since
+// they were issued. The previous address is told about the change.
+func (u *Auth) ConfirmEmailChange(ctx context.Context, token string) error {
+	claims, user, err := u.useActionToken(ctx, token, purposeChangeEmail)
+	if err != nil {
+		return err
+	}
+	if claims.NewEmail == "" {
+		return ErrInvalidActionToken
+	}
+
+	if err := u.storage.UpdateEmail(ctx, user.ID, claims.NewEmail); err != nil {
+		if !errors.Is(err, storage.ErrUserExists) {
+			u.log.Error("failed to change email", slog.String("err", err.Error()))
+		}
+		return err
+	}
+
+	u.audit(ctx, "email.changed",
+		slog.Int64("user_id", user.ID),
+		slog.String("old_email", user.Email),
+		slog.String("email", claims.NewEmail),
+	)
+	u.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email was changed",
+		Body: fmt.Sprintf("The email of your account was changed to %s.\n\n"+
+			"If it wasn't you, contact support right away.\n", claims.NewEmail),
+	})
+
+	return nil
+}
+
+// DeleteAccount deletes the caller after checking the password, and the
+// second factor if enabled. The user leaves their organizations first, see
+// leaveOrgs, then the links of the user are deleted, or kept without an owner
+// with keepLinks, then the API keys, sessions and the user itself.
+// Organizations left without members go last. It returns the number of links
+// removed.
+func (u *Auth) DeleteAccount(ctx context.Context, caller models.User, password, code string, keepLinks bool) (int64, error) {
+	if err := u.checkPassword(ctx, caller, password); err != nil {
+		return 0, err
+	}
+	if caller.TOTPEnabled() {
+		ok, err := u.checkSecondFactor(ctx, caller, code)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			u.loginFailed(ctx, caller.Email, "")
+			return 0, ErrInvalidTOTPCode
+		}
+	}
+
+	abandoned, err := u.leaveOrgs(ctx, caller)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	if u.links != nil {
+		token, err := u.generateJWT(caller, linkCleanupTokenTTL, []string{scopeAccountDeletion})
+		if err != nil {
+			return 0, err
+		}
+		removed, err = u.links.DeleteUserLinks(ctx, caller.ID, token, keepLinks)
+		if err != nil {
+			u.log.Error("failed to remove links of deleted account",
+				slog.Int64("user_id", caller.ID), slog.String("err", err.Error()))
+			return 0, ErrLinkCleanupFailed
+		}
+	} else {
+		u.log.Warn("no url shortener configured, links of deleted account are kept", slog.Int64("user_id", caller.ID))
+	}
+
+	if err := u.apiKeys.DeleteUserAPIKeys(ctx, caller.ID); err != nil {
+		u.log.Error("failed to delete api keys", slog.String("err", err.Error()))
+		return 0, err
+	}
+	if err := u.revokeSessions(ctx, caller.ID); err != nil {
+		u.log.Error("failed to revoke sessions", slog.String("err", err.Error()))
+		return 0, err
+	}
+	if err := u.storage.DeleteUser(ctx, caller.ID); err != nil {
+		u.log.Error("failed to delete user", slog.String("err", err.Error()))
+		return 0, err
+	}
+	if err := u.attempts.Reset(ctx, accountKey(caller.Email)); err != nil {
+		u.log.Error("failed to reset login failures", slog.String("err", err.Error()))
+	}
+	for _, orgID := range abandoned {
+		if err := u.orgs.DeleteOrg(ctx, orgID); err != nil {
+			u.log.Error("failed to delete abandoned organization", slog.Int64("org_id", orgID), slog.String("err", err.Error()))
+		}
+	}
+
+	u.audit(ctx, "account.deleted",
+		slog.Int64("user_id", caller.ID),
+		slog.Int64("links", removed),
+		slog.Bool("links_kept", keepLinks),
+	)
+	u.sendMail(mailer.Message{
+		To:      caller.Email,
+		Subject: "Your account was deleted",
+		Body:    "Your account was deleted as requested. Thank you for using the service.\n",
+	})
+
+	return removed, nil
+}
+
+// checkPassword verifies the password of a signed in user before a sensitive
+// change. Failures count towards the lockout of the account like failed
+// logins do, so a stolen session can't be used to guess the password.
+func (u *Auth) checkPassword(ctx context.Context, user models.User, password string) error {
+	locked, err := u.lockedFor(ctx, user.Email, "")
+	if err != nil {
+		u.log.Error("failed to check lockout", slog.String("err", err.Error()))
+		return err
+	}
+	if locked > 0 {
+		return &LockoutError{RetryAfter: locked}
+	}
+
+	ok, _, err := u.passwords.Verify(user.PassHash, password)
+	if err != nil {
+		u.log.Error("failed to verify password", slog.Int64("user_id", user.ID), slog.String("err", err.Error()))
+	}
+	if !ok {
+		u.loginFailed(ctx, user.Email, "")
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
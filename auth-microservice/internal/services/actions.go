@@ -0,0 +1,335 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/mailer"
+	"auth/internal/storage"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email")
+	// ErrEmailNotVerified is returned on login while verification is required.
+	ErrEmailNotVerified   = errors.New("email not verified")
+	ErrInvalidActionToken = errors.New("invalid or expired token")
+)
+
+// Purposes of action tokens, a token is only accepted for its own purpose.
+const (
+	purposeVerifyEmail   = "verify-email"
+	purposeResetPassword = "reset-password"
+	purposeChangeEmail   = "change-email"
+)
+
+// mailTimeout bounds the delivery of a single email.
+const mailTimeout = 30 * time.Second
+
+// ActionPolicy configures the single-use tokens mailed to users.
+type ActionPolicy struct {
+	// Secret signs the tokens. They are HMAC signed rather than with the
+	// JWT keys so they can never pass as access tokens.
+	Secret          []byte
+	VerifyTTL       time.Duration
+	ResetTTL        time.Duration
+	VerifyURL       string
+	ResetURL        string
+	ChangeEmailURL  string
+	RequireVerified bool
+}
+
+type actionClaims struct {
+	Email string `json:"email"`
+	// Password fingerprints the password hash the token was issued for, so a
+	// reset token stops working once the password changes.
+	Password string `json:"pwd,omitempty"`
+	// NewEmail is the address an email change is confirmed for.
+	NewEmail string `json:"new_email,omitempty"`
+	jwt.StandardClaims
+}
+
+// validateEmail accepts bare addresses only, without display names.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// VerifyEmail marks the user's email as verified. Tokens for an email the
+// user no longer has are rejected.
+func (u *Auth) VerifyEmail(ctx context.Context, token string) error {
+	claims, user, err := u.useActionToken(ctx, token, purposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if user.Verified {
+		return nil
+	}
+
+	if err := u.storage.SetVerified(ctx, user.ID); err != nil {
+		u.log.Error("failed to verify email", slog.String("err", err.Error()))
+		return err
+	}
+
+	u.audit(ctx, "email.verified", slog.Int64("user_id", user.ID), slog.String("email", claims.Email))
+
+	return nil
+}
+
+// RequestPasswordReset mails a reset link if the email belongs to a user. It
+// doesn't tell whether it does, and quietly stops mailing an address after
+// too many requests.
+func (u *Auth) RequestPasswordReset(ctx context.Context, email string) error {
+	if err := validateEmail(email); err != nil {
+		return err
+	}
+
+	requests, err := u.attempts.Increment(ctx, "reset:"+accountKey(email), u.lockout.Window)
+	if err != nil {
+		u.log.Error("failed to count reset request", slog.String("err", err.Error()))
+		return err
+	}
+	if u.lockout.MaxFailures > 0 && requests > u.lockout.MaxFailures {
+		u.audit(ctx, "password.reset_throttled", slog.String("email", email))
+		return nil
+	}
+
+	user, err := u.storage.GetUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil
+		}
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return err
+	}
+
+	token, err := u.actionToken(user, purposeResetPassword, u.actions.ResetTTL)
+	if err != nil {
+		return err
+	}
+
+	u.audit(ctx, "password.reset_requested", slog.Int64("user_id", user.ID))
+	u.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account.\n\n"+
+			"Open the link below within %s to choose a new password:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email, your password stays unchanged.\n",
+			u.actions.ResetTTL, actionURL(u.actions.ResetURL, token)),
+	})
+
+	return nil
+}
+
+// ResetPassword sets a new password and ends every session of the user. As
+// the reset proves control of the mailbox it verifies the email too. The
+// token is consumed only once the password is accepted, a rejected one can
+// be retried with the same link.
+func (u *Auth) ResetPassword(ctx context.Context, token, password string) error {
+	claims, user, err := u.verifyActionToken(ctx, token, purposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := u.passwords.Validate(password); err != nil {
+		return err
+	}
+
+	if err := u.consumeActionToken(ctx, claims); err != nil {
+		return err
+	}
+
+	passHash, err := u.passwords.Hash(password)
+	if err != nil {
+		u.log.Error("failed to hash password", slog.String("err", err.Error()))
+		return err
+	}
+
+	if err := u.storage.UpdatePassword(ctx, user.ID, passHash); err != nil {
+		u.log.Error("failed to update password", slog.String("err", err.Error()))
+		return err
+	}
+	if !user.Verified {
+		if err := u.storage.SetVerified(ctx, user.ID); err != nil {
+			u.log.Error("failed to verify email", slog.String("err", err.Error()))
+		}
+	}
+	if err := u.revokeSessions(ctx, user.ID); err != nil {
+		u.log.Error("failed to revoke sessions", slog.String("err", err.Error()))
+		return err
+	}
+	if err := u.attempts.Reset(ctx, accountKey(user.Email)); err != nil {
+		u.log.Error("failed to reset login failures", slog.String("err", err.Error()))
+	}
+
+	u.audit(ctx, "password.reset", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+// sendVerification mails the email verification link to a new user.
+func (u *Auth) sendVerification(user models.User) {
+	token, err := u.actionToken(user, purposeVerifyEmail, u.actions.VerifyTTL)
+	if err != nil {
+		return
+	}
+
+	u.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Welcome!\n\nOpen the link below within %s to verify your email:\n\n%s\n",
+			u.actions.VerifyTTL, actionURL(u.actions.VerifyURL, token)),
+	})
+}
+
+// sendMail delivers the message in the background, a slow or failing mail
+// server must not fail the request that triggered it.
+func (u *Auth) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := u.mailer.Send(ctx, msg); err != nil {
+			u.log.Error("failed to send mail", slog.String("to", msg.To), slog.String("err", err.Error()))
+		}
+	}()
+}
+
+func (u *Auth) actionToken(user models.User, purpose string, ttl time.Duration) (string, error) {
+	claims, err := u.newActionClaims(user, purpose, ttl)
+	if err != nil {
+		return "", err
+	}
+	return u.signActionToken(claims)
+}
+
+func (u *Auth) newActionClaims(user models.User, purpose string, ttl time.Duration) (actionClaims, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		u.log.Error("failed to generate token id", slog.String("err", err.Error()))
+		return actionClaims{}, err
+	}
+
+	now := time.Now()
+	claims := actionClaims{
+		Email: user.Email,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  purpose,
+			Issuer:    u.policy.Issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	}
+	if purpose == purposeResetPassword {
+		claims.Password = passwordFingerprint(user.PassHash)
+	}
+
+	return claims, nil
+}
+
+func (u *Auth) signActionToken(claims actionClaims) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(u.actions.Secret)
+	if err != nil {
+		u.log.Error("failed to sign action token", slog.String("err", err.Error()))
+		return "", err
+	}
+
+	return token, nil
+}
+
+// useActionToken verifies the token for the purpose, resolves its user and
+// consumes it so that it can't be used again.
+func (u *Auth) useActionToken(ctx context.Context, tokenString, purpose string) (actionClaims, models.User, error) {
+	claims, user, err := u.verifyActionToken(ctx, tokenString, purpose)
+	if err != nil {
+		return actionClaims{}, models.User{}, err
+	}
+
+	if err := u.consumeActionToken(ctx, claims); err != nil {
+		return actionClaims{}, models.User{}, err
+	}
+
+	return claims, user, nil
+}
+
+// verifyActionToken verifies the token for the purpose and resolves its user
+// without consuming it.
+func (u *Auth) verifyActionToken(ctx context.Context, tokenString, purpose string) (actionClaims, models.User, error) {
+	var claims actionClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrInvalidActionToken
+		}
+		return u.actions.Secret, nil
+	})
+	if err != nil || !token.Valid || !claims.VerifyAudience(purpose, true) || claims.Id == "" {
+		return actionClaims{}, models.User{}, ErrInvalidActionToken
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return actionClaims{}, models.User{}, ErrInvalidActionToken
+	}
+
+	user, err := u.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return actionClaims{}, models.User{}, ErrInvalidActionToken
+		}
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return actionClaims{}, models.User{}, err
+	}
+
+	if user.Email != claims.Email {
+		return actionClaims{}, models.User{}, ErrInvalidActionToken
+	}
+	if purpose == purposeResetPassword &&
+		subtle.ConstantTimeCompare([]byte(claims.Password), []byte(passwordFingerprint(user.PassHash))) != 1 {
+		return actionClaims{}, models.User{}, ErrInvalidActionToken
+	}
+
+	return claims, user, nil
+}
+
+func (u *Auth) consumeActionToken(ctx context.Context, claims actionClaims) error {
+	if err := u.tokens.ConsumeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		if errors.Is(err, storage.ErrTokenReused) {
+			return ErrInvalidActionToken
+		}
+		u.log.Error("failed to consume action token", slog.String("err", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func passwordFingerprint(passHash []byte) string {
+	sum := sha256.Sum256(passHash)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// actionURL appends the token to the configured link as the "token" query parameter.
+func actionURL(base, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+	"auth/internal/storage/memory"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// resetStorage holds the one user whose password is reset, the other
+// UserStorage methods aren't used by the tests.
+type resetStorage struct {
+	UserStorage
+	user models.User
+}
+
+func (s *resetStorage) GetUserByID(_ context.Context, id int64) (models.User, error) {
+	if id != s.user.ID {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *resetStorage) UpdatePassword(_ context.Context, _ int64, passHash []byte) error {
+	s.user.PassHash = passHash
+	return nil
+}
+
+func (s *resetStorage) SetVerified(context.Context, int64) error {
+	s.user.Verified = true
+	return nil
+}
+
+// resetTokens records consumed token ids, the other TokenStorage methods
+// aren't used by the tests.
+type resetTokens struct {
+	TokenStorage
+	consumed map[string]bool
+}
+
+func (t *resetTokens) ConsumeToken(_ context.Context, jti string, _ time.Time) error {
+	if t.consumed[jti] {
+		return storage.ErrTokenReused
+	}
+	t.consumed[jti] = true
+	return nil
+}
+
+func (t *resetTokens) RevokeUserTokens(context.Context, int64) error {
+	return nil
+}
+
+func (t *resetTokens) RevokeUserAccess(context.Context, int64, time.Time, time.Time) error {
+	return nil
+}
+
+func TestResetPassword(t *testing.T) {
+	const breached = "password1234"
+
+	tests := []struct {
+		name      string
+		passwords []string
+		wantErrs  []error
+	}{
+		{
+			name:      "accepted password",
+			passwords: []string{"a long new password"},
+			wantErrs:  []error{nil},
+		},
+		{
+			name:      "too short password keeps the link",
+			passwords: []string{"short", "a long new password"},
+			wantErrs:  []error{ErrWeakPassword, nil},
+		},
+		{
+			name:      "breached password keeps the link",
+			passwords: []string{breached, "a long new password"},
+			wantErrs:  []error{ErrWeakPassword, nil},
+		},
+		{
+			name:      "used link",
+			passwords: []string{"a long new password", "another new password"},
+			wantErrs:  []error{nil, ErrInvalidActionToken},
+		},
+	}
+
+	passwords := NewPasswords(PasswordPolicy{
+		MinLength: 10,
+		Breached:  map[string]struct{}{sha1Hex(breached): {}},
+	}, BcryptHasher{Cost: bcrypt.MinCost})
+	oldHash, err := passwords.Hash("the old password")
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &resetStorage{user: models.User{ID: 1, Email: "a@example.com", PassHash: oldHash}}
+			u := &Auth{
+				log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				storage:   users,
+				tokens:    &resetTokens{consumed: make(map[string]bool)},
+				attempts:  memory.NewAttemptStore(),
+				actions:   ActionPolicy{Secret: []byte("secret")},
+				passwords: passwords,
+			}
+			token, err := u.actionToken(users.user, purposeResetPassword, time.Hour)
+			if err != nil {
+				t.Fatalf("actionToken() error = %v", err)
+			}
+
+			for i, password := range tt.passwords {
+				err := u.ResetPassword(context.Background(), token, password)
+				if !errors.Is(err, tt.wantErrs[i]) {
+					t.Errorf("ResetPassword(%q) error = %v, want %v", password, err, tt.wantErrs[i])
+				}
+			}
+		})
+	}
+}
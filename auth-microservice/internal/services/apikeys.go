@@ -0,0 +1,222 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrInvalidAPIKey is returned for unknown, malformed and expired API keys alike.
+	ErrInvalidAPIKey     = errors.New("invalid api key")
+	ErrInvalidAPIKeyName = errors.New("api key name must be 1 to 64 characters")
+	ErrInvalidScope      = errors.New("unknown api key scope")
+	ErrTooManyAPIKeys    = errors.New("api key limit reached")
+	ErrInvalidExpiration = errors.New("expiration must be in the future")
+)
+
+// apiKeyPrefix starts every API key so that leaked keys are easy to spot.
+const apiKeyPrefix = "usk_"
+
+// lastUsedResolution is how precisely the last use of API keys is tracked.
+const lastUsedResolution = time.Minute
+
+type APIKeyStorage interface {
+	SaveAPIKey(ctx context.Context, key models.APIKey) error
+	GetAPIKey(ctx context.Context, prefix string) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	CountAPIKeys(ctx context.Context, userID int64) (int64, error)
+	DeleteAPIKey(ctx context.Context, userID int64, prefix string) error
+	DeleteUserAPIKeys(ctx context.Context, userID int64) error
+	TouchAPIKey(ctx context.Context, prefix string, at, notBefore time.Time) error
+}
+
+// APIKeyPolicy configures personal API keys.
+type APIKeyPolicy struct {
+	MaxPerUser int64
+	// TokenTTL is the lifetime of the access tokens API keys are exchanged for.
+	TokenTTL time.Duration
+}
+
+// CreateAPIKey creates an API key of the caller limited to the scopes. It
+// returns the key, which is not stored and can't be shown again.
+func (u *Auth) CreateAPIKey(ctx context.Context, caller models.User, name string, scopes []string, expiresAt time.Time) (models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return models.APIKey{}, "", ErrInvalidAPIKeyName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	now := time.Now()
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		return models.APIKey{}, "", ErrInvalidExpiration
+	}
+
+	count, err := u.apiKeys.CountAPIKeys(ctx, caller.ID)
+	if err != nil {
+		u.log.Error("failed to count api keys", slog.String("err", err.Error()))
+		return models.APIKey{}, "", err
+	}
+	if count >= u.apiKeyPolicy.MaxPerUser {
+		return models.APIKey{}, "", ErrTooManyAPIKeys
+	}
+
+	prefix, secret, err := newAPIKey()
+	if err != nil {
+		u.log.Error("failed to generate api key", slog.String("err", err.Error()))
+		return models.APIKey{}, "", err
+	}
+	raw := apiKeyPrefix + prefix + "_" + secret
+
+	key := models.APIKey{
+		Prefix:    prefix,
+		Hash:      hashToken(raw),
+		UserID:    caller.ID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err := u.apiKeys.SaveAPIKey(ctx, key); err != nil {
+		u.log.Error("failed to save api key", slog.String("err", err.Error()))
+		return models.APIKey{}, "", err
+	}
+
+	u.audit(ctx, "api_key.created",
+		slog.Int64("user_id", caller.ID),
+		slog.String("key", prefix),
+		slog.Any("scopes", scopes),
+	)
+
+	return key, raw, nil
+}
+
+// ListAPIKeys returns the API keys of the caller, newest first.
+func (u *Auth) ListAPIKeys(ctx context.Context, caller models.User) ([]models.APIKey, error) {
+	keys, err := u.apiKeys.ListAPIKeys(ctx, caller.ID)
+	if err != nil {
+		u.log.Error("failed to list api keys", slog.String("err", err.Error()))
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey deletes an API key of the caller. Tokens it was already
+// exchanged for stay valid until they expire after APIKeyPolicy.TokenTTL.
+func (u *Auth) RevokeAPIKey(ctx context.Context, caller models.User, prefix string) error {
+	if err := u.apiKeys.DeleteAPIKey(ctx, caller.ID, prefix); err != nil {
+		if !errors.Is(err, storage.ErrAPIKeyNotFound) {
+			u.log.Error("failed to revoke api key", slog.String("err", err.Error()))
+		}
+		return err
+	}
+
+	u.audit(ctx, "api_key.revoked", slog.Int64("user_id", caller.ID), slog.String("key", prefix))
+
+	return nil
+}
+
+// AuthenticateAPIKey exchanges an API key for an access token of its owner
+// limited to the scopes of the key, and records the use of the key.
+func (u *Auth) AuthenticateAPIKey(ctx context.Context, raw string) (models.User, models.APIKey, models.TokenPair, error) {
+	prefix, ok := parseAPIKey(raw)
+	if !ok {
+		return models.User{}, models.APIKey{}, models.TokenPair{}, ErrInvalidAPIKey
+	}
+
+	key, err := u.apiKeys.GetAPIKey(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return models.User{}, models.APIKey{}, models.TokenPair{}, ErrInvalidAPIKey
+		}
+		u.log.Error("failed to get api key", slog.String("err", err.Error()))
+		return models.User{}, models.APIKey{}, models.TokenPair{}, err
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashToken(raw)), []byte(key.Hash)) != 1 || key.Expired(now) {
+		return models.User{}, models.APIKey{}, models.TokenPair{}, ErrInvalidAPIKey
+	}
+
+	user, err := u.storage.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, models.APIKey{}, models.TokenPair{}, ErrInvalidAPIKey
+		}
+		u.log.Error("failed to get api key owner", slog.String("err", err.Error()))
+		return models.User{}, models.APIKey{}, models.TokenPair{}, err
+	}
+	if user.Disabled {
+		return models.User{}, models.APIKey{}, models.TokenPair{}, ErrUserDisabled
+	}
+
+	token, err := u.generateJWT(user, u.apiKeyPolicy.TokenTTL, key.Scopes)
+	if err != nil {
+		return models.User{}, models.APIKey{}, models.TokenPair{}, err
+	}
+
+	if err := u.apiKeys.TouchAPIKey(ctx, prefix, now, now.Add(-lastUsedResolution)); err != nil {
+		// A missed last-used update must not fail the request.
+		u.log.Warn("failed to record api key use", slog.String("err", err.Error()))
+	}
+
+	return user, key, models.TokenPair{AccessToken: token, ExpiresIn: u.apiKeyPolicy.TokenTTL}, nil
+}
+
+// newAPIKey generates the public prefix and the secret part of a key.
+func newAPIKey() (prefix, secret string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret, err = randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(b), secret, nil
+}
+
+// parseAPIKey returns the prefix of a key of the form "usk_<prefix>_<secret>".
+func parseAPIKey(raw string) (prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(raw, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 12 || secret == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(prefix); err != nil {
+		return "", false
+	}
+	return prefix, true
+}
+
+// normalizeScopes checks the scopes and removes duplicates.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !models.ValidScope(scope) {
+			return nil, ErrInvalidScope
+		}
+		if !slices.Contains(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
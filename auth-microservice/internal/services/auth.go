@@ -2,35 +2,136 @@ package services
 
 import (
 	"auth/internal/domain/models"
+	"auth/internal/keys"
+	"auth/internal/mailer"
+	"auth/internal/storage"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
 	"log/slog"
+	"strconv"
 	"time"
 )
 
 type UserStorage interface {
 	SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error)
 	GetUser(ctx context.Context, email string) (models.User, error)
+	GetUserByID(ctx context.Context, id int64) (models.User, error)
+	SetVerified(ctx context.Context, id int64) error
+	UpdatePassword(ctx context.Context, id int64, passHash []byte) error
+	UpdateEmail(ctx context.Context, id int64, email string) error
+	DeleteUser(ctx context.Context, id int64) error
+	GetUserByExternalIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	SaveExternalUser(ctx context.Context, identity models.ExternalIdentity, passHash []byte) (int64, error)
+	LinkExternalIdentity(ctx context.Context, id int64, identity models.ExternalIdentity, passHash []byte) error
+	ListUsers(ctx context.Context, limit, offset int64) ([]models.User, int64, error)
+	UpdateUser(ctx context.Context, id int64, update models.UserUpdate) (models.User, error)
+	SetPendingTOTP(ctx context.Context, id int64, secret string) error
+	EnableTOTP(ctx context.Context, id int64, secret string, recoveryCodes []string) error
+	DisableTOTP(ctx context.Context, id int64) error
+	UseTOTPStep(ctx context.Context, id int64, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, id int64, hash string) (bool, error)
+}
+
+var (
+	// ErrInvalidToken is returned for tokens that fail verification.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenRevoked is returned for access tokens revoked by a logout.
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrInvalidCredentials is returned for unknown emails and wrong passwords alike.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// TokenPolicy configures the tokens issued on login.
+type TokenPolicy struct {
+	Issuer string
+	// AccessTTL is the lifetime of access tokens, keep it short: services
+	// verifying tokens locally see revocations only once they sync them.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
 }
 
 type Auth struct {
-	log     *slog.Logger
-	storage UserStorage
+	log          *slog.Logger
+	storage      UserStorage
+	tokens       TokenStorage
+	attempts     AttemptStore
+	keys         *keys.KeySet
+	policy       TokenPolicy
+	lockout      LockoutPolicy
+	mailer       mailer.Mailer
+	actions      ActionPolicy
+	passwords    *Passwords
+	apiKeys      APIKeyStorage
+	apiKeyPolicy APIKeyPolicy
+	totp         TOTPPolicy
+	// links removes the links of deleted accounts, nil leaves them in place.
+	links LinkCleaner
+	// identities is the external identity provider, nil without single sign-on.
+	identities IdentityProvider
+	oidc       OIDCPolicy
+	orgs       OrgStorage
+	orgPolicy  OrgPolicy
+	// dummyHash is compared against for unknown emails so that they take
+	// as long as wrong passwords.
+	dummyHash []byte
 }
 
 func New(log *slog.Logger,
 	storage UserStorage,
+	tokens TokenStorage,
+	attempts AttemptStore,
+	keys *keys.KeySet,
+	policy TokenPolicy,
+	lockout LockoutPolicy,
+	mailer mailer.Mailer,
+	actions ActionPolicy,
+	passwords *Passwords,
+	apiKeys APIKeyStorage,
+	apiKeyPolicy APIKeyPolicy,
+	totp TOTPPolicy,
+	links LinkCleaner,
+	identities IdentityProvider,
+	oidc OIDCPolicy,
+	orgs OrgStorage,
+	orgPolicy OrgPolicy,
 ) *Auth {
+	dummyHash, _ := passwords.Hash("dummy password")
+
 	return &Auth{
-		log:     log,
-		storage: storage,
+		log:          log,
+		storage:      storage,
+		tokens:       tokens,
+		attempts:     attempts,
+		keys:         keys,
+		policy:       policy,
+		lockout:      lockout,
+		mailer:       mailer,
+		actions:      actions,
+		passwords:    passwords,
+		apiKeys:      apiKeys,
+		apiKeyPolicy: apiKeyPolicy,
+		totp:         totp,
+		links:        links,
+		identities:   identities,
+		oidc:         oidc,
+		orgs:         orgs,
+		orgPolicy:    orgPolicy,
+		dummyHash:    dummyHash,
 	}
 }
 
 func (u *Auth) SaveUser(ctx context.Context, email string, pass string) (uid int64, err error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err := validateEmail(email); err != nil {
+		return 0, err
+	}
+
+	if err := u.passwords.Validate(pass); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := u.passwords.Hash(pass)
 	if err != nil {
 		u.log.Error("failed to hash password", slog.String("err", err.Error()))
 		return 0, err
@@ -43,6 +144,8 @@ func (u *Auth) SaveUser(ctx context.Context, email string, pass string) (uid int
 		return 0, err
 	}
 
+	u.sendVerification(models.User{ID: userID, Email: email})
+
 	return userID, nil
 }
 func (u *Auth) GetUser(ctx context.Context, email string) (models.User, error) {
@@ -55,28 +158,142 @@ func (u *Auth) GetUser(ctx context.Context, email string) (models.User, error) {
 	return user, nil
 }
 
+func (u *Auth) GetUserByID(ctx context.Context, id int64) (models.User, error) {
+	user, err := u.storage.GetUserByID(ctx, id)
+	if err != nil {
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// Login checks the credentials and starts a new session. Unknown emails and
+// wrong passwords fail alike with ErrInvalidCredentials, too many failures for
+// the account or the client IP fail with a *LockoutError. Users with
+// two-factor authentication get a *ChallengeError to continue with VerifyTOTP.
+func (u *Auth) Login(ctx context.Context, email, password, clientIP string) (models.TokenPair, error) {
+	locked, err := u.lockedFor(ctx, email, clientIP)
+	if err != nil {
+		u.log.Error("failed to check lockout", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+	if locked > 0 {
+		u.audit(ctx, "login.blocked", slog.String("email", email), slog.String("ip", clientIP))
+		return models.TokenPair{}, &LockoutError{RetryAfter: locked}
+	}
+
+	user, err := u.storage.GetUser(ctx, email)
+	found := err == nil
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	passHash := user.PassHash
+	if !found {
+		passHash = u.dummyHash
+	}
+	ok, rehash, err := u.passwords.Verify(passHash, password)
+	if err != nil {
+		u.log.Error("failed to verify password", slog.Int64("user_id", user.ID), slog.String("err", err.Error()))
+	}
+	if !ok || !found {
+		u.loginFailed(ctx, email, clientIP)
+		return models.TokenPair{}, ErrInvalidCredentials
+	}
+
+	if rehash {
+		u.rehash(ctx, user, password)
+	}
+
+	// Checked after the password so that they don't reveal the account.
+	if user.Disabled {
+		u.audit(ctx, "login.disabled", slog.Int64("user_id", user.ID))
+		return models.TokenPair{}, ErrUserDisabled
+	}
+	if u.actions.RequireVerified && !user.Verified {
+		return models.TokenPair{}, ErrEmailNotVerified
+	}
+	// Failures are only forgiven after the second factor, otherwise
+	// logging in again would reset the count of guessed codes.
+	if user.TOTPEnabled() {
+		return models.TokenPair{}, u.totpChallenge(user)
+	}
+
+	if err := u.attempts.Reset(ctx, accountKey(email)); err != nil {
+		u.log.Error("failed to reset login failures", slog.String("err", err.Error()))
+	}
+
+	return u.IssueTokens(ctx, user)
+}
+
+// rehash upgrades the stored hash to the preferred hasher and parameters.
+// Failing to is logged only, the login succeeds either way.
+func (u *Auth) rehash(ctx context.Context, user models.User, password string) {
+	passHash, err := u.passwords.Hash(password)
+	if err != nil {
+		u.log.Error("failed to rehash password", slog.String("err", err.Error()))
+		return
+	}
+	if err := u.storage.UpdatePassword(ctx, user.ID, passHash); err != nil {
+		u.log.Error("failed to store rehashed password", slog.String("err", err.Error()))
+		return
+	}
+	u.log.Info("password hash upgraded", slog.Int64("user_id", user.ID))
+}
+
 type Claims struct {
-	Email  string `json:"email"`
-	UserID int64  `json:"userId"`
+	Email       string   `json:"email"`
+	UserID      int64    `json:"userId"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions,omitempty"`
+	// Scopes limit tokens minted for API keys, see AuthenticateAPIKey.
+	Scopes []string `json:"scopes,omitempty"`
+	// Orgs maps the IDs of the organizations of the user to their role.
+	Orgs map[string]string `json:"orgs,omitempty"`
 	jwt.StandardClaims
 }
 
-var jwtSecret = []byte("wzqGcrxSmzR1P9iKuHI1RvO9X_Zl4Vtz1JT-LAjHCaY=")
-
 func (u *Auth) GenerateJWT(user models.User) (string, error) {
+	return u.generateJWT(user, u.policy.AccessTTL, nil)
+}
+
+// generateJWT signs an access token of the user valid for ttl. Tokens with
+// scopes are limited to them and carry neither role nor permissions, the
+// organization roles still apply to links the scopes allow to touch.
+func (u *Auth) generateJWT(user models.User, ttl time.Duration, scopes []string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		u.log.Error("failed to generate token id", slog.String("err", err.Error()))
+		return "", err
+	}
+
 	// Create the JWT claims, which includes the user information and expiry time
-	expirationTime := time.Now().Add(24 * time.Hour)
+	now := time.Now()
 	claims := &Claims{
 		Email:  user.Email,
 		UserID: user.ID,
+		Scopes: scopes,
+		Orgs:   orgRoles(user.Orgs),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        jti,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Issuer:    u.policy.Issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
 		},
 	}
+	if len(scopes) == 0 {
+		claims.Role = user.Role
+		claims.Permissions = user.EffectivePermissions()
+	}
 
-	// Create the JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	// Create the JWT token signed with the active key
+	key := u.keys.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
 		u.log.Error("failed to generate JWT", slog.String("err", err.Error()))
 		return "", err
@@ -84,26 +301,97 @@ func (u *Auth) GenerateJWT(user models.User) (string, error) {
 
 	return tokenString, nil
 }
-func (u *Auth) ValidateJWT(tokenString string) (models.User, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+
+// ValidateJWT resolves the user of an access token. Tokens minted for API
+// keys are rejected, they only authorize the downstream calls of a gateway
+// request.
+func (u *Auth) ValidateJWT(ctx context.Context, tokenString string) (models.User, error) {
+	claims, err := u.parseJWT(tokenString)
 	if err != nil {
-		u.log.Error("failed to parse JWT", slog.String("err", err.Error()))
 		return models.User{}, err
 	}
-	if !token.Valid {
-		u.log.Error("invalid JWT token")
-		return models.User{}, errors.New("invalid token")
+	if len(claims.Scopes) > 0 {
+		return models.User{}, ErrInvalidToken
+	}
+
+	return u.claimsUser(ctx, claims)
+}
+
+// TokenUser resolves the user of an access token like ValidateJWT, tokens
+// minted with scopes included. It lets services that verify tokens locally
+// look up the current state of the user, e.g. org roles changed after the
+// token was issued.
+func (u *Auth) TokenUser(ctx context.Context, tokenString string) (models.User, error) {
+	claims, err := u.parseJWT(tokenString)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return u.claimsUser(ctx, claims)
+}
+
+// claimsUser loads the user of the verified claims, unless the token was
+// revoked or the user is disabled or deleted. Rejected tokens fail with
+// ErrInvalidToken, ErrTokenRevoked or ErrUserDisabled, any other error is a
+// failure of the lookups.
+func (u *Auth) claimsUser(ctx context.Context, claims *Claims) (models.User, error) {
+	revoked, err := u.tokens.IsAccessTokenRevoked(ctx, claims.Id, claims.UserID, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		u.log.Error("failed to check token revocation", slog.String("err", err.Error()))
+		return models.User{}, err
+	}
+	if revoked {
+		return models.User{}, ErrTokenRevoked
+	}
+
+	// Tokens issued before user IDs were persisted carry userId 0 and can't
+	// be resolved to a single account.
+	if claims.UserID == 0 {
+		u.log.Error("JWT without user id")
+		return models.User{}, ErrInvalidToken
 	}
 
 	// Get the user from the claims
-	user, err := u.GetUser(context.Background(), claims.Email)
+	user, err := u.GetUserByID(ctx, claims.UserID)
 	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, ErrInvalidToken
+		}
 		u.log.Error("failed to get user from claims", slog.String("err", err.Error()))
 		return models.User{}, err
 	}
+	if user.Disabled {
+		return models.User{}, ErrUserDisabled
+	}
 
 	return user, nil
 }
+
+// parseJWT verifies the signature, expiry and issuer of the token.
+func (u *Auth) parseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, u.verificationKey)
+	if err != nil {
+		u.log.Error("failed to parse JWT", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !token.Valid || !claims.VerifyIssuer(u.policy.Issuer, true) || claims.Id == "" {
+		u.log.Error("invalid JWT token")
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// verificationKey resolves the public key of the token's "kid" header and
+// makes sure the token is signed with the algorithm of that key.
+func (u *Auth) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := u.keys.Verification(kid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.Public(), nil
+}
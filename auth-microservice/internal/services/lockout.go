@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// AttemptStore counts failed logins and keeps temporary lockouts.
+type AttemptStore interface {
+	Increment(ctx context.Context, key string, window time.Duration) (int64, error)
+	Reset(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, d time.Duration) error
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+}
+
+// LockoutError is returned while an account or client is locked out.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// ErrLockedOut matches any *LockoutError with errors.Is.
+var ErrLockedOut = errors.New("locked out")
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrLockedOut
+}
+
+// LockoutPolicy configures brute-force protection. Once MaxFailures failed
+// attempts for an account (or MaxIPFailures for a client IP) happen within
+// Window, the key is locked for BaseLockout, doubling with every further
+// failure up to MaxLockout.
+type LockoutPolicy struct {
+	MaxFailures   int64
+	MaxIPFailures int64
+	Window        time.Duration
+	BaseLockout   time.Duration
+	MaxLockout    time.Duration
+}
+
+func (p LockoutPolicy) lockout(failures, max int64) time.Duration {
+	if max <= 0 || failures < max {
+		return 0
+	}
+	d := p.BaseLockout
+	for i := max; i < failures && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxLockout)
+}
+
+func accountKey(email string) string { return "account:" + strings.ToLower(email) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// lockedFor returns the longest lockout of the account and the client.
+func (u *Auth) lockedFor(ctx context.Context, email, clientIP string) (time.Duration, error) {
+	locked, err := u.attempts.LockedFor(ctx, accountKey(email))
+	if err != nil || clientIP == "" {
+		return locked, err
+	}
+	ipLocked, err := u.attempts.LockedFor(ctx, ipKey(clientIP))
+	return max(locked, ipLocked), err
+}
+
+// loginFailed counts the failed attempt and locks the account or the client
+// once it has failed too often.
+func (u *Auth) loginFailed(ctx context.Context, email, clientIP string) {
+	u.audit(ctx, "login.failed", slog.String("email", email), slog.String("ip", clientIP))
+
+	u.countFailure(ctx, accountKey(email), u.lockout.MaxFailures,
+		slog.String("email", email), slog.String("ip", clientIP))
+	if clientIP != "" {
+		u.countFailure(ctx, ipKey(clientIP), u.lockout.MaxIPFailures,
+			slog.String("ip", clientIP))
+	}
+}
+
+func (u *Auth) countFailure(ctx context.Context, key string, maxFailures int64, attrs ...slog.Attr) {
+	failures, err := u.attempts.Increment(ctx, key, u.lockout.Window)
+	if err != nil {
+		u.log.Error("failed to count login failure", slog.String("err", err.Error()))
+		return
+	}
+
+	d := u.lockout.lockout(failures, maxFailures)
+	if d == 0 {
+		return
+	}
+	if err := u.attempts.Lock(ctx, key, d); err != nil {
+		u.log.Error("failed to lock out", slog.String("err", err.Error()))
+		return
+	}
+
+	u.audit(ctx, "login.lockout", append(attrs,
+		slog.String("key", key),
+		slog.Int64("failures", failures),
+		slog.Duration("duration", d),
+	)...)
+}
+
+// audit logs a security relevant event.
+func (u *Auth) audit(ctx context.Context, event string, attrs ...slog.Attr) {
+	u.log.LogAttrs(ctx, slog.LevelWarn, "audit", append([]slog.Attr{slog.String("event", event)}, attrs...)...)
+}
+
+// FallbackAttemptStore uses the primary store and switches to the fallback
+// for the calls the primary fails, so an unreachable Redis degrades the
+// protection to per instance instead of disabling logins.
+type FallbackAttemptStore struct {
+	log      *slog.Logger
+	primary  AttemptStore
+	fallback AttemptStore
+}
+
+func NewFallbackAttemptStore(log *slog.Logger, primary, fallback AttemptStore) *FallbackAttemptStore {
+	return &FallbackAttemptStore{log: log, primary: primary, fallback: fallback}
+}
+
+func (s *FallbackAttemptStore) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	n, err := s.primary.Increment(ctx, key, window)
+	if err != nil {
+		s.failed(err)
+		return s.fallback.Increment(ctx, key, window)
+	}
+	return n, nil
+}
+
+func (s *FallbackAttemptStore) Reset(ctx context.Context, key string) error {
+	// Both stores may hold failures of the key.
+	_ = s.fallback.Reset(ctx, key)
+	if err := s.primary.Reset(ctx, key); err != nil {
+		s.failed(err)
+	}
+	return nil
+}
+
+func (s *FallbackAttemptStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	if err := s.primary.Lock(ctx, key, d); err != nil {
+		s.failed(err)
+		return s.fallback.Lock(ctx, key, d)
+	}
+	return nil
+}
+
+func (s *FallbackAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	fallback, _ := s.fallback.LockedFor(ctx, key)
+	primary, err := s.primary.LockedFor(ctx, key)
+	if err != nil {
+		s.failed(err)
+	}
+	return max(primary, fallback), nil
+}
+
+func (s *FallbackAttemptStore) failed(err error) {
+	s.log.Warn("attempt store unavailable, using in-memory fallback", slog.String("err", err.Error()))
+}
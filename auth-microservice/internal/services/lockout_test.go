@@ -0,0 +1,129 @@
+package services
+
+import (
+	"auth/internal/storage/memory"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type attempt struct {
+	email, ip string
+}
+
+func TestLockout(t *testing.T) {
+	policy := LockoutPolicy{
+		MaxFailures:   3,
+		MaxIPFailures: 5,
+		Window:        time.Minute,
+		BaseLockout:   time.Minute,
+		MaxLockout:    4 * time.Minute,
+	}
+
+	tests := []struct {
+		name     string
+		failures []attempt
+		login    attempt
+		want     time.Duration
+	}{
+		{
+			name:  "no failures",
+			login: attempt{"a@example.com", "198.51.100.1"},
+		},
+		{
+			name:     "below the account limit",
+			failures: repeat(attempt{"a@example.com", "198.51.100.1"}, 2),
+			login:    attempt{"a@example.com", "198.51.100.1"},
+		},
+		{
+			name:     "account limit reached",
+			failures: repeat(attempt{"a@example.com", "198.51.100.1"}, 3),
+			login:    attempt{"a@example.com", "198.51.100.1"},
+			want:     time.Minute,
+		},
+		{
+			name:     "lockout doubles",
+			failures: repeat(attempt{"a@example.com", ""}, 4),
+			login:    attempt{"a@example.com", ""},
+			want:     2 * time.Minute,
+		},
+		{
+			name:     "lockout capped",
+			failures: repeat(attempt{"a@example.com", ""}, 10),
+			login:    attempt{"a@example.com", ""},
+			want:     4 * time.Minute,
+		},
+		{
+			name: "emails are case insensitive",
+			failures: []attempt{
+				{"A@example.com", ""},
+				{"a@EXAMPLE.com", ""},
+				{"a@example.com", ""},
+			},
+			login: attempt{"a@example.com", ""},
+			want:  time.Minute,
+		},
+		{
+			name:     "account locked from another client",
+			failures: repeat(attempt{"a@example.com", "198.51.100.1"}, 3),
+			login:    attempt{"a@example.com", "203.0.113.7"},
+			want:     time.Minute,
+		},
+		{
+			name: "client locked for other accounts",
+			failures: []attempt{
+				{"a@example.com", "198.51.100.1"},
+				{"b@example.com", "198.51.100.1"},
+				{"c@example.com", "198.51.100.1"},
+				{"d@example.com", "198.51.100.1"},
+				{"e@example.com", "198.51.100.1"},
+			},
+			login: attempt{"f@example.com", "198.51.100.1"},
+			want:  time.Minute,
+		},
+		{
+			name: "failures without client ip",
+			failures: []attempt{
+				{"a@example.com", ""},
+				{"b@example.com", ""},
+				{"c@example.com", ""},
+				{"d@example.com", ""},
+				{"e@example.com", ""},
+			},
+			login: attempt{"f@example.com", "198.51.100.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &Auth{
+				log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+				attempts: memory.NewAttemptStore(),
+				lockout:  policy,
+			}
+			ctx := context.Background()
+
+			for _, f := range tt.failures {
+				u.loginFailed(ctx, f.email, f.ip)
+			}
+
+			got, err := u.lockedFor(ctx, tt.login.email, tt.login.ip)
+			if err != nil {
+				t.Fatalf("lockedFor() error = %v", err)
+			}
+			if got > tt.want || got < tt.want-time.Second {
+				t.Errorf("lockedFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func repeat(a attempt, n int) []attempt {
+	attempts := make([]attempt, n)
+	for i := range attempts {
+		attempts[i] = a
+	}
+	return attempts
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrOIDCDisabled = errors.New("single sign-on is not configured")
+	// ErrInvalidOIDCLogin is returned for callbacks that don't belong to a
+	// started login and for codes the provider doesn't accept.
+	ErrInvalidOIDCLogin     = errors.New("invalid or expired single sign-on login")
+	ErrOIDCEmailNotVerified = errors.New("the identity provider has not verified the email")
+	// ErrOIDCAccountLinked is returned when the email belongs to an account
+	// linked to another identity of the provider.
+	ErrOIDCAccountLinked = errors.New("account is linked to another identity")
+	ErrOIDCNotRegistered = errors.New("no account for this identity")
+)
+
+const purposeOIDCLogin = "oidc-login"
+
+// IdentityProvider is an external OpenID Connect provider.
+type IdentityProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Exchange(ctx context.Context, code, verifier, nonce string) (models.ExternalIdentity, error)
+}
+
+// OIDCPolicy configures login with the external identity provider.
+type OIDCPolicy struct {
+	StateTTL     time.Duration
+	AutoRegister bool
+}
+
+// oidcSessionClaims tie the callback of the provider to the client that
+// started the login. The client keeps them as an opaque token.
+type oidcSessionClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+// StartOIDCLogin returns the URL of the provider's login page and the session
+// token the client presents together with the callback parameters.
+func (u *Auth) StartOIDCLogin(ctx context.Context) (authURL, session string, expiresIn time.Duration, err error) {
+	if u.identities == nil {
+		return "", "", 0, ErrOIDCDisabled
+	}
+
+	jti, err := randomToken(16)
+	if err != nil {
+		u.log.Error("failed to generate token id", slog.String("err", err.Error()))
+		return "", "", 0, err
+	}
+	state, err := randomToken(16)
+	if err != nil {
+		u.log.Error("failed to generate state", slog.String("err", err.Error()))
+		return "", "", 0, err
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		u.log.Error("failed to generate nonce", slog.String("err", err.Error()))
+		return "", "", 0, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err = u.identities.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		u.log.Error("failed to build authorization url", slog.String("err", err.Error()))
+		return "", "", 0, err
+	}
+
+	now := time.Now()
+	claims := oidcSessionClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Audience:  purposeOIDCLogin,
+			Issuer:    u.policy.Issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(u.oidc.StateTTL).Unix(),
+		},
+	}
+	session, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(u.actions.Secret)
+	if err != nil {
+		u.log.Error("failed to sign oidc session", slog.String("err", err.Error()))
+		return "", "", 0, err
+	}
+
+	return authURL, session, u.oidc.StateTTL, nil
+}
+
+// FinishOIDCLogin completes a login started with StartOIDCLogin. The user is
+// found by the provider identity, then linked by the verified email or
+// registered. Like Login it returns a *ChallengeError for users with
+// two-factor authentication.
+func (u *Auth) FinishOIDCLogin(ctx context.Context, session, state, code, clientIP string) (models.TokenPair, error) {
+	if u.identities == nil {
+		return models.TokenPair{}, ErrOIDCDisabled
+	}
+
+	var claims oidcSessionClaims
+	token, err := jwt.ParseWithClaims(session, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrInvalidOIDCLogin
+		}
+		return u.actions.Secret, nil
+	})
+	if err != nil || !token.Valid || !claims.VerifyAudience(purposeOIDCLogin, true) || claims.Id == "" ||
+		subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return models.TokenPair{}, ErrInvalidOIDCLogin
+	}
+
+	err = u.tokens.ConsumeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenReused) {
+			return models.TokenPair{}, ErrInvalidOIDCLogin
+		}
+		u.log.Error("failed to consume oidc session", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	identity, err := u.identities.Exchange(ctx, code, claims.Verifier, claims.Nonce)
+	if err != nil {
+		u.log.Warn("oidc login failed", slog.String("ip", clientIP), slog.String("err", err.Error()))
+		return models.TokenPair{}, ErrInvalidOIDCLogin
+	}
+
+	user, err := u.externalUser(ctx, identity)
+	if err != nil {
+		u.audit(ctx, "login.oidc_rejected",
+			slog.String("subject", identity.Subject),
+			slog.String("email", identity.Email),
+			slog.String("reason", err.Error()),
+		)
+		return models.TokenPair{}, err
+	}
+
+	if user.Disabled {
+		u.audit(ctx, "login.disabled", slog.Int64("user_id", user.ID))
+		return models.TokenPair{}, ErrUserDisabled
+	}
+	if user.TOTPEnabled() {
+		return models.TokenPair{}, u.totpChallenge(user)
+	}
+
+	u.audit(ctx, "login.oidc", slog.Int64("user_id", user.ID), slog.String("ip", clientIP))
+
+	return u.IssueTokens(ctx, user)
+}
+
+// externalUser returns the user of the identity. A user with the verified
+// email of the identity is linked to it. If that user never verified the
+// email, whoever registered it may not own the mailbox, so the password is
+// replaced and everything else they could sign in with is revoked.
+func (u *Auth) externalUser(ctx context.Context, identity models.ExternalIdentity) (models.User, error) {
+	user, err := u.storage.GetUserByExternalIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return models.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, ErrOIDCEmailNotVerified
+	}
+
+	user, err = u.storage.GetUser(ctx, identity.Email)
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		return u.registerExternalUser(ctx, identity)
+	case err != nil:
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return models.User{}, err
+	case user.OIDCSubject != "":
+		return models.User{}, ErrOIDCAccountLinked
+	}
+
+	var passHash []byte
+	if !user.Verified {
+		if passHash, err = u.randomPasswordHash(); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	if err := u.storage.LinkExternalIdentity(ctx, user.ID, identity, passHash); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrUserExists) {
+			return models.User{}, ErrOIDCAccountLinked
+		}
+		u.log.Error("failed to link identity", slog.String("err", err.Error()))
+		return models.User{}, err
+	}
+	if passHash != nil {
+		if err := u.revokeCredentials(ctx, user); err != nil {
+			return models.User{}, err
+		}
+		user.TOTPSecret = ""
+	}
+
+	u.audit(ctx, "oidc.linked",
+		slog.Int64("user_id", user.ID),
+		slog.String("subject", identity.Subject),
+		slog.Bool("password_reset", passHash != nil),
+	)
+
+	user.OIDCIssuer, user.OIDCSubject, user.Verified = identity.Issuer, identity.Subject, true
+	return user, nil
+}
+
+// revokeCredentials ends the sessions of the user and removes their API keys
+// and second factor.
+func (u *Auth) revokeCredentials(ctx context.Context, user models.User) error {
+	if err := u.revokeSessions(ctx, user.ID); err != nil {
+		u.log.Error("failed to revoke sessions", slog.String("err", err.Error()))
+		return err
+	}
+	if err := u.apiKeys.DeleteUserAPIKeys(ctx, user.ID); err != nil {
+		u.log.Error("failed to delete api keys", slog.String("err", err.Error()))
+		return err
+	}
+	if user.TOTPEnabled() || user.TOTPPendingSecret != "" {
+		if err := u.storage.DisableTOTP(ctx, user.ID); err != nil {
+			u.log.Error("failed to disable totp", slog.String("err", err.Error()))
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Auth) registerExternalUser(ctx context.Context, identity models.ExternalIdentity) (models.User, error) {
+	if !u.oidc.AutoRegister {
+		return models.User{}, ErrOIDCNotRegistered
+	}
+
+	passHash, err := u.randomPasswordHash()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	id, err := u.storage.SaveExternalUser(ctx, identity, passHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			// Registered concurrently, by the same login or with the email.
+			return models.User{}, ErrInvalidOIDCLogin
+		}
+		u.log.Error("failed to save user", slog.String("err", err.Error()))
+		return models.User{}, err
+	}
+
+	u.audit(ctx, "oidc.registered", slog.Int64("user_id", id), slog.String("subject", identity.Subject))
+
+	return u.storage.GetUserByID(ctx, id)
+}
+
+// randomPasswordHash hashes a random password no one knows. Users of the
+// provider can set a password of their own with a password reset.
+func (u *Auth) randomPasswordHash() ([]byte, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		u.log.Error("failed to generate password", slog.String("err", err.Error()))
+		return nil, err
+	}
+
+	passHash, err := u.passwords.Hash(password)
+	if err != nil {
+		u.log.Error("failed to hash password", slog.String("err", err.Error()))
+		return nil, err
+	}
+	return passHash, nil
+}
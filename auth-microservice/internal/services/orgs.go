@@ -0,0 +1,430 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/mailer"
+	"auth/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidOrgName  = errors.New("organization name must be 1 to 64 characters")
+	ErrInvalidOrgRole  = errors.New("invalid organization role")
+	ErrNotOrgMember    = errors.New("not a member of the organization")
+	ErrInvalidInvite   = errors.New("invalid or expired invitation")
+	ErrInviteForOthers = errors.New("invitation is for another email")
+	// ErrLastOwner is returned when the only owner of an organization with
+	// other members would leave it or lose the role.
+	ErrLastOwner = errors.New("organization needs another owner first")
+	// ErrLinkTransferFailed is returned when the links of a leaving member
+	// couldn't be handed over, the member is kept so that it can be retried.
+	ErrLinkTransferFailed = errors.New("failed to transfer the links of the member")
+)
+
+// scopeLinkTransfer limits the token presented to the URL shortener service
+// when handing over the links of a leaving member.
+const scopeLinkTransfer = "links:transfer"
+
+type OrgStorage interface {
+	SaveOrg(ctx context.Context, org models.Organization) (int64, error)
+	GetOrg(ctx context.Context, id int64) (models.Organization, error)
+	GetOrgs(ctx context.Context, ids []int64) ([]models.Organization, error)
+	DeleteOrg(ctx context.Context, id int64) error
+	AddMember(ctx context.Context, orgID, userID int64, role string, joinedAt time.Time) error
+	ListMembers(ctx context.Context, orgID int64) ([]models.Member, error)
+	SetMemberRole(ctx context.Context, orgID, userID int64, role string) error
+	RemoveMember(ctx context.Context, orgID, userID int64) error
+	SaveInvitation(ctx context.Context, inv models.Invitation) error
+	TakeInvitation(ctx context.Context, hash string) (models.Invitation, error)
+}
+
+// OrgPolicy configures organizations. The invitation token is appended to
+// InviteURL as the "token" query parameter.
+type OrgPolicy struct {
+	InviteTTL time.Duration
+	InviteURL string
+}
+
+// CreateOrg creates an organization with the caller as its owner.
+func (u *Auth) CreateOrg(ctx context.Context, caller models.User, name string) (models.Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return models.Organization{}, ErrInvalidOrgName
+	}
+
+	org := models.Organization{Name: name, CreatedBy: caller.ID, CreatedAt: time.Now()}
+	id, err := u.orgs.SaveOrg(ctx, org)
+	if err != nil {
+		u.log.Error("failed to save organization", slog.String("err", err.Error()))
+		return models.Organization{}, err
+	}
+	org.ID = id
+
+	if err := u.orgs.AddMember(ctx, id, caller.ID, models.OrgRoleOwner, org.CreatedAt); err != nil {
+		u.log.Error("failed to add organization owner", slog.String("err", err.Error()))
+		if err := u.orgs.DeleteOrg(ctx, id); err != nil {
+			u.log.Error("failed to delete organization without owner", slog.Int64("org_id", id), slog.String("err", err.Error()))
+		}
+		return models.Organization{}, err
+	}
+
+	u.audit(ctx, "org.created", slog.Int64("org_id", id), slog.Int64("user_id", caller.ID))
+
+	return org, nil
+}
+
+// ListOrgs returns the organizations of the caller ordered by ID.
+func (u *Auth) ListOrgs(ctx context.Context, caller models.User) ([]models.Organization, error) {
+	ids := make([]int64, 0, len(caller.Orgs))
+	for _, m := range caller.Orgs {
+		ids = append(ids, m.OrgID)
+	}
+
+	orgs, err := u.orgs.GetOrgs(ctx, ids)
+	if err != nil {
+		u.log.Error("failed to get organizations", slog.String("err", err.Error()))
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// ListMembers returns the members of an organization of the caller.
+func (u *Auth) ListMembers(ctx context.Context, caller models.User, orgID int64) ([]models.Member, error) {
+	if caller.OrgRole(orgID) == "" {
+		return nil, ErrNotOrgMember
+	}
+
+	members, err := u.orgs.ListMembers(ctx, orgID)
+	if err != nil {
+		u.log.Error("failed to list members", slog.String("err", err.Error()))
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// InviteMember mails an invitation to join the organization with the role.
+// It returns the time the invitation expires.
+func (u *Auth) InviteMember(ctx context.Context, caller models.User, orgID int64, email, role string) (time.Time, error) {
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+	if !models.ValidOrgRole(role) {
+		return time.Time{}, ErrInvalidOrgRole
+	}
+	if err := validateEmail(email); err != nil {
+		return time.Time{}, err
+	}
+	if !canGrant(caller.OrgRole(orgID), "", role) {
+		return time.Time{}, orgDenied(caller, orgID)
+	}
+
+	org, err := u.orgs.GetOrg(ctx, orgID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrOrgNotFound) {
+			u.log.Error("failed to get organization", slog.String("err", err.Error()))
+		}
+		return time.Time{}, err
+	}
+
+	invitee, err := u.storage.GetUser(ctx, email)
+	switch {
+	case err == nil && invitee.OrgRole(orgID) != "":
+		return time.Time{}, storage.ErrMemberExists
+	case err != nil && !errors.Is(err, storage.ErrUserNotFound):
+		u.log.Error("failed to get user", slog.String("err", err.Error()))
+		return time.Time{}, err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		u.log.Error("failed to generate invitation", slog.String("err", err.Error()))
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	inv := models.Invitation{
+		Hash:      hashToken(token),
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: caller.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.orgPolicy.InviteTTL),
+	}
+	if err := u.orgs.SaveInvitation(ctx, inv); err != nil {
+		u.log.Error("failed to save invitation", slog.String("err", err.Error()))
+		return time.Time{}, err
+	}
+
+	u.audit(ctx, "org.member_invited",
+		slog.Int64("org_id", orgID),
+		slog.Int64("user_id", caller.ID),
+		slog.String("email", email),
+		slog.String("role", role),
+	)
+	u.sendMail(mailer.Message{
+		To:      email,
+		Subject: fmt.Sprintf("You're invited to join %s", org.Name),
+		Body: fmt.Sprintf("%s invited you to join the organization %s as %s.\n\n"+
+			"Sign in with this email and open the link below within %s to accept:\n\n%s\n",
+			caller.Email, org.Name, role, u.orgPolicy.InviteTTL, actionURL(u.orgPolicy.InviteURL, token)),
+	})
+
+	return inv.ExpiresAt, nil
+}
+
+// AcceptInvitation adds the caller to the organization of the invitation and
+// returns it. Invitations work once and only for the invited email, a token
+// presented by someone else is used up all the same.
+func (u *Auth) AcceptInvitation(ctx context.Context, caller models.User, token string) (models.Organization, string, error) {
+	inv, err := u.orgs.TakeInvitation(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return models.Organization{}, "", ErrInvalidInvite
+		}
+		u.log.Error("failed to get invitation", slog.String("err", err.Error()))
+		return models.Organization{}, "", err
+	}
+	if !time.Now().Before(inv.ExpiresAt) {
+		return models.Organization{}, "", ErrInvalidInvite
+	}
+	if !strings.EqualFold(inv.Email, caller.Email) {
+		u.audit(ctx, "org.invitation_mismatch", slog.Int64("org_id", inv.OrgID), slog.Int64("user_id", caller.ID))
+		return models.Organization{}, "", ErrInviteForOthers
+	}
+	if !caller.Verified {
+		return models.Organization{}, "", ErrEmailNotVerified
+	}
+
+	org, err := u.orgs.GetOrg(ctx, inv.OrgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgNotFound) {
+			return models.Organization{}, "", ErrInvalidInvite
+		}
+		u.log.Error("failed to get organization", slog.String("err", err.Error()))
+		return models.Organization{}, "", err
+	}
+
+	if err := u.orgs.AddMember(ctx, inv.OrgID, caller.ID, inv.Role, time.Now()); err != nil {
+		if !errors.Is(err, storage.ErrMemberExists) {
+			u.log.Error("failed to add member", slog.String("err", err.Error()))
+		}
+		return models.Organization{}, "", err
+	}
+
+	u.audit(ctx, "org.member_joined",
+		slog.Int64("org_id", inv.OrgID),
+		slog.Int64("user_id", caller.ID),
+		slog.String("role", inv.Role),
+		slog.Int64("invited_by", inv.InvitedBy),
+	)
+
+	return org, inv.Role, nil
+}
+
+// UpdateMember changes the role of a member of the organization. Admins
+// manage members and admins, owners manage everyone.
+func (u *Auth) UpdateMember(ctx context.Context, caller models.User, orgID, userID int64, role string) (models.Member, error) {
+	if !models.ValidOrgRole(role) {
+		return models.Member{}, ErrInvalidOrgRole
+	}
+
+	members, err := u.ListMembers(ctx, caller, orgID)
+	if err != nil {
+		return models.Member{}, err
+	}
+	member, ok := findMember(members, userID)
+	if !ok {
+		return models.Member{}, storage.ErrMemberNotFound
+	}
+	if !canGrant(caller.OrgRole(orgID), member.Role, role) {
+		return models.Member{}, ErrPermissionDenied
+	}
+	if member.Role == models.OrgRoleOwner && role != models.OrgRoleOwner && successor(members, userID) == 0 {
+		return models.Member{}, ErrLastOwner
+	}
+
+	if err := u.orgs.SetMemberRole(ctx, orgID, userID, role); err != nil {
+		if !errors.Is(err, storage.ErrMemberNotFound) {
+			u.log.Error("failed to change member role", slog.String("err", err.Error()))
+		}
+		return models.Member{}, err
+	}
+
+	u.audit(ctx, "org.member_role_changed",
+		slog.Int64("org_id", orgID),
+		slog.Int64("user_id", userID),
+		slog.String("old_role", member.Role),
+		slog.String("role", role),
+		slog.Int64("by", caller.ID),
+	)
+
+	member.Role = role
+	return member, nil
+}
+
+// RemoveMember removes a member from the organization, callers may always
+// remove themselves. The links the member created in the organization are
+// handed over to the caller, or to an owner when the caller leaves. It
+// returns the number of links handed over.
+func (u *Auth) RemoveMember(ctx context.Context, caller models.User, orgID, userID int64) (int64, error) {
+	members, err := u.ListMembers(ctx, caller, orgID)
+	if err != nil {
+		return 0, err
+	}
+	member, ok := findMember(members, userID)
+	if !ok {
+		return 0, storage.ErrMemberNotFound
+	}
+
+	heir := caller.ID
+	if userID == caller.ID {
+		heir = successor(members, userID)
+		if heir == 0 {
+			return 0, ErrLastOwner
+		}
+	} else if !canGrant(caller.OrgRole(orgID), member.Role, "") {
+		return 0, ErrPermissionDenied
+	}
+
+	return u.removeMember(ctx, caller, orgID, userID, heir)
+}
+
+// removeMember hands the links of the member over to heir on behalf of the
+// caller, then removes the member.
+func (u *Auth) removeMember(ctx context.Context, caller models.User, orgID, userID, heir int64) (int64, error) {
+	var transferred int64
+	if u.links != nil {
+		token, err := u.generateJWT(caller, linkCleanupTokenTTL, []string{scopeLinkTransfer})
+		if err != nil {
+			return 0, err
+		}
+		transferred, err = u.links.TransferOrgLinks(ctx, caller.ID, token, orgID, caller.OrgRole(orgID), userID, heir)
+		if err != nil {
+			u.log.Error("failed to transfer links of leaving member",
+				slog.Int64("org_id", orgID), slog.Int64("user_id", userID), slog.String("err", err.Error()))
+			return 0, ErrLinkTransferFailed
+		}
+	} else {
+		u.log.Warn("no url shortener configured, links of leaving member are kept",
+			slog.Int64("org_id", orgID), slog.Int64("user_id", userID))
+	}
+
+	if err := u.orgs.RemoveMember(ctx, orgID, userID); err != nil {
+		if !errors.Is(err, storage.ErrMemberNotFound) {
+			u.log.Error("failed to remove member", slog.String("err", err.Error()))
+		}
+		return 0, err
+	}
+
+	u.audit(ctx, "org.member_removed",
+		slog.Int64("org_id", orgID),
+		slog.Int64("user_id", userID),
+		slog.Int64("by", caller.ID),
+		slog.Int64("heir", heir),
+		slog.Int64("links", transferred),
+	)
+
+	return transferred, nil
+}
+
+// leaveOrgs removes the user from all their organizations before the account
+// is deleted, handing their links over to an owner. Organizations the user is
+// the only member of are returned to be deleted together with the account,
+// their links go with the links of the user. Nothing changes when the user is
+// the last owner of an organization with other members.
+func (u *Auth) leaveOrgs(ctx context.Context, user models.User) ([]int64, error) {
+	type departure struct {
+		orgID, heir int64
+	}
+	var departures []departure
+	var abandoned []int64
+
+	for _, m := range user.Orgs {
+		members, err := u.orgs.ListMembers(ctx, m.OrgID)
+		if err != nil {
+			u.log.Error("failed to list members", slog.String("err", err.Error()))
+			return nil, err
+		}
+		if len(members) <= 1 {
+			abandoned = append(abandoned, m.OrgID)
+			continue
+		}
+		heir := successor(members, user.ID)
+		if heir == 0 {
+			return nil, ErrLastOwner
+		}
+		departures = append(departures, departure{orgID: m.OrgID, heir: heir})
+	}
+
+	for _, d := range departures {
+		if _, err := u.removeMember(ctx, user, d.orgID, user.ID, d.heir); err != nil {
+			return nil, err
+		}
+	}
+
+	return abandoned, nil
+}
+
+// canGrant reports whether a member with the role may change the role of a
+// member from old to role, or invite with old empty, or remove with role
+// empty. Admins can't touch owners.
+func canGrant(actor, old, role string) bool {
+	switch actor {
+	case models.OrgRoleOwner:
+		return true
+	case models.OrgRoleAdmin:
+		return old != models.OrgRoleOwner && role != models.OrgRoleOwner
+	default:
+		return false
+	}
+}
+
+// orgRoles maps the organization IDs of the memberships to their role, the
+// way they are carried in access tokens.
+func orgRoles(memberships []models.Membership) map[string]string {
+	if len(memberships) == 0 {
+		return nil
+	}
+	roles := make(map[string]string, len(memberships))
+	for _, m := range memberships {
+		roles[strconv.FormatInt(m.OrgID, 10)] = m.Role
+	}
+	return roles
+}
+
+// successor returns an owner other than the user, zero if there is none.
+func successor(members []models.Member, userID int64) int64 {
+	for _, m := range members {
+		if m.UserID != userID && m.Role == models.OrgRoleOwner {
+			return m.UserID
+		}
+	}
+	return 0
+}
+
+func findMember(members []models.Member, userID int64) (models.Member, bool) {
+	for _, m := range members {
+		if m.UserID == userID {
+			return m, true
+		}
+	}
+	return models.Member{}, false
+}
+
+// orgDenied tells non-members apart from members lacking the role.
+func orgDenied(caller models.User, orgID int64) error {
+	if caller.OrgRole(orgID) == "" {
+		return ErrNotOrgMember
+	}
+	return ErrPermissionDenied
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrWeakPassword is returned for passwords rejected by the password policy.
+	ErrWeakPassword = errors.New("password does not meet the policy")
+	// ErrUnknownHash is returned for stored hashes no hasher recognizes.
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// Supported password hashing algorithms.
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// PasswordHasher hashes passwords into a self-describing encoded form that
+// carries the algorithm and its parameters.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	// Recognizes reports whether the encoded hash is of this hasher's algorithm.
+	Recognizes(encoded []byte) bool
+	Verify(encoded []byte, password string) (bool, error)
+	// NeedsRehash reports whether the hash was made with other parameters
+	// than the hasher is configured with.
+	NeedsRehash(encoded []byte) bool
+}
+
+// PasswordPolicy is what passwords must satisfy when they are set.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// Breached holds the uppercase hex SHA-1 of passwords known from breaches.
+	Breached map[string]struct{}
+}
+
+// Passwords hashes new passwords with the preferred hasher and verifies
+// hashes of any of the known ones, so that stored hashes can be upgraded.
+type Passwords struct {
+	preferred PasswordHasher
+	known     []PasswordHasher
+	policy    PasswordPolicy
+}
+
+func NewPasswords(policy PasswordPolicy, preferred PasswordHasher, others ...PasswordHasher) *Passwords {
+	return &Passwords{
+		preferred: preferred,
+		known:     append([]PasswordHasher{preferred}, others...),
+		policy:    policy,
+	}
+}
+
+func (p *Passwords) Hash(password string) ([]byte, error) {
+	return p.preferred.Hash(password)
+}
+
+// Verify checks the password against the encoded hash. rehash tells that the
+// hash should be replaced with one of the preferred hasher.
+func (p *Passwords) Verify(encoded []byte, password string) (ok, rehash bool, err error) {
+	for _, hasher := range p.known {
+		if !hasher.Recognizes(encoded) {
+			continue
+		}
+		ok, err := hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, hasher != p.preferred || hasher.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+// Validate checks the password against the policy.
+func (p *Passwords) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.policy.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrWeakPassword, p.policy.MinLength)
+	}
+	if p.policy.MaxLength > 0 && length > p.policy.MaxLength {
+		return fmt.Errorf("%w: use at most %d characters", ErrWeakPassword, p.policy.MaxLength)
+	}
+	if _, ok := p.policy.Breached[sha1Hex(password)]; ok {
+		return fmt.Errorf("%w: this password appeared in a data breach", ErrWeakPassword)
+	}
+	return nil
+}
+
+// LoadBreachedPasswords reads a list of breached passwords, one per line.
+// Lines may hold the password itself or its hex SHA-1, as in the Have I Been
+// Pwned dumps (an optional ":count" suffix is ignored). An empty path yields
+// an empty list.
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+	const op = "services.LoadBreachedPasswords"
+
+	breached := make(map[string]struct{})
+	if path == "" {
+		return breached, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return breached, nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Argon2idHasher hashes passwords with argon2id into the PHC string format
+// "$argon2id$v=19$m=<KiB>,t=<time>,p=<threads>$<salt>$<key>".
+type Argon2idHasher struct {
+	Time       uint32
+	MemoryKiB  uint32
+	Threads    uint8
+	KeyLength  uint32
+	SaltLength int
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h Argon2idHasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.MemoryKiB, h.Threads, h.KeyLength)
+
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.MemoryKiB, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+func (h Argon2idHasher) Recognizes(encoded []byte) bool {
+	return bytes.HasPrefix(encoded, []byte("$argon2id$"))
+}
+
+func (h Argon2idHasher) Verify(encoded []byte, password string) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded []byte) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.memory != h.MemoryKiB || params.time != h.Time || params.threads != h.Threads ||
+		uint32(len(params.key)) != h.KeyLength || len(params.salt) != h.SaltLength
+}
+
+func decodeArgon2id(encoded []byte) (argon2Params, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(string(encoded), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, ErrUnknownHash
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil ||
+		params.time < 1 || params.threads < 1 {
+		return argon2Params{}, ErrUnknownHash
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2Params{}, ErrUnknownHash
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return argon2Params{}, ErrUnknownHash
+	}
+
+	return params, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt, whose encoding carries the cost.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+}
+
+func (h BcryptHasher) Recognizes(encoded []byte) bool {
+	return bytes.HasPrefix(encoded, []byte("$2a$")) ||
+		bytes.HasPrefix(encoded, []byte("$2b$")) ||
+		bytes.HasPrefix(encoded, []byte("$2y$"))
+}
+
+func (h BcryptHasher) Verify(encoded []byte, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(encoded, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) NeedsRehash(encoded []byte) bool {
+	cost, err := bcrypt.Cost(encoded)
+	return err != nil || cost != h.Cost
+}
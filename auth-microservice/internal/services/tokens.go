@@ -0,0 +1,201 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token is presented a
+	// second time. The whole token family is revoked as it may be stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+type TokenStorage interface {
+	SaveRefreshToken(ctx context.Context, token models.RefreshToken) error
+	UseRefreshToken(ctx context.Context, hash string, now time.Time) (models.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUserTokens(ctx context.Context, userID int64) error
+	ConsumeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeUserAccess(ctx context.Context, userID int64, notBefore, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+	Revocations(ctx context.Context, since time.Time) (models.Revocations, error)
+}
+
+// revocationOverlap is how far listings of revocations reach back before
+// they were started, so revocations written meanwhile aren't missed.
+const revocationOverlap = 10 * time.Second
+
+// IssueTokens starts a new session for the user: an access token and the
+// first refresh token of a new family.
+func (u *Auth) IssueTokens(ctx context.Context, user models.User) (models.TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		u.log.Error("failed to generate token family", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	return u.issueTokens(ctx, user, familyID)
+}
+
+func (u *Auth) issueTokens(ctx context.Context, user models.User, familyID string) (models.TokenPair, error) {
+	accessToken, err := u.GenerateJWT(user)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		u.log.Error("failed to generate refresh token", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	now := time.Now()
+	err = u.tokens.SaveRefreshToken(ctx, models.RefreshToken{
+		Hash:      hashToken(refreshToken),
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.policy.RefreshTTL),
+	})
+	if err != nil {
+		u.log.Error("failed to save refresh token", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    u.policy.AccessTTL,
+	}, nil
+}
+
+// Refresh rotates the refresh token: it is used up and a new token pair of
+// the same family is issued.
+func (u *Auth) Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	now := time.Now()
+
+	token, err := u.tokens.UseRefreshToken(ctx, hashToken(refreshToken), now)
+	switch {
+	case errors.Is(err, storage.ErrTokenNotFound):
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	case errors.Is(err, storage.ErrTokenReused):
+		u.log.Warn("refresh token reused, revoking session",
+			slog.Int64("user_id", token.UserID), slog.String("family", token.FamilyID))
+		if err := u.tokens.RevokeFamily(ctx, token.FamilyID); err != nil {
+			u.log.Error("failed to revoke token family", slog.String("err", err.Error()))
+			return models.TokenPair{}, err
+		}
+		return models.TokenPair{}, ErrRefreshTokenReused
+	case err != nil:
+		u.log.Error("failed to use refresh token", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	if !now.Before(token.ExpiresAt) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := u.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return models.TokenPair{}, err
+	}
+	if user.Disabled {
+		return models.TokenPair{}, ErrUserDisabled
+	}
+
+	return u.issueTokens(ctx, user, token.FamilyID)
+}
+
+// Logout revokes the access token until it expires and the session of the
+// refresh token. Either may be empty, unknown or invalid tokens are ignored.
+func (u *Auth) Logout(ctx context.Context, accessToken, refreshToken string) error {
+	if accessToken != "" {
+		if claims, err := u.parseJWT(accessToken); err == nil {
+			err := u.tokens.RevokeAccessToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+			if err != nil {
+				u.log.Error("failed to revoke access token", slog.String("err", err.Error()))
+				return err
+			}
+		}
+	}
+
+	if refreshToken != "" {
+		token, err := u.tokens.GetRefreshToken(ctx, hashToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				return nil
+			}
+			u.log.Error("failed to get refresh token", slog.String("err", err.Error()))
+			return err
+		}
+		if err := u.tokens.RevokeFamily(ctx, token.FamilyID); err != nil {
+			u.log.Error("failed to revoke token family", slog.String("err", err.Error()))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how opaque tokens are stored: refresh tokens are high-entropy
+// random strings, so a plain SHA-256 is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// revokeSessions ends every session of the user: the refresh tokens and the
+// access tokens issued so far.
+func (u *Auth) revokeSessions(ctx context.Context, userID int64) error {
+	if err := u.tokens.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	return u.revokeAccess(ctx, userID)
+}
+
+// revokeAccess revokes the access tokens of the user issued so far, e.g.
+// when their role changes. Tokens are issued with a precision of seconds,
+// those issued later in the current second stay valid.
+func (u *Auth) revokeAccess(ctx context.Context, userID int64) error {
+	notBefore := time.Now().Truncate(time.Second)
+	return u.tokens.RevokeUserAccess(ctx, userID, notBefore, notBefore.Add(u.policy.AccessTTL))
+}
+
+// Revocations lists the access tokens revoked since the given time for the
+// services verifying tokens locally.
+func (u *Auth) Revocations(ctx context.Context, since time.Time) (models.Revocations, error) {
+	asOf := time.Now().Add(-revocationOverlap)
+
+	revocations, err := u.tokens.Revocations(ctx, since)
+	if err != nil {
+		u.log.Error("failed to list revocations", slog.String("err", err.Error()))
+		return models.Revocations{}, err
+	}
+	revocations.AsOf = asOf
+
+	return revocations, nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+var (
+	// ErrTOTPRequired matches the *ChallengeError of logins that need a second factor.
+	ErrTOTPRequired       = errors.New("second factor required")
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotEnrolled    = errors.New("no two-factor enrollment to confirm")
+	ErrInvalidTOTPCode    = errors.New("invalid two-factor code")
+)
+
+const purposeTOTPChallenge = "totp-challenge"
+
+// totpPeriod is the time step of codes, the one authenticator apps assume.
+const totpPeriod = 30 * time.Second
+
+// TOTPPolicy configures two-factor authentication.
+type TOTPPolicy struct {
+	// Issuer names the service in authenticator apps.
+	Issuer string
+	// Skew is the number of time steps before and after the current one
+	// whose codes are accepted.
+	Skew          int
+	RecoveryCodes int
+	// ChallengeTTL bounds the time between the password and the code of a login.
+	ChallengeTTL time.Duration
+}
+
+// ChallengeError is returned by Login for users with two-factor
+// authentication, the login continues with VerifyTOTP and the token.
+type ChallengeError struct {
+	Token     string
+	ExpiresIn time.Duration
+}
+
+func (e *ChallengeError) Error() string {
+	return ErrTOTPRequired.Error()
+}
+
+func (e *ChallengeError) Is(target error) bool {
+	return target == ErrTOTPRequired
+}
+
+// EnrollTOTP generates a new secret for the caller and returns it together
+// with its otpauth:// provisioning URI. It takes effect with ConfirmTOTP.
+func (u *Auth) EnrollTOTP(ctx context.Context, caller models.User) (secret, uri string, err error) {
+	if caller.TOTPEnabled() {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      u.totp.Issuer,
+		AccountName: caller.Email,
+		Period:      uint(totpPeriod.Seconds()),
+	})
+	if err != nil {
+		u.log.Error("failed to generate totp secret", slog.String("err", err.Error()))
+		return "", "", err
+	}
+
+	if err := u.storage.SetPendingTOTP(ctx, caller.ID, key.Secret()); err != nil {
+		u.log.Error("failed to store totp secret", slog.String("err", err.Error()))
+		return "", "", err
+	}
+
+	return key.Secret(), key.URL(), nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the caller proves with
+// a code that the enrolled secret made it to their authenticator. It returns
+// the recovery codes, only their hashes are kept.
+func (u *Auth) ConfirmTOTP(ctx context.Context, caller models.User, code string) ([]string, error) {
+	if caller.TOTPEnabled() {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if caller.TOTPPendingSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	step, ok := u.matchTOTP(caller.TOTPPendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, hashes, err := newRecoveryCodes(u.totp.RecoveryCodes)
+	if err != nil {
+		u.log.Error("failed to generate recovery codes", slog.String("err", err.Error()))
+		return nil, err
+	}
+
+	if err := u.storage.EnableTOTP(ctx, caller.ID, caller.TOTPPendingSecret, hashes); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			// Another enrollment replaced the secret meanwhile.
+			return nil, ErrTOTPNotEnrolled
+		}
+		u.log.Error("failed to enable totp", slog.String("err", err.Error()))
+		return nil, err
+	}
+	// The confirming code must not log in as well.
+	if _, err := u.storage.UseTOTPStep(ctx, caller.ID, step); err != nil {
+		u.log.Error("failed to record totp step", slog.String("err", err.Error()))
+	}
+
+	u.audit(ctx, "totp.enabled", slog.Int64("user_id", caller.ID))
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off, it needs a current code.
+func (u *Auth) DisableTOTP(ctx context.Context, caller models.User, code string) error {
+	if !caller.TOTPEnabled() {
+		return ErrTOTPNotEnabled
+	}
+
+	ok, err := u.checkSecondFactor(ctx, caller, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	if err := u.storage.DisableTOTP(ctx, caller.ID); err != nil {
+		u.log.Error("failed to disable totp", slog.String("err", err.Error()))
+		return err
+	}
+
+	u.audit(ctx, "totp.disabled", slog.Int64("user_id", caller.ID))
+
+	return nil
+}
+
+// totpChallenge is what Login returns for users with a second factor.
+func (u *Auth) totpChallenge(user models.User) error {
+	token, err := u.actionToken(user, purposeTOTPChallenge, u.totp.ChallengeTTL)
+	if err != nil {
+		return err
+	}
+	return &ChallengeError{Token: token, ExpiresIn: u.totp.ChallengeTTL}
+}
+
+// VerifyTOTP completes a login with the challenge token of Login and a TOTP
+// or recovery code. Wrong codes count as failed logins, so guessing locks the
+// account out like guessing passwords does. The challenge can be retried
+// until it expires and is used up by the successful attempt.
+func (u *Auth) VerifyTOTP(ctx context.Context, challenge, code, clientIP string) (models.TokenPair, error) {
+	claims, user, err := u.verifyActionToken(ctx, challenge, purposeTOTPChallenge)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if !user.TOTPEnabled() || user.Disabled {
+		return models.TokenPair{}, ErrInvalidActionToken
+	}
+
+	locked, err := u.lockedFor(ctx, user.Email, clientIP)
+	if err != nil {
+		u.log.Error("failed to check lockout", slog.String("err", err.Error()))
+		return models.TokenPair{}, err
+	}
+	if locked > 0 {
+		u.audit(ctx, "login.blocked", slog.Int64("user_id", user.ID), slog.String("ip", clientIP))
+		return models.TokenPair{}, &LockoutError{RetryAfter: locked}
+	}
+
+	ok, err := u.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if !ok {
+		u.loginFailed(ctx, user.Email, clientIP)
+		return models.TokenPair{}, ErrInvalidTOTPCode
+	}
+
+	if err := u.consumeActionToken(ctx, claims); err != nil {
+		return models.TokenPair{}, err
+	}
+	if err := u.attempts.Reset(ctx, accountKey(user.Email)); err != nil {
+		u.log.Error("failed to reset login failures", slog.String("err", err.Error()))
+	}
+
+	return u.IssueTokens(ctx, user)
+}
+
+// checkSecondFactor accepts a TOTP code of a step not used before or an
+// unused recovery code, which is used up.
+func (u *Auth) checkSecondFactor(ctx context.Context, user models.User, code string) (bool, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	if len(code) == int(otp.DigitsSix) {
+		step, ok := u.matchTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		fresh, err := u.storage.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			u.log.Error("failed to record totp step", slog.String("err", err.Error()))
+			return false, err
+		}
+		if !fresh {
+			u.audit(ctx, "totp.replayed", slog.Int64("user_id", user.ID))
+		}
+		return fresh, nil
+	}
+
+	used, err := u.storage.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		u.log.Error("failed to use recovery code", slog.String("err", err.Error()))
+		return false, err
+	}
+	if used {
+		u.audit(ctx, "totp.recovery_code_used",
+			slog.Int64("user_id", user.ID),
+			slog.Int("remaining", len(user.RecoveryCodes)-1),
+		)
+	}
+	return used, nil
+}
+
+// matchTOTP checks the code against the steps within the skew of now and
+// returns the step it belongs to.
+func (u *Auth) matchTOTP(secret, code string, now time.Time) (step int64, ok bool) {
+	opts := totp.ValidateOpts{
+		Period:    uint(totpPeriod.Seconds()),
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+	for i := -u.totp.Skew; i <= u.totp.Skew; i++ {
+		t := now.Add(time.Duration(i) * totpPeriod)
+		expected, err := totp.GenerateCodeCustom(secret, t, opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / int64(totpPeriod.Seconds()), true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCodes generates n codes of 80 random bits formatted as
+// XXXX-XXXX-XXXX-XXXX, and their hashes.
+func newRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(b)
+		codes = append(codes, fmt.Sprintf("%s-%s-%s-%s", raw[0:4], raw[4:8], raw[8:12], raw[12:16]))
+		hashes = append(hashes, hashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+		Period:    uint(totpPeriod.Seconds()),
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	return code
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	step := now.Unix() / int64(totpPeriod.Seconds())
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", testTOTPSecret, totpCode(t, testTOTPSecret, now), step, true},
+		{"previous step", testTOTPSecret, totpCode(t, testTOTPSecret, now.Add(-totpPeriod)), step - 1, true},
+		{"next step", testTOTPSecret, totpCode(t, testTOTPSecret, now.Add(totpPeriod)), step + 1, true},
+		{"outside the skew", testTOTPSecret, totpCode(t, testTOTPSecret, now.Add(-2*totpPeriod)), 0, false},
+		{"other secret", "KRSXG5CTMVRXEZLU", totpCode(t, testTOTPSecret, now), 0, false},
+		{"invalid secret", "not base32!", totpCode(t, testTOTPSecret, now), 0, false},
+		{"empty code", testTOTPSecret, "", 0, false},
+	}
+
+	u := &Auth{totp: TOTPPolicy{Skew: 1}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := u.matchTOTP(tt.secret, tt.code, now)
+			if gotStep != tt.wantStep || gotOK != tt.wantOK {
+				t.Errorf("matchTOTP() = (%d, %v), want (%d, %v)", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// totpStorage keeps the second factor state of one user the way the Mongo
+// storage does, the other UserStorage methods aren't used by the tests.
+type totpStorage struct {
+	UserStorage
+	lastStep      int64
+	recoveryCodes map[string]bool
+}
+
+func (s *totpStorage) UseTOTPStep(_ context.Context, _ int64, step int64) (bool, error) {
+	if step <= s.lastStep {
+		return false, nil
+	}
+	s.lastStep = step
+	return true, nil
+}
+
+func (s *totpStorage) UseRecoveryCode(_ context.Context, _ int64, hash string) (bool, error) {
+	if !s.recoveryCodes[hash] {
+		return false, nil
+	}
+	delete(s.recoveryCodes, hash)
+	return true, nil
+}
+
+func TestCheckSecondFactor(t *testing.T) {
+	now := time.Now()
+	current := totpCode(t, testTOTPSecret, now)
+	previous := totpCode(t, testTOTPSecret, now.Add(-totpPeriod))
+
+	codes, hashes, err := newRecoveryCodes(1)
+	if err != nil {
+		t.Fatalf("newRecoveryCodes() error = %v", err)
+	}
+	recovery := codes[0]
+
+	tests := []struct {
+		name  string
+		codes []string
+		want  []bool
+	}{
+		{"fresh code", []string{current}, []bool{true}},
+		{"code with spaces", []string{" " + current[:3] + " " + current[3:] + " "}, []bool{true}},
+		{"replayed code", []string{current, current}, []bool{true, false}},
+		{"older step after a newer one", []string{current, previous}, []bool{true, false}},
+		{"newer step after an older one", []string{previous, current}, []bool{true, true}},
+		{"recovery code", []string{recovery}, []bool{true}},
+		{"recovery code without dashes", []string{strings.ToLower(strings.ReplaceAll(recovery, "-", ""))}, []bool{true}},
+		{"reused recovery code", []string{recovery, recovery}, []bool{true, false}},
+		{"unknown recovery code", []string{"AAAA-AAAA-AAAA-AAAA"}, []bool{false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &totpStorage{recoveryCodes: map[string]bool{hashes[0]: true}}
+			u := &Auth{
+				log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+				storage: storage,
+				totp:    TOTPPolicy{Skew: 1},
+			}
+			user := models.User{ID: 1, TOTPSecret: testTOTPSecret, RecoveryCodes: hashes}
+
+			for i, code := range tt.codes {
+				got, err := u.checkSecondFactor(context.Background(), user, code)
+				if err != nil {
+					t.Fatalf("checkSecondFactor(%q) error = %v", code, err)
+				}
+				if got != tt.want[i] {
+					t.Errorf("checkSecondFactor(%q) #%d = %v, want %v", code, i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
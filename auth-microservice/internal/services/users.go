@@ -0,0 +1,119 @@
+package services
+
+import (
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidRole      = errors.New("invalid role")
+	// ErrSelfLockout is returned when administrators would disable or demote themselves.
+	ErrSelfLockout = errors.New("cannot disable or demote yourself")
+	// ErrUserDisabled is returned for users disabled by an administrator.
+	ErrUserDisabled = errors.New("user disabled")
+)
+
+const (
+	defaultUserListLimit = 20
+	maxUserListLimit     = 100
+)
+
+// ListUsers returns a page of all users, the caller needs the users:read permission.
+func (u *Auth) ListUsers(ctx context.Context, caller models.User, limit, offset int64) ([]models.User, int64, error) {
+	if !caller.Can(models.PermUsersRead) {
+		return nil, 0, ErrPermissionDenied
+	}
+
+	if limit <= 0 {
+		limit = defaultUserListLimit
+	}
+	if limit > maxUserListLimit {
+		limit = maxUserListLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	users, total, err := u.storage.ListUsers(ctx, limit, offset)
+	if err != nil {
+		u.log.Error("failed to list users", slog.String("err", err.Error()))
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// UpdateUser changes the role of a user or disables them, the caller needs
+// the users:write permission. Disabling a user ends all their sessions, a new
+// role revokes their access tokens so the next ones carry it.
+func (u *Auth) UpdateUser(ctx context.Context, caller models.User, id int64, update models.UserUpdate) (models.User, error) {
+	if !caller.Can(models.PermUsersWrite) {
+		return models.User{}, ErrPermissionDenied
+	}
+	if update.Role != nil && !models.ValidRole(*update.Role) {
+		return models.User{}, ErrInvalidRole
+	}
+	if caller.ID == id &&
+		((update.Disabled != nil && *update.Disabled) || (update.Role != nil && *update.Role != caller.Role)) {
+		return models.User{}, ErrSelfLockout
+	}
+
+	user, err := u.storage.UpdateUser(ctx, id, update)
+	if err != nil {
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			u.log.Error("failed to update user", slog.String("err", err.Error()))
+		}
+		return models.User{}, err
+	}
+
+	if update.Disabled != nil && *update.Disabled {
+		if err := u.revokeSessions(ctx, id); err != nil {
+			u.log.Error("failed to revoke sessions", slog.String("err", err.Error()))
+			return models.User{}, err
+		}
+	} else if update.Role != nil {
+		if err := u.revokeAccess(ctx, id); err != nil {
+			u.log.Error("failed to revoke access tokens", slog.String("err", err.Error()))
+			return models.User{}, err
+		}
+	}
+
+	attrs := []slog.Attr{slog.Int64("admin_id", caller.ID), slog.Int64("user_id", id)}
+	if update.Role != nil {
+		attrs = append(attrs, slog.String("role", *update.Role))
+	}
+	if update.Disabled != nil {
+		attrs = append(attrs, slog.Bool("disabled", *update.Disabled))
+	}
+	u.audit(ctx, "user.updated", attrs...)
+
+	return user, nil
+}
+
+// EnsureAdmins gives the admin role to the existing users with the emails,
+// it bootstraps the first administrators from the config.
+func (u *Auth) EnsureAdmins(ctx context.Context, emails []string) error {
+	role := models.RoleAdmin
+	for _, email := range emails {
+		user, err := u.storage.GetUser(ctx, email)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				u.log.Warn("configured admin is not registered", slog.String("email", email))
+				continue
+			}
+			return err
+		}
+		if user.Role == models.RoleAdmin {
+			continue
+		}
+		if _, err := u.storage.UpdateUser(ctx, user.ID, models.UserUpdate{Role: &role}); err != nil {
+			return err
+		}
+		u.audit(ctx, "user.promoted", slog.Int64("user_id", user.ID), slog.String("role", role))
+	}
+	return nil
+}
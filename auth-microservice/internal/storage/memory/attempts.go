@@ -0,0 +1,104 @@
+// Package memory implements in-process stores for single instance setups and
+// as a fallback when Redis is unavailable.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AttemptStore keeps failed login counters and lockouts in memory.
+type AttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]entry
+	locks    map[string]time.Time
+	// sweepAt is when expired entries are dropped next, so that keys of
+	// one-off attempts don't accumulate.
+	sweepAt time.Time
+}
+
+type entry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// sweepInterval is how often expired entries are dropped.
+const sweepInterval = time.Minute
+
+func NewAttemptStore() *AttemptStore {
+	return &AttemptStore{
+		attempts: make(map[string]entry),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+// Increment counts a failure under key and returns the failures within the window.
+func (s *AttemptStore) Increment(_ context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	e, ok := s.attempts[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = entry{expiresAt: now.Add(window)}
+	}
+	e.count++
+	s.attempts[key] = e
+
+	return e.count, nil
+}
+
+func (s *AttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// Lock locks key for d.
+func (s *AttemptStore) Lock(_ context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(d)
+	return nil
+}
+
+// LockedFor returns how long key stays locked, zero when it isn't.
+func (s *AttemptStore) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	left := time.Until(until)
+	if left <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return left, nil
+}
+
+func (s *AttemptStore) sweep(now time.Time) {
+	if now.Before(s.sweepAt) {
+		return
+	}
+	s.sweepAt = now.Add(sweepInterval)
+
+	for key, e := range s.attempts {
+		if !now.Before(e.expiresAt) {
+			delete(s.attempts, key)
+		}
+	}
+	for key, until := range s.locks {
+		if !now.Before(until) {
+			delete(s.locks, key)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyStorage keeps personal API keys. Keys are stored under their public
+// prefix, expired ones are purged by a TTL index.
+type APIKeyStorage struct {
+	keys *mongo.Collection
+}
+
+type apiKeyDocument struct {
+	Prefix     string     `bson:"_id"`
+	Hash       string     `bson:"hash"`
+	UserID     int64      `bson:"user_id"`
+	Name       string     `bson:"name"`
+	Scopes     []string   `bson:"scopes"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty"`
+}
+
+// APIKeys creates the API key storage in the database of the user storage.
+func (s *Storage) APIKeys(collection string) (*APIKeyStorage, error) {
+	const op = "storage.mongodb.APIKeys"
+
+	k := &APIKeyStorage{keys: s.collection.Database().Collection(collection)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := k.keys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create indexes: %w", op, err)
+	}
+
+	return k, nil
+}
+
+func (k *APIKeyStorage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	const op = "storage.mongodb.SaveAPIKey"
+
+	doc := apiKeyDocument{
+		Prefix:    key.Prefix,
+		Hash:      key.Hash,
+		UserID:    key.UserID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.UTC(),
+	}
+	if !key.ExpiresAt.IsZero() {
+		expiresAt := key.ExpiresAt.UTC()
+		doc.ExpiresAt = &expiresAt
+	}
+
+	if _, err := k.keys.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("%s: insert document: %w", op, err)
+	}
+
+	return nil
+}
+
+func (k *APIKeyStorage) GetAPIKey(ctx context.Context, prefix string) (models.APIKey, error) {
+	const op = "storage.mongodb.GetAPIKey"
+
+	var doc apiKeyDocument
+	err := k.keys.FindOne(ctx, bson.D{{Key: "_id", Value: prefix}}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.APIKey{}, storage.ErrAPIKeyNotFound
+		}
+		return models.APIKey{}, fmt.Errorf("%s: find document: %w", op, err)
+	}
+
+	return doc.toModel(), nil
+}
+
+// ListAPIKeys returns the keys of the user, newest first.
+func (k *APIKeyStorage) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	const op = "storage.mongodb.ListAPIKeys"
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := k.keys.Find(ctx, bson.D{{Key: "user_id", Value: userID}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: find documents: %w", op, err)
+	}
+
+	var docs []apiKeyDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("%s: decode documents: %w", op, err)
+	}
+
+	keys := make([]models.APIKey, 0, len(docs))
+	for _, doc := range docs {
+		keys = append(keys, doc.toModel())
+	}
+
+	return keys, nil
+}
+
+func (k *APIKeyStorage) CountAPIKeys(ctx context.Context, userID int64) (int64, error) {
+	const op = "storage.mongodb.CountAPIKeys"
+
+	count, err := k.keys.CountDocuments(ctx, bson.D{{Key: "user_id", Value: userID}})
+	if err != nil {
+		return 0, fmt.Errorf("%s: count documents: %w", op, err)
+	}
+
+	return count, nil
+}
+
+// DeleteAPIKey deletes the key of the user.
+func (k *APIKeyStorage) DeleteAPIKey(ctx context.Context, userID int64, prefix string) error {
+	const op = "storage.mongodb.DeleteAPIKey"
+
+	res, err := k.keys.DeleteOne(ctx, bson.D{{Key: "_id", Value: prefix}, {Key: "user_id", Value: userID}})
+	if err != nil {
+		return fmt.Errorf("%s: delete document: %w", op, err)
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// DeleteUserAPIKeys deletes all keys of the user.
+func (k *APIKeyStorage) DeleteUserAPIKeys(ctx context.Context, userID int64) error {
+	const op = "storage.mongodb.DeleteUserAPIKeys"
+
+	if _, err := k.keys.DeleteMany(ctx, bson.D{{Key: "user_id", Value: userID}}); err != nil {
+		return fmt.Errorf("%s: delete documents: %w", op, err)
+	}
+
+	return nil
+}
+
+// TouchAPIKey records a use of the key at the given time unless one was
+// recorded after notBefore, which spares a write on every use.
+func (k *APIKeyStorage) TouchAPIKey(ctx context.Context, prefix string, at, notBefore time.Time) error {
+	const op = "storage.mongodb.TouchAPIKey"
+
+	filter := bson.D{
+		{Key: "_id", Value: prefix},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "last_used_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "last_used_at", Value: bson.D{{Key: "$lt", Value: notBefore.UTC()}}}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "last_used_at", Value: at.UTC()}}}}
+
+	if _, err := k.keys.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+
+	return nil
+}
+
+func (d apiKeyDocument) toModel() models.APIKey {
+	key := models.APIKey{
+		Prefix:    d.Prefix,
+		Hash:      d.Hash,
+		UserID:    d.UserID,
+		Name:      d.Name,
+		Scopes:    d.Scopes,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.ExpiresAt != nil {
+		key.ExpiresAt = *d.ExpiresAt
+	}
+	if d.LastUsedAt != nil {
+		key.LastUsedAt = *d.LastUsedAt
+	}
+	return key
+}
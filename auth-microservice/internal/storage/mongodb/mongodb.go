@@ -15,14 +15,52 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// countersCollection holds the sequences user and organization IDs are allocated from.
+const (
+	countersCollection = "counters"
+	userIDSequence     = "user_id"
+	orgIDSequence      = "org_id"
+)
+
 type Storage struct {
 	client     *mongo.Client
 	collection *mongo.Collection
+	counters   *mongo.Collection
 }
 
 type UserDocument struct {
+	UserID   int64  `bson:"user_id"`
 	Email    string `bson:"email"`
 	Password string `bson:"password"`
+	Verified bool   `bson:"verified"`
+	Role     string `bson:"role,omitempty"`
+	// Permissions are granted on top of those of the role.
+	Permissions []string `bson:"permissions,omitempty"`
+	Disabled    bool     `bson:"disabled,omitempty"`
+	// TOTPSecret is set once two-factor authentication is confirmed, the
+	// pending secret while it is being enrolled.
+	TOTPSecret        string `bson:"totp_secret,omitempty"`
+	TOTPPendingSecret string `bson:"totp_pending_secret,omitempty"`
+	// TOTPLastStep is the time step of the last accepted code, codes of it
+	// and earlier steps are rejected as replays.
+	TOTPLastStep  int64    `bson:"totp_last_step,omitempty"`
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+	// OIDCIssuer and OIDCSubject link the user to an external identity.
+	OIDCIssuer  string `bson:"oidc_issuer,omitempty"`
+	OIDCSubject string `bson:"oidc_subject,omitempty"`
+	// Orgs are the memberships of the user, see OrgStorage.
+	Orgs []membershipDocument `bson:"orgs,omitempty"`
+}
+
+type membershipDocument struct {
+	OrgID    int64     `bson:"org_id"`
+	Role     string    `bson:"role"`
+	JoinedAt time.Time `bson:"joined_at"`
+}
+
+type counterDocument struct {
+	ID  string `bson:"_id"`
+	Seq int64  `bson:"seq"`
 }
 
 func New(uri, database, collection string) (*Storage, error) {
@@ -43,30 +81,148 @@ func New(uri, database, collection string) (*Storage, error) {
 	}
 
 	db := client.Database(database)
-	coll := db.Collection(collection)
+	s := &Storage{
+		client:     client,
+		collection: db.Collection(collection),
+		counters:   db.Collection(countersCollection),
+	}
 
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "email", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	// Users created before IDs were persisted need one before the unique
+	// index on user_id can be built.
+	if err := s.backfillUserIDs(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = coll.Indexes().CreateOne(ctx, indexModel)
+	// Users registered before email verification existed are trusted.
+	_, err = s.collection.UpdateMany(ctx,
+		bson.D{{Key: "verified", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "verified", Value: true}}}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: backfill verified: %w", op, err)
+	}
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "oidc_issuer", Value: 1}, {Key: "oidc_subject", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{Keys: bson.D{{Key: "orgs.org_id", Value: 1}}},
+	}
+
+	_, err = s.collection.Indexes().CreateMany(ctx, indexModels)
 	if err != nil {
 		return nil, fmt.Errorf("%s: create index: %w", op, err)
 	}
 
-	return &Storage{client: client, collection: coll}, nil
+	return s, nil
+}
+
+// nextUserID atomically allocates the next user ID from the counters collection.
+func (s *Storage) nextUserID(ctx context.Context) (int64, error) {
+	const op = "storage.mongodb.nextUserID"
+
+	id, err := nextSequence(ctx, s.counters, userIDSequence)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// nextSequence atomically increments the sequence and returns its new value.
+func nextSequence(ctx context.Context, counters *mongo.Collection, sequence string) (int64, error) {
+	var counter counterDocument
+	err := counters.FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: sequence}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: int64(1)}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("increment sequence: %w", err)
+	}
+
+	return counter.Seq, nil
+}
+
+func (s *Storage) backfillUserIDs(ctx context.Context) error {
+	const op = "storage.mongodb.backfillUserIDs"
+
+	filter := bson.D{{Key: "user_id", Value: bson.D{{Key: "$exists", Value: false}}}}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("%s: find documents: %w", op, err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("%s: decode document: %w", op, err)
+		}
+
+		id, err := s.nextUserID(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "user_id", Value: id}}}}
+		if _, err := s.collection.UpdateByID(ctx, doc.ID, update); err != nil {
+			return fmt.Errorf("%s: update document: %w", op, err)
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("%s: iterate documents: %w", op, err)
+	}
+
+	return nil
 }
 
 func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (int64, error) {
 	const op = "storage.mongodb.SaveUser"
 
-	doc := UserDocument{
+	return s.insertUser(ctx, op, UserDocument{
 		Email:    email,
 		Password: string(passHash),
+		Role:     models.RoleUser,
+	})
+}
+
+// SaveExternalUser saves a user registered through an external identity
+// provider. The provider verified the email, passHash is a random password
+// that can be replaced by a password reset.
+func (s *Storage) SaveExternalUser(ctx context.Context, identity models.ExternalIdentity, passHash []byte) (int64, error) {
+	const op = "storage.mongodb.SaveExternalUser"
+
+	return s.insertUser(ctx, op, UserDocument{
+		Email:       identity.Email,
+		Password:    string(passHash),
+		Verified:    true,
+		Role:        models.RoleUser,
+		OIDCIssuer:  identity.Issuer,
+		OIDCSubject: identity.Subject,
+	})
+}
+
+// insertUser saves the document under the next user ID and returns the ID.
+func (s *Storage) insertUser(ctx context.Context, op string, doc UserDocument) (int64, error) {
+	id, err := s.nextUserID(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	doc.UserID = id
 
-	_, err := s.collection.InsertOne(ctx, doc)
+	_, err = s.collection.InsertOne(ctx, doc)
 	if err != nil {
 		var mongoWriteException mongo.WriteException
 		if errors.As(err, &mongoWriteException) {
@@ -79,14 +235,30 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 		return 0, fmt.Errorf("%s: insert document: %w", op, err)
 	}
 
-	return 1, nil // Assuming you return 1 for success (MongoDB's LastInsertId equivalent)
+	return id, nil
 }
 
 func (s *Storage) GetUser(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.mongodb.GetUser"
 
+	return s.findUser(ctx, op, bson.D{{Key: "email", Value: email}})
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, id int64) (models.User, error) {
+	const op = "storage.mongodb.GetUserByID"
+
+	return s.findUser(ctx, op, bson.D{{Key: "user_id", Value: id}})
+}
+
+// GetUserByExternalIdentity returns the user linked to the identity of the provider.
+func (s *Storage) GetUserByExternalIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	const op = "storage.mongodb.GetUserByExternalIdentity"
+
+	return s.findUser(ctx, op, bson.D{{Key: "oidc_issuer", Value: issuer}, {Key: "oidc_subject", Value: subject}})
+}
+
+func (s *Storage) findUser(ctx context.Context, op string, filter bson.D) (models.User, error) {
 	var doc UserDocument
-	filter := bson.D{{Key: "email", Value: email}}
 
 	err := s.collection.FindOne(ctx, filter).Decode(&doc)
 	if err != nil {
@@ -96,8 +268,184 @@ func (s *Storage) GetUser(ctx context.Context, email string) (models.User, error
 		return models.User{}, fmt.Errorf("%s: find document: %w", op, err)
 	}
 
-	return models.User{
-		Email:    doc.Email,
-		PassHash: []byte(doc.Password),
-	}, nil
+	return doc.toModel(), nil
+}
+
+func (s *Storage) SetVerified(ctx context.Context, id int64) error {
+	const op = "storage.mongodb.SetVerified"
+
+	return s.updateUser(ctx, op, id, bson.D{{Key: "verified", Value: true}})
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, id int64, passHash []byte) error {
+	const op = "storage.mongodb.UpdatePassword"
+
+	return s.updateUser(ctx, op, id, bson.D{{Key: "password", Value: string(passHash)}})
+}
+
+// ListUsers returns a page of users ordered by ID and the total number of them.
+func (s *Storage) ListUsers(ctx context.Context, limit, offset int64) ([]models.User, int64, error) {
+	const op = "storage.mongodb.ListUsers"
+
+	total, err := s.collection.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: count documents: %w", op, err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "user_id", Value: 1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := s.collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: find documents: %w", op, err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []UserDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, 0, fmt.Errorf("%s: decode documents: %w", op, err)
+	}
+
+	users := make([]models.User, 0, len(docs))
+	for _, doc := range docs {
+		users = append(users, doc.toModel())
+	}
+
+	return users, total, nil
+}
+
+// UpdateUser applies the set fields of the update and returns the updated user.
+func (s *Storage) UpdateUser(ctx context.Context, id int64, update models.UserUpdate) (models.User, error) {
+	const op = "storage.mongodb.UpdateUser"
+
+	set := bson.D{}
+	if update.Role != nil {
+		set = append(set, bson.E{Key: "role", Value: *update.Role})
+	}
+	if update.Disabled != nil {
+		set = append(set, bson.E{Key: "disabled", Value: *update.Disabled})
+	}
+	if len(set) == 0 {
+		return s.GetUserByID(ctx, id)
+	}
+
+	var doc UserDocument
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.D{{Key: "user_id", Value: id}},
+		bson.D{{Key: "$set", Value: set}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: update document: %w", op, err)
+	}
+
+	return doc.toModel(), nil
+}
+
+// UpdateEmail changes the email of the user and marks it verified. It fails
+// with storage.ErrUserExists when another user has the email.
+func (s *Storage) UpdateEmail(ctx context.Context, id int64, email string) error {
+	const op = "storage.mongodb.UpdateEmail"
+
+	err := s.updateUser(ctx, op, id, bson.D{{Key: "email", Value: email}, {Key: "verified", Value: true}})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+	return err
+}
+
+// LinkExternalIdentity links the user to the identity of the provider and
+// marks the email verified, the provider has verified it. With passHash the
+// password is replaced too. It fails with storage.ErrUserNotFound when the
+// user is already linked to another identity.
+func (s *Storage) LinkExternalIdentity(ctx context.Context, id int64, identity models.ExternalIdentity, passHash []byte) error {
+	const op = "storage.mongodb.LinkExternalIdentity"
+
+	set := bson.D{
+		{Key: "oidc_issuer", Value: identity.Issuer},
+		{Key: "oidc_subject", Value: identity.Subject},
+		{Key: "verified", Value: true},
+	}
+	if passHash != nil {
+		set = append(set, bson.E{Key: "password", Value: string(passHash)})
+	}
+
+	res, err := s.collection.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: id}, {Key: "oidc_subject", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "$set", Value: set}},
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the user.
+func (s *Storage) DeleteUser(ctx context.Context, id int64) error {
+	const op = "storage.mongodb.DeleteUser"
+
+	res, err := s.collection.DeleteOne(ctx, bson.D{{Key: "user_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("%s: delete document: %w", op, err)
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) updateUser(ctx context.Context, op string, id int64, set bson.D) error {
+	res, err := s.collection.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: id}},
+		bson.D{{Key: "$set", Value: set}},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (doc UserDocument) toModel() models.User {
+	user := models.User{
+		ID:          doc.UserID,
+		Email:       doc.Email,
+		PassHash:    []byte(doc.Password),
+		Verified:    doc.Verified,
+		Role:        doc.Role,
+		Permissions: doc.Permissions,
+		Disabled:    doc.Disabled,
+
+		TOTPSecret:        doc.TOTPSecret,
+		TOTPPendingSecret: doc.TOTPPendingSecret,
+		TOTPLastStep:      doc.TOTPLastStep,
+		RecoveryCodes:     doc.RecoveryCodes,
+
+		OIDCIssuer:  doc.OIDCIssuer,
+		OIDCSubject: doc.OIDCSubject,
+	}
+	for _, m := range doc.Orgs {
+		user.Orgs = append(user.Orgs, models.Membership{OrgID: m.OrgID, Role: m.Role, JoinedAt: m.JoinedAt})
+	}
+	// Users registered before roles existed are plain users.
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	return user
 }
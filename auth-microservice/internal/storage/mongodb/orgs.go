@@ -0,0 +1,319 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrgStorage keeps organizations and their invitations. Memberships are
+// stored with the users so that they load together with them.
+type OrgStorage struct {
+	orgs        *mongo.Collection
+	invitations *mongo.Collection
+	users       *mongo.Collection
+	counters    *mongo.Collection
+}
+
+type orgDocument struct {
+	OrgID     int64     `bson:"org_id"`
+	Name      string    `bson:"name"`
+	CreatedBy int64     `bson:"created_by"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+type invitationDocument struct {
+	Hash      string    `bson:"_id"`
+	OrgID     int64     `bson:"org_id"`
+	Email     string    `bson:"email"`
+	Role      string    `bson:"role"`
+	InvitedBy int64     `bson:"invited_by"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Orgs creates the organization storage in the database of the user storage.
+// Expired invitations are purged by a TTL index.
+func (s *Storage) Orgs(orgsCollection, invitationsCollection string) (*OrgStorage, error) {
+	const op = "storage.mongodb.Orgs"
+
+	db := s.collection.Database()
+	o := &OrgStorage{
+		orgs:        db.Collection(orgsCollection),
+		invitations: db.Collection(invitationsCollection),
+		users:       s.collection,
+		counters:    s.counters,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := o.orgs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "org_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create org index: %w", op, err)
+	}
+
+	_, err = o.invitations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{Keys: bson.D{{Key: "org_id", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create invitation indexes: %w", op, err)
+	}
+
+	return o, nil
+}
+
+// SaveOrg saves the organization under the next organization ID and returns the ID.
+func (o *OrgStorage) SaveOrg(ctx context.Context, org models.Organization) (int64, error) {
+	const op = "storage.mongodb.SaveOrg"
+
+	id, err := nextSequence(ctx, o.counters, orgIDSequence)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = o.orgs.InsertOne(ctx, orgDocument{
+		OrgID:     id,
+		Name:      org.Name,
+		CreatedBy: org.CreatedBy,
+		CreatedAt: org.CreatedAt.UTC(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: insert document: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (o *OrgStorage) GetOrg(ctx context.Context, id int64) (models.Organization, error) {
+	const op = "storage.mongodb.GetOrg"
+
+	var doc orgDocument
+	err := o.orgs.FindOne(ctx, bson.D{{Key: "org_id", Value: id}}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Organization{}, storage.ErrOrgNotFound
+		}
+		return models.Organization{}, fmt.Errorf("%s: find document: %w", op, err)
+	}
+
+	return doc.toModel(), nil
+}
+
+// GetOrgs returns the organizations with the IDs ordered by ID, unknown IDs are skipped.
+func (o *OrgStorage) GetOrgs(ctx context.Context, ids []int64) ([]models.Organization, error) {
+	const op = "storage.mongodb.GetOrgs"
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "org_id", Value: 1}})
+	cursor, err := o.orgs.Find(ctx, bson.D{{Key: "org_id", Value: bson.D{{Key: "$in", Value: ids}}}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: find documents: %w", op, err)
+	}
+
+	var docs []orgDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("%s: decode documents: %w", op, err)
+	}
+
+	orgs := make([]models.Organization, 0, len(docs))
+	for _, doc := range docs {
+		orgs = append(orgs, doc.toModel())
+	}
+
+	return orgs, nil
+}
+
+// DeleteOrg deletes the organization together with its memberships and invitations.
+func (o *OrgStorage) DeleteOrg(ctx context.Context, id int64) error {
+	const op = "storage.mongodb.DeleteOrg"
+
+	_, err := o.users.UpdateMany(ctx,
+		bson.D{{Key: "orgs.org_id", Value: id}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "orgs", Value: bson.D{{Key: "org_id", Value: id}}}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: remove memberships: %w", op, err)
+	}
+	if _, err := o.invitations.DeleteMany(ctx, bson.D{{Key: "org_id", Value: id}}); err != nil {
+		return fmt.Errorf("%s: delete invitations: %w", op, err)
+	}
+
+	res, err := o.orgs.DeleteOne(ctx, bson.D{{Key: "org_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("%s: delete document: %w", op, err)
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrOrgNotFound
+	}
+
+	return nil
+}
+
+// AddMember adds the user to the organization with the role. It fails with
+// storage.ErrMemberExists when the user already is a member.
+func (o *OrgStorage) AddMember(ctx context.Context, orgID, userID int64, role string, joinedAt time.Time) error {
+	const op = "storage.mongodb.AddMember"
+
+	membership := membershipDocument{OrgID: orgID, Role: role, JoinedAt: joinedAt.UTC()}
+	res, err := o.users.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: userID}, {Key: "orgs.org_id", Value: bson.D{{Key: "$ne", Value: orgID}}}},
+		bson.D{{Key: "$push", Value: bson.D{{Key: "orgs", Value: membership}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	count, err := o.users.CountDocuments(ctx, bson.D{{Key: "user_id", Value: userID}})
+	if err != nil {
+		return fmt.Errorf("%s: count documents: %w", op, err)
+	}
+	if count == 0 {
+		return storage.ErrUserNotFound
+	}
+	return storage.ErrMemberExists
+}
+
+// ListMembers returns the members of the organization ordered by user ID.
+func (o *OrgStorage) ListMembers(ctx context.Context, orgID int64) ([]models.Member, error) {
+	const op = "storage.mongodb.ListMembers"
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "user_id", Value: 1}}).
+		SetProjection(bson.D{{Key: "user_id", Value: 1}, {Key: "email", Value: 1}, {Key: "orgs", Value: 1}})
+	cursor, err := o.users.Find(ctx, bson.D{{Key: "orgs.org_id", Value: orgID}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: find documents: %w", op, err)
+	}
+
+	var docs []UserDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("%s: decode documents: %w", op, err)
+	}
+
+	members := make([]models.Member, 0, len(docs))
+	for _, doc := range docs {
+		for _, m := range doc.Orgs {
+			if m.OrgID == orgID {
+				members = append(members, models.Member{
+					UserID:   doc.UserID,
+					Email:    doc.Email,
+					Role:     m.Role,
+					JoinedAt: m.JoinedAt,
+				})
+			}
+		}
+	}
+
+	return members, nil
+}
+
+// SetMemberRole changes the role of a member of the organization.
+func (o *OrgStorage) SetMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	const op = "storage.mongodb.SetMemberRole"
+
+	res, err := o.users.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: userID}, {Key: "orgs.org_id", Value: orgID}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "orgs.$.role", Value: role}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// RemoveMember removes the user from the organization.
+func (o *OrgStorage) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	const op = "storage.mongodb.RemoveMember"
+
+	res, err := o.users.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: userID}, {Key: "orgs.org_id", Value: orgID}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "orgs", Value: bson.D{{Key: "org_id", Value: orgID}}}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrMemberNotFound
+	}
+
+	return nil
+}
+
+func (o *OrgStorage) SaveInvitation(ctx context.Context, inv models.Invitation) error {
+	const op = "storage.mongodb.SaveInvitation"
+
+	_, err := o.invitations.InsertOne(ctx, invitationDocument{
+		Hash:      inv.Hash,
+		OrgID:     inv.OrgID,
+		Email:     inv.Email,
+		Role:      inv.Role,
+		InvitedBy: inv.InvitedBy,
+		CreatedAt: inv.CreatedAt.UTC(),
+		ExpiresAt: inv.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: insert document: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeInvitation deletes the invitation of the token hash and returns it, so
+// that every invitation is accepted at most once.
+func (o *OrgStorage) TakeInvitation(ctx context.Context, hash string) (models.Invitation, error) {
+	const op = "storage.mongodb.TakeInvitation"
+
+	var doc invitationDocument
+	err := o.invitations.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: hash}}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Invitation{}, storage.ErrInvitationNotFound
+		}
+		return models.Invitation{}, fmt.Errorf("%s: delete document: %w", op, err)
+	}
+
+	return models.Invitation{
+		Hash:      doc.Hash,
+		OrgID:     doc.OrgID,
+		Email:     doc.Email,
+		Role:      doc.Role,
+		InvitedBy: doc.InvitedBy,
+		CreatedAt: doc.CreatedAt,
+		ExpiresAt: doc.ExpiresAt,
+	}, nil
+}
+
+func (d orgDocument) toModel() models.Organization {
+	return models.Organization{
+		ID:        d.OrgID,
+		Name:      d.Name,
+		CreatedBy: d.CreatedBy,
+		CreatedAt: d.CreatedAt,
+	}
+}
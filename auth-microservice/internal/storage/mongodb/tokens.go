@@ -0,0 +1,319 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"auth/internal/domain/models"
+	"auth/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TokenStorage keeps refresh tokens and the list of revoked access tokens,
+// which also records consumed single-use tokens, and the users whose access
+// tokens were revoked all at once.
+// The collections expire their documents through TTL indexes.
+type TokenStorage struct {
+	refresh *mongo.Collection
+	revoked *mongo.Collection
+	users   *mongo.Collection
+}
+
+type refreshTokenDocument struct {
+	Hash      string     `bson:"_id"`
+	FamilyID  string     `bson:"family_id"`
+	UserID    int64      `bson:"user_id"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+	Revoked   bool       `bson:"revoked"`
+}
+
+type revokedTokenDocument struct {
+	JTI       string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	// RevokedAt is only set for revoked access tokens, consumed single-use
+	// tokens aren't published.
+	RevokedAt *time.Time `bson:"revoked_at,omitempty"`
+}
+
+type userRevocationDocument struct {
+	UserID    int64     `bson:"_id"`
+	NotBefore time.Time `bson:"not_before"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Tokens creates the token storage in the database of the user storage.
+func (s *Storage) Tokens(refreshCollection, revokedCollection, revokedUsersCollection string) (*TokenStorage, error) {
+	const op = "storage.mongodb.Tokens"
+
+	db := s.collection.Database()
+	t := &TokenStorage{
+		refresh: db.Collection(refreshCollection),
+		revoked: db.Collection(revokedCollection),
+		users:   db.Collection(revokedUsersCollection),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	expireAt := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	_, err := t.refresh.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		expireAt,
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create refresh token indexes: %w", op, err)
+	}
+
+	_, err = t.revoked.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		expireAt,
+		{Keys: bson.D{{Key: "revoked_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create revoked token indexes: %w", op, err)
+	}
+
+	_, err = t.users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		expireAt,
+		{Keys: bson.D{{Key: "not_before", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create revoked user indexes: %w", op, err)
+	}
+
+	return t, nil
+}
+
+func (t *TokenStorage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	const op = "storage.mongodb.SaveRefreshToken"
+
+	doc := refreshTokenDocument{
+		Hash:      token.Hash,
+		FamilyID:  token.FamilyID,
+		UserID:    token.UserID,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}
+
+	if _, err := t.refresh.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("%s: insert document: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseRefreshToken atomically marks the token as used and returns it. A token
+// that was used or revoked before is returned together with ErrTokenReused.
+func (t *TokenStorage) UseRefreshToken(ctx context.Context, hash string, now time.Time) (models.RefreshToken, error) {
+	const op = "storage.mongodb.UseRefreshToken"
+
+	filter := bson.D{
+		{Key: "_id", Value: hash},
+		{Key: "used_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "revoked", Value: false},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used_at", Value: now}}}}
+
+	var doc refreshTokenDocument
+	err := t.refresh.FindOneAndUpdate(ctx, filter, update).Decode(&doc)
+	if err == nil {
+		return doc.toModel(), nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.RefreshToken{}, fmt.Errorf("%s: update document: %w", op, err)
+	}
+
+	err = t.refresh.FindOne(ctx, bson.D{{Key: "_id", Value: hash}}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.RefreshToken{}, storage.ErrTokenNotFound
+		}
+		return models.RefreshToken{}, fmt.Errorf("%s: find document: %w", op, err)
+	}
+
+	return doc.toModel(), storage.ErrTokenReused
+}
+
+// GetRefreshToken returns the token without using it.
+func (t *TokenStorage) GetRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	const op = "storage.mongodb.GetRefreshToken"
+
+	var doc refreshTokenDocument
+	err := t.refresh.FindOne(ctx, bson.D{{Key: "_id", Value: hash}}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.RefreshToken{}, storage.ErrTokenNotFound
+		}
+		return models.RefreshToken{}, fmt.Errorf("%s: find document: %w", op, err)
+	}
+
+	return doc.toModel(), nil
+}
+
+// RevokeFamily revokes every refresh token rotated from the same login.
+func (t *TokenStorage) RevokeFamily(ctx context.Context, familyID string) error {
+	const op = "storage.mongodb.RevokeFamily"
+
+	filter := bson.D{{Key: "family_id", Value: familyID}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	if _, err := t.refresh.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("%s: update documents: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens revokes every refresh token of the user, ending all sessions.
+func (t *TokenStorage) RevokeUserTokens(ctx context.Context, userID int64) error {
+	const op = "storage.mongodb.RevokeUserTokens"
+
+	filter := bson.D{{Key: "user_id", Value: userID}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	if _, err := t.refresh.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("%s: update documents: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeToken records the id of a single-use token until it expires. It
+// fails with ErrTokenReused when the token was consumed before.
+func (t *TokenStorage) ConsumeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "storage.mongodb.ConsumeToken"
+
+	_, err := t.revoked.InsertOne(ctx, revokedTokenDocument{JTI: jti, ExpiresAt: expiresAt})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrTokenReused)
+		}
+		return fmt.Errorf("%s: insert document: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeAccessToken puts the token id on the revocation list until the token expires.
+func (t *TokenStorage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "storage.mongodb.RevokeAccessToken"
+
+	now := time.Now()
+	filter := bson.D{{Key: "_id", Value: jti}}
+	update := bson.D{{Key: "$set", Value: revokedTokenDocument{JTI: jti, ExpiresAt: expiresAt, RevokedAt: &now}}}
+
+	_, err := t.revoked.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("%s: upsert document: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeUserAccess revokes the access tokens of the user issued before
+// notBefore. The revocation is kept until expiresAt, when the last of those
+// tokens expires.
+func (t *TokenStorage) RevokeUserAccess(ctx context.Context, userID int64, notBefore, expiresAt time.Time) error {
+	const op = "storage.mongodb.RevokeUserAccess"
+
+	filter := bson.D{{Key: "_id", Value: userID}}
+	update := bson.D{{Key: "$max", Value: bson.D{
+		{Key: "not_before", Value: notBefore},
+		{Key: "expires_at", Value: expiresAt},
+	}}}
+
+	_, err := t.users.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("%s: upsert document: %w", op, err)
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether the token was revoked by its id or
+// together with the other tokens of the user issued before issuedAt.
+func (t *TokenStorage) IsAccessTokenRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	const op = "storage.mongodb.IsAccessTokenRevoked"
+
+	count, err := t.revoked.CountDocuments(ctx, bson.D{{Key: "_id", Value: jti}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("%s: count documents: %w", op, err)
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "not_before", Value: bson.D{{Key: "$gt", Value: issuedAt}}},
+	}
+	count, err = t.users.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("%s: count documents: %w", op, err)
+	}
+
+	return count > 0, nil
+}
+
+// Revocations lists the access tokens and users revoked since the given time.
+func (t *TokenStorage) Revocations(ctx context.Context, since time.Time) (models.Revocations, error) {
+	const op = "storage.mongodb.Revocations"
+
+	var revocations models.Revocations
+
+	cursor, err := t.revoked.Find(ctx, bson.D{{Key: "revoked_at", Value: bson.D{{Key: "$gte", Value: since}}}})
+	if err != nil {
+		return models.Revocations{}, fmt.Errorf("%s: find revoked tokens: %w", op, err)
+	}
+	var tokens []revokedTokenDocument
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return models.Revocations{}, fmt.Errorf("%s: decode revoked tokens: %w", op, err)
+	}
+	for _, doc := range tokens {
+		revocations.Tokens = append(revocations.Tokens, models.RevokedToken{ID: doc.JTI, ExpiresAt: doc.ExpiresAt})
+	}
+
+	cursor, err = t.users.Find(ctx, bson.D{{Key: "not_before", Value: bson.D{{Key: "$gte", Value: since}}}})
+	if err != nil {
+		return models.Revocations{}, fmt.Errorf("%s: find revoked users: %w", op, err)
+	}
+	var users []userRevocationDocument
+	if err := cursor.All(ctx, &users); err != nil {
+		return models.Revocations{}, fmt.Errorf("%s: decode revoked users: %w", op, err)
+	}
+	for _, doc := range users {
+		revocations.Users = append(revocations.Users, models.UserRevocation{
+			UserID:    doc.UserID,
+			NotBefore: doc.NotBefore,
+			ExpiresAt: doc.ExpiresAt,
+		})
+	}
+
+	return revocations, nil
+}
+
+func (doc refreshTokenDocument) toModel() models.RefreshToken {
+	token := models.RefreshToken{
+		Hash:      doc.Hash,
+		FamilyID:  doc.FamilyID,
+		UserID:    doc.UserID,
+		CreatedAt: doc.CreatedAt,
+		ExpiresAt: doc.ExpiresAt,
+		Revoked:   doc.Revoked,
+	}
+	if doc.UsedAt != nil {
+		token.UsedAt = *doc.UsedAt
+	}
+	return token
+}
@@ -0,0 +1,107 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"auth/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetPendingTOTP stores the secret of a two-factor enrollment awaiting confirmation.
+func (s *Storage) SetPendingTOTP(ctx context.Context, id int64, secret string) error {
+	const op = "storage.mongodb.SetPendingTOTP"
+
+	return s.updateUser(ctx, op, id, bson.D{{Key: "totp_pending_secret", Value: secret}})
+}
+
+// EnableTOTP turns the pending secret into the active one and stores the
+// recovery code hashes. It fails with storage.ErrUserNotFound when the
+// pending secret has changed in the meantime.
+func (s *Storage) EnableTOTP(ctx context.Context, id int64, secret string, recoveryCodes []string) error {
+	const op = "storage.mongodb.EnableTOTP"
+
+	res, err := s.collection.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: id}, {Key: "totp_pending_secret", Value: secret}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "totp_secret", Value: secret},
+				{Key: "recovery_codes", Value: recoveryCodes},
+			}},
+			{Key: "$unset", Value: bson.D{
+				{Key: "totp_pending_secret", Value: ""},
+				{Key: "totp_last_step", Value: ""},
+			}},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// DisableTOTP removes the second factor and the recovery codes of the user.
+func (s *Storage) DisableTOTP(ctx context.Context, id int64) error {
+	const op = "storage.mongodb.DisableTOTP"
+
+	res, err := s.collection.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: id}},
+		bson.D{{Key: "$unset", Value: bson.D{
+			{Key: "totp_secret", Value: ""},
+			{Key: "totp_pending_secret", Value: ""},
+			{Key: "totp_last_step", Value: ""},
+			{Key: "recovery_codes", Value: ""},
+		}}},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update document: %w", op, err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// UseTOTPStep atomically records the time step of an accepted code. It
+// reports false when a code of the same or a later step was already used.
+func (s *Storage) UseTOTPStep(ctx context.Context, id int64, step int64) (bool, error) {
+	const op = "storage.mongodb.UseTOTPStep"
+
+	res, err := s.collection.UpdateOne(ctx,
+		bson.D{
+			{Key: "user_id", Value: id},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "totp_last_step", Value: bson.D{{Key: "$exists", Value: false}}}},
+				bson.D{{Key: "totp_last_step", Value: bson.D{{Key: "$lt", Value: step}}}},
+			}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "totp_last_step", Value: step}}}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: update document: %w", op, err)
+	}
+
+	return res.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode atomically removes the recovery code hash. It reports
+// false when the user has no such unused code.
+func (s *Storage) UseRecoveryCode(ctx context.Context, id int64, hash string) (bool, error) {
+	const op = "storage.mongodb.UseRecoveryCode"
+
+	res, err := s.collection.UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: id}, {Key: "recovery_codes", Value: hash}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "recovery_codes", Value: hash}}}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: update document: %w", op, err)
+	}
+
+	return res.ModifiedCount == 1, nil
+}
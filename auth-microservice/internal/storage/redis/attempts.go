@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AttemptStore keeps failed login counters and lockouts in Redis so that all
+// instances of the service share them.
+type AttemptStore struct {
+	client *redis.Client
+}
+
+func New(addr string) (*AttemptStore, error) {
+	const op = "storage.redis.New"
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("%s: ping: %w", op, err)
+	}
+
+	return &AttemptStore{client: rdb}, nil
+}
+
+// incrementScript increments the counter and starts its window on the first increment.
+var incrementScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// Increment counts a failure under key and returns the failures within the window.
+func (s *AttemptStore) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	const op = "storage.redis.Increment"
+
+	n, err := incrementScript.Run(ctx, s.client, []string{attemptsKey(key)}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return n, nil
+}
+
+func (s *AttemptStore) Reset(ctx context.Context, key string) error {
+	const op = "storage.redis.Reset"
+
+	if err := s.client.Del(ctx, attemptsKey(key)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Lock locks key for d.
+func (s *AttemptStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	const op = "storage.redis.Lock"
+
+	if err := s.client.Set(ctx, lockKey(key), 1, d).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LockedFor returns how long key stays locked, zero when it isn't.
+func (s *AttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	const op = "storage.redis.LockedFor"
+
+	ttl, err := s.client.PTTL(ctx, lockKey(key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	// Negative values mean there is no lock (-2) or it never expires (-1),
+	// locks are always set with an expiry so both count as unlocked.
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+func (s *AttemptStore) Close() error {
+	return s.client.Close()
+}
+
+func attemptsKey(key string) string { return "login:attempts:" + key }
+func lockKey(key string) string     { return "login:lock:" + key }
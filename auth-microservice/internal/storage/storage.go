@@ -5,6 +5,14 @@ import (
 )
 
 var (
-	ErrUserNotFound = fmt.Errorf("user not found")
-	ErrUserExists   = fmt.Errorf("user already exists")
+	ErrUserNotFound   = fmt.Errorf("user not found")
+	ErrUserExists     = fmt.Errorf("user already exists")
+	ErrTokenNotFound  = fmt.Errorf("token not found")
+	ErrTokenReused    = fmt.Errorf("token already used")
+	ErrAPIKeyNotFound = fmt.Errorf("api key not found")
+
+	ErrOrgNotFound        = fmt.Errorf("organization not found")
+	ErrMemberNotFound     = fmt.Errorf("member not found")
+	ErrMemberExists       = fmt.Errorf("already a member")
+	ErrInvitationNotFound = fmt.Errorf("invitation not found")
 )
@@ -28,5 +28,11 @@ func main() {
 	<-done
 
 	application.GRPCServer.Stop()
+	application.Analytics.Close()
+	application.Cache.Close()
+	application.Redis.Close()
+	if application.Auth != nil {
+		application.Auth.Close()
+	}
 	log.Info("Gracefully stopped")
 }
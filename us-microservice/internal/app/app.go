@@ -1,29 +1,197 @@
 package app
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"log/slog"
 	grpcapp "urlSh/internal/app/grpc"
+	"urlSh/internal/clients/auth"
 	"urlSh/internal/config"
+	"urlSh/internal/geoip"
+	"urlSh/internal/grpc/server"
 	"urlSh/internal/services"
 	"urlSh/internal/storage/mongodb"
 	"urlSh/internal/storage/redis"
+	"urlSh/internal/storage/tiered"
+
+	"github.com/yerlans/us-protos/jwks"
+)
+
+// envLocal is the environment of local development, the only one where the
+// user metadata of the gateway is trusted without verifying tokens.
+const envLocal = "local"
+
+// Policies of config.Cache.OnFailure.
+const (
+	cacheFailureFail    = "fail"
+	cacheFailureDegrade = "degrade"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	Analytics  *services.Analytics
+	Cache      *tiered.Cache
+	Redis      *redis.Cache
+	// Auth is nil when tokens aren't verified.
+	Auth *auth.Client
 }
 
 func New(log *slog.Logger, cfg *config.Config) *App {
-	storage, err := mongodb.New(cfg.Storage.Path, cfg.Storage.Database, cfg.Storage.Collection)
+	storage, err := mongodb.New(cfg.Storage.Path, cfg.Storage.Database, cfg.Storage.Collection,
+		cfg.Storage.ExpiredRetention)
 	if err != nil {
 		panic(err)
 	}
-	cache, err := redis.New(cfg.CachePath)
-	urlService := services.New(log, storage, cache, cfg.Ttl)
+	clickStorage, err := storage.Analytics(cfg.Analytics.EventsCollection, cfg.Analytics.StatsCollection, cfg.Analytics.Retention)
+	if err != nil {
+		panic(err)
+	}
+	locator, err := geoip.New(cfg.Analytics.GeoIPPath)
+	if err != nil {
+		panic(err)
+	}
+	analytics := services.NewAnalytics(log, clickStorage, locator, ipSalt(log, cfg.Analytics.IPSalt),
+		cfg.Analytics.BufferSize, cfg.Analytics.Workers, cfg.Analytics.Timeout)
+	redisCache := connectRedis(log, cfg.Cache)
+	cache := tiered.New(log, redisCache, storage.GetURL, tiered.Options{
+		LocalSize:     cfg.Cache.LocalSize,
+		LocalTTL:      cfg.Cache.LocalTTL,
+		RemoteTTL:     cfg.Ttl,
+		NegativeTTL:   cfg.Cache.NegativeTTL,
+		StatsInterval: cfg.Cache.StatsInterval,
+		RetryInterval: cfg.Cache.RetryInterval,
+		LoadTimeout:   cfg.Cache.LoadTimeout,
+		Degrade:       cfg.Cache.OnFailure == cacheFailureDegrade,
+	})
+	generator, err := services.NewAliasGenerator(cfg.Generator.Strategy, cfg.Generator.NodeID)
+	if err != nil {
+		panic(err)
+	}
+	urlService := services.New(log, storage, cache, cfg.Ttl, services.AliasPolicy{
+		MinLength: cfg.Alias.MinLength,
+		MaxLength: cfg.Alias.MaxLength,
+		Reserved:  cfg.Alias.Reserved,
+	}, services.GenerationPolicy{
+		Generator:   generator,
+		Length:      cfg.Generator.Length,
+		MaxLength:   cfg.Generator.MaxLength,
+		MaxAttempts: cfg.Generator.MaxAttempts,
+	}, cfg.Dedup, analytics)
 
-	grpcApp := grpcapp.New(log, cfg, urlService)
+	authClient := orgRolesClient(cfg.Auth)
+	var roles server.OrgRoleSource
+	if authClient != nil {
+		roles = authClient
+	}
+	grpcApp := grpcapp.New(log, cfg, urlService, tokenVerifier(log, cfg), roles)
 
 	return &App{
 		GRPCServer: grpcApp,
+		Analytics:  analytics,
+		Cache:      cache,
+		Redis:      redisCache,
+		Auth:       authClient,
+	}
+}
+
+// orgRolesClient connects to the auth service the org roles of verified
+// tokens are checked with, it returns nil when tokens aren't verified.
+func orgRolesClient(cfg config.Auth) *auth.Client {
+	if cfg.JWKSURL == "" {
+		return nil
+	}
+	if cfg.Address == "" {
+		panic("auth.address is required with auth.jwks_url")
+	}
+
+	client, err := auth.New(cfg.Address, cfg.Timeout, cfg.OrgRolesTTL)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// tokenVerifier returns the verifier of the tokens forwarded by the gateway.
+// Without a JWKS URL any caller could claim to be any user, this is only
+// allowed in the local environment.
+func tokenVerifier(log *slog.Logger, cfg *config.Config) *jwks.Verifier {
+	if cfg.Auth.JWKSURL != "" {
+		if cfg.Auth.RevocationsURL == "" {
+			panic("auth.revocations_url is required with auth.jwks_url")
+		}
+		return jwks.NewVerifier(jwks.Options{
+			URL:                cfg.Auth.JWKSURL,
+			Issuer:             cfg.Auth.Issuer,
+			Refresh:            cfg.Auth.Refresh,
+			Timeout:            cfg.Auth.Timeout,
+			RevocationsURL:     cfg.Auth.RevocationsURL,
+			RevocationsRefresh: cfg.Auth.RevocationsRefresh,
+		})
+	}
+	if cfg.Env != envLocal {
+		panic("auth.jwks_url is required outside the local environment")
 	}
+
+	log.Warn("no jwks url configured, trusting the user metadata of callers")
+	return nil
+}
+
+// ipSalt returns the configured salt of hashed client IPs or, without one, a
+// random salt: hashes then differ between instances and restarts.
+func ipSalt(log *slog.Logger, salt string) string {
+	if salt != "" {
+		return salt
+	}
+
+	log.Warn("no analytics ip salt configured, using an ephemeral salt")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// connectRedis connects to the remote tier of the link cache. When Redis is
+// unavailable it panics with the fail policy, when degrading the client keeps
+// reconnecting in the background.
+func connectRedis(log *slog.Logger, cfg config.Cache) *redis.Cache {
+	if cfg.OnFailure != cacheFailureFail && cfg.OnFailure != cacheFailureDegrade {
+		panic("unknown cache failure policy: " + cfg.OnFailure)
+	}
+
+	r := cfg.Redis
+	cache, err := redis.New(redis.Options{
+		Addr:         r.Addr,
+		Username:     r.Username,
+		Password:     r.Password,
+		DB:           r.DB,
+		PoolSize:     r.PoolSize,
+		MinIdleConns: r.MinIdleConns,
+		DialTimeout:  r.DialTimeout,
+		ReadTimeout:  r.ReadTimeout,
+		WriteTimeout: r.WriteTimeout,
+		TLS: redis.TLSOptions{
+			Enabled:            r.TLS.Enabled,
+			CAPath:             r.TLS.CAPath,
+			ServerName:         r.TLS.ServerName,
+			InsecureSkipVerify: r.TLS.InsecureSkipVerify,
+		},
+		SentinelMaster:   r.Sentinel.Master,
+		SentinelAddrs:    r.Sentinel.Addrs,
+		SentinelUsername: r.Sentinel.Username,
+		SentinelPassword: r.Sentinel.Password,
+		ClusterAddrs:     r.Cluster.Addrs,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := cache.Ping(context.Background()); err != nil {
+		if cfg.OnFailure == cacheFailureFail {
+			panic(err)
+		}
+		log.Warn("redis unavailable, caching links in process until it answers", slog.String("err", err.Error()))
+	}
+
+	return cache
 }
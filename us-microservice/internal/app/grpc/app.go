@@ -10,9 +10,12 @@ import (
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	pb "github.com/yerlans/us-protos/gen/us-service"
+	"github.com/yerlans/us-protos/jwks"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type App struct {
@@ -26,7 +29,8 @@ func New(
 	log *slog.Logger,
 	config *config.Config,
 	urlService server.URLShortener,
-
+	verifier *jwks.Verifier,
+	roles server.OrgRoleSource,
 ) *App {
 	loggingOpts := []logging.Option{
 		logging.WithLogOnEvents(
@@ -44,6 +48,7 @@ func New(
 	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
 		recovery.UnaryServerInterceptor(recoveryOpts...),
 		logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
+		server.IdentityInterceptor(verifier, roles),
 	), grpc.ConnectionTimeout(config.Grpc.Timeout))
 
 	server.Register(gRPCServer, urlService)
@@ -59,10 +64,25 @@ func New(
 // This code is simple enough to be copied and not imported.
 func InterceptorLogger(l *slog.Logger) logging.Logger {
 	return logging.LoggerFunc(func(ctx context.Context, lvl logging.Level, msg string, fields ...any) {
-		l.Log(ctx, slog.Level(lvl), msg, fields...)
+		l.Log(ctx, slog.Level(lvl), msg, redact(fields)...)
 	})
 }
 
+// redact removes the visitor of resolved links from logged requests, the
+// client IP and user agent are personal data.
+func redact(fields []any) []any {
+	for i := 1; i < len(fields); i += 2 {
+		req, ok := fields[i].(*pb.GetOriginalUrlRequest)
+		if !ok {
+			continue
+		}
+		req = proto.Clone(req).(*pb.GetOriginalUrlRequest)
+		req.ClientIp, req.UserAgent, req.Referrer = "", "", ""
+		fields[i] = req
+	}
+	return fields
+}
+
 // MustRun runs gRPC server and panics if any error occurs.
 func (a *App) MustRun() {
 	if err := a.Run(); err != nil {
@@ -0,0 +1,72 @@
+// Package auth is the client of the auth service, the URL shortener service
+// calls it to check the organization roles of locally verified tokens.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	au "github.com/yerlans/us-protos/gen/auth-service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// orgRolesCacheSize bounds the number of tokens whose org roles are reused.
+const orgRolesCacheSize = 10000
+
+type Client struct {
+	conn    *grpc.ClientConn
+	api     au.AuthServiceClient
+	timeout time.Duration
+	// roles reuses the org roles of a token for a short time, keyed by the
+	// hash of the token.
+	roles *expirable.LRU[[sha256.Size]byte, map[string]string]
+}
+
+// New creates the client. The org roles of a token are reused for rolesTTL,
+// a role change takes up to that long to take effect.
+func New(addr string, timeout, rolesTTL time.Duration) (*Client, error) {
+	const op = "clients.auth.New"
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Client{
+		conn:    conn,
+		api:     au.NewAuthServiceClient(conn),
+		timeout: timeout,
+		roles:   expirable.NewLRU[[sha256.Size]byte, map[string]string](orgRolesCacheSize, nil, rolesTTL),
+	}, nil
+}
+
+// OrgRoles returns the current organization roles of the user of the token,
+// mapping the organization IDs to the role in it. Revoked tokens and
+// disabled users fail with codes.Unauthenticated.
+func (c *Client) OrgRoles(ctx context.Context, token string) (map[string]string, error) {
+	const op = "clients.auth.OrgRoles"
+
+	key := sha256.Sum256([]byte(token))
+	if roles, ok := c.roles.Get(key); ok {
+		return roles, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.api.GetOrgRoles(ctx, &au.GetOrgRolesRequest{Token: token})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.roles.Add(key, resp.GetOrgs())
+	return resp.GetOrgs(), nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
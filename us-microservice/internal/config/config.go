@@ -11,15 +11,133 @@ import (
 type Config struct {
 	Env       string        `yaml:"env"`
 	Storage   Storage       `yaml:"storage"`
-	CachePath string        `yaml:"cache_path"`
+	Cache     Cache         `yaml:"cache"`
 	Grpc      Grpc          `yaml:"grpc"`
 	Ttl       time.Duration `yaml:"ttl"`
+	Alias     Alias         `yaml:"alias"`
+	Generator Generator     `yaml:"generator"`
+	// Dedup makes shortening an already known URL return the existing alias.
+	Dedup     bool      `yaml:"dedup"`
+	Analytics Analytics `yaml:"analytics"`
+	Auth      Auth      `yaml:"auth"`
+}
+
+// Auth configures how the calling user is identified. With a JWKS URL the
+// token forwarded by the gateway is verified locally, otherwise the user ID
+// metadata set by the gateway is trusted as is. The URL is required unless
+// the environment is "local". Verified tokens listing organizations have
+// their org roles checked with the auth service at Address, which is required
+// with a JWKS URL. So is RevocationsURL, the list of revoked tokens synced
+// every RevocationsRefresh.
+type Auth struct {
+	JWKSURL            string        `yaml:"jwks_url"`
+	Issuer             string        `yaml:"issuer" env-default:"auth"`
+	Refresh            time.Duration `yaml:"refresh" env-default:"5m"`
+	Timeout            time.Duration `yaml:"timeout" env-default:"3s"`
+	RevocationsURL     string        `yaml:"revocations_url"`
+	RevocationsRefresh time.Duration `yaml:"revocations_refresh" env-default:"5s"`
+	Address            string        `yaml:"address"`
+	// OrgRolesTTL is how long the checked org roles of a token are reused.
+	OrgRolesTTL time.Duration `yaml:"org_roles_ttl" env-default:"10s"`
+}
+
+// Cache configures the link cache, an in-process tier in front of Redis.
+// Links changed through another instance are seen once the local entries
+// expire, keep LocalTTL short.
+type Cache struct {
+	Redis Redis `yaml:"redis"`
+	// OnFailure is "fail" to refuse to start without Redis and to fail
+	// requests it can't serve, or "degrade" to go on without it. Either way
+	// cached copies of changed links that Redis failed to remove are retried.
+	OnFailure string        `yaml:"on_failure" env-default:"degrade"`
+	LocalSize int           `yaml:"local_size" env-default:"10000"`
+	LocalTTL  time.Duration `yaml:"local_ttl" env-default:"30s"`
+	// NegativeTTL is how long unknown aliases are remembered, so that probing
+	// random aliases doesn't reach the database. Zero disables it.
+	NegativeTTL time.Duration `yaml:"negative_ttl" env-default:"10s"`
+	// StatsInterval is how often hit and miss counts are logged, never when zero.
+	StatsInterval time.Duration `yaml:"stats_interval" env-default:"5m"`
+	// RetryInterval is how often removals of changed links that Redis failed
+	// are retried.
+	RetryInterval time.Duration `yaml:"retry_interval" env-default:"1s"`
+	// LoadTimeout bounds the lookup of a link missing from the local cache,
+	// shared by the requests waiting for it.
+	LoadTimeout time.Duration `yaml:"load_timeout" env-default:"5s"`
+}
+
+// Redis configures the connection to a single server at Addr, to a master
+// through sentinels when Sentinel.Master is set, or to a cluster when
+// Cluster.Addrs are.
+type Redis struct {
+	Addr     string `yaml:"addr" env-default:"localhost:6379"`
+	Username string `yaml:"username" env:"REDIS_USERNAME"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db"`
+	// PoolSize and MinIdleConns keep the defaults of go-redis when zero.
+	PoolSize     int           `yaml:"pool_size"`
+	MinIdleConns int           `yaml:"min_idle_conns"`
+	DialTimeout  time.Duration `yaml:"dial_timeout" env-default:"5s"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" env-default:"3s"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"3s"`
+	TLS          RedisTLS      `yaml:"tls"`
+	Sentinel     Sentinel      `yaml:"sentinel"`
+	Cluster      Cluster       `yaml:"cluster"`
+}
+
+type RedisTLS struct {
+	Enabled bool `yaml:"enabled"`
+	// CAPath is a PEM bundle trusted besides the system roots.
+	CAPath             string `yaml:"ca_path"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type Sentinel struct {
+	Master   string   `yaml:"master"`
+	Addrs    []string `yaml:"addrs"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password" env:"REDIS_SENTINEL_PASSWORD"`
+}
+
+type Cluster struct {
+	Addrs []string `yaml:"addrs"`
 }
 
 type Storage struct {
 	Path       string `yaml:"path"`
 	Database   string `yaml:"db"`
 	Collection string `yaml:"collection"`
+	// ExpiredRetention is how long expired links keep answering as expired,
+	// and their aliases stay taken, before they are purged.
+	ExpiredRetention time.Duration `yaml:"expired_retention" env-default:"720h"`
+}
+
+type Alias struct {
+	MinLength int      `yaml:"min_length" env-default:"3"`
+	MaxLength int      `yaml:"max_length" env-default:"32"`
+	Reserved  []string `yaml:"reserved"`
+}
+
+type Generator struct {
+	// Strategy is one of "random", "snowflake" or "hash".
+	Strategy    string `yaml:"strategy" env-default:"random"`
+	Length      int    `yaml:"length" env-default:"5"`
+	MaxLength   int    `yaml:"max_length" env-default:"12"`
+	MaxAttempts int    `yaml:"max_attempts" env-default:"10"`
+	NodeID      int64  `yaml:"node_id"`
+}
+
+type Analytics struct {
+	EventsCollection string        `yaml:"events_collection" env-default:"clicks"`
+	StatsCollection  string        `yaml:"stats_collection" env-default:"click_stats"`
+	Retention        time.Duration `yaml:"retention" env-default:"720h"`
+	// GeoIPPath is the path to a GeoLite2/GeoIP2 Country database, countries are not resolved when empty.
+	GeoIPPath string `yaml:"geoip_path"`
+	// IPSalt salts the hashes of client IPs, a random one is used when empty.
+	IPSalt     string        `yaml:"ip_salt" env:"ANALYTICS_IP_SALT"`
+	BufferSize int           `yaml:"buffer_size" env-default:"1024"`
+	Workers    int           `yaml:"workers" env-default:"2"`
+	Timeout    time.Duration `yaml:"timeout" env-default:"5s"`
 }
 
 type Grpc struct {
@@ -0,0 +1,21 @@
+package models
+
+// CacheStats counts link cache lookups per tier since the start.
+type CacheStats struct {
+	LocalHits    int64
+	LocalMisses  int64
+	RemoteHits   int64
+	RemoteMisses int64
+	// NegativeHits counts lookups of aliases remembered as unknown, in
+	// either tier.
+	NegativeHits int64
+	// Loads counts lookups that went to the database, coalesced lookups of
+	// the same alias count once.
+	Loads      int64
+	LoadErrors int64
+	// PendingInvalidations is the number of links waiting to be removed
+	// from the remote tier.
+	PendingInvalidations int
+	// LocalSize is the number of links held in process.
+	LocalSize int
+}
@@ -0,0 +1,87 @@
+package models
+
+import "slices"
+
+// Permissions granted by the auth service that widen access beyond own links.
+const (
+	PermLinksReadAny  = "links:read:any"
+	PermLinksWriteAny = "links:write:any"
+)
+
+// Scopes of tokens minted for a single purpose, they carry neither role nor
+// permissions and are only accepted by the calls they were minted for.
+const (
+	// ScopeLinksCreate is granted to API keys that shorten URLs.
+	ScopeLinksCreate = "links:create"
+	// ScopeAccountDelete is presented by the auth service removing the links
+	// of a deleted account.
+	ScopeAccountDelete = "account:delete"
+	// ScopeLinksTransfer is presented by the auth service handing over the
+	// links of a member leaving an organization.
+	ScopeLinksTransfer = "links:transfer"
+)
+
+// Roles of organization members. Every member reads and creates the links of
+// the organization, admins and owners change any of them.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Caller is the user a request is made on behalf of. The zero value is an
+// anonymous caller.
+type Caller struct {
+	UserID      string
+	Role        string
+	Permissions []string
+	// Orgs maps the IDs of the organizations of the caller to their role in it.
+	Orgs map[string]string
+	// Scopes limit the calls of a caller with a scoped token, see Scoped.
+	Scopes []string
+}
+
+// Can reports whether the caller holds the permission.
+func (c Caller) Can(permission string) bool {
+	return slices.Contains(c.Permissions, permission)
+}
+
+// Scoped reports whether the caller presented a token minted for a single
+// purpose.
+func (c Caller) Scoped() bool {
+	return len(c.Scopes) > 0
+}
+
+// HasScope reports whether the token of the caller was minted for scope.
+func (c Caller) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// Owns reports whether the link belongs to the caller.
+func (c Caller) Owns(link Link) bool {
+	return c.UserID != "" && link.OwnerID == c.UserID
+}
+
+// MemberOf reports whether the caller is a member of the organization.
+func (c Caller) MemberOf(orgID string) bool {
+	return orgID != "" && c.Orgs[orgID] != ""
+}
+
+// ManagesOrg reports whether the caller is an admin or owner of the organization.
+func (c Caller) ManagesOrg(orgID string) bool {
+	role := c.Orgs[orgID]
+	return orgID != "" && (role == OrgRoleAdmin || role == OrgRoleOwner)
+}
+
+// CanAccess reports whether the caller may read the link, or change it with
+// write. Besides the owner and callers with the matching permission, members
+// of the link's organization read it and its admins change it.
+func (c Caller) CanAccess(link Link, write bool) bool {
+	if c.Owns(link) {
+		return true
+	}
+	if write {
+		return c.Can(PermLinksWriteAny) || c.ManagesOrg(link.OrgID)
+	}
+	return c.Can(PermLinksReadAny) || c.MemberOf(link.OrgID)
+}
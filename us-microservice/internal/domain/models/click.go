@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Visitor describes who followed a short link, as reported by the gateway.
+type Visitor struct {
+	Referrer  string
+	UserAgent string
+	IP        string
+}
+
+// Click is a single resolution of a short link.
+type Click struct {
+	// LinkID is the link resolved when the click happened, Alias is kept
+	// for logging.
+	LinkID    string
+	Alias     string
+	Time      time.Time
+	Referrer  string
+	UserAgent string
+	// IPHash is the salted hash of the client IP, the IP itself is never stored.
+	IPHash  string
+	Country string
+}
+
+// LinkStats are aggregated click statistics of a link.
+type LinkStats struct {
+	TotalClicks int64
+	LastClickAt time.Time
+	Buckets     []TimeBucket
+	Countries   []Counter
+	Referrers   []Counter
+}
+
+// TimeBucket is the number of clicks in the hour starting at Start.
+type TimeBucket struct {
+	Start  time.Time
+	Clicks int64
+}
+
+// Counter is the number of clicks attributed to Key.
+type Counter struct {
+	Key    string
+	Clicks int64
+}
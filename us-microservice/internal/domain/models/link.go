@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+type Link struct {
+	// ID identifies the stored link, clicks are recorded under it. A link
+	// created later under the same alias has another ID.
+	ID    string
+	Alias string
+	URL   string
+	// NormalizedURL is URL in canonical form, used to find duplicates.
+	NormalizedURL string
+	OwnerID       string
+	// OrgID is the organization the link is shared in, empty for personal links.
+	OrgID     string
+	Permanent bool
+	// ExpiresAt is the moment the link stops resolving, zero means never.
+	ExpiresAt time.Time
+	// MaxClicks is the number of resolutions allowed, zero means unlimited.
+	MaxClicks int64
+	Clicks    int64
+	// TotalClicks counts all recorded resolutions, see Click.
+	TotalClicks int64
+	CreatedAt   time.Time
+	// Disabled links are kept but don't resolve, only administrators set it.
+	Disabled bool
+}
+
+// LinkUpdate lists the link settings to change, nil fields stay as they are.
+// A zero ExpiresAt or MaxClicks removes the limit.
+type LinkUpdate struct {
+	URL *string
+	// NormalizedURL is set together with URL.
+	NormalizedURL *string
+	Permanent     *bool
+	ExpiresAt     *time.Time
+	MaxClicks     *int64
+	Disabled      *bool
+}
+
+// LinkQuery selects whose links are listed. The zero value lists the
+// caller's own personal links.
+type LinkQuery struct {
+	// All lists the links of every owner.
+	All     bool
+	OwnerID string
+	// OrgID lists the links of an organization.
+	OrgID string
+}
+
+// Expired reports whether the link can no longer be resolved at the given time.
+func (l Link) Expired(now time.Time) bool {
+	if !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt) {
+		return true
+	}
+	return l.MaxClicks > 0 && l.Clicks >= l.MaxClicks
+}
@@ -0,0 +1,59 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Locator resolves client IPs to ISO country codes using a local
+// MaxMind GeoIP2/GeoLite2 Country database file.
+type Locator struct {
+	reader *geoip2.Reader
+}
+
+// New opens the database at path. An empty path returns a Locator
+// that never knows the country.
+func New(path string) (*Locator, error) {
+	const op = "geoip.New"
+
+	if path == "" {
+		return &Locator{}, nil
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: open database: %w", op, err)
+	}
+
+	return &Locator{reader: reader}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip belongs to,
+// or an empty string when it is unknown.
+func (l *Locator) Country(ip string) string {
+	if l.reader == nil {
+		return ""
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	record, err := l.reader.Country(parsed)
+	if err != nil {
+		return ""
+	}
+
+	return record.Country.IsoCode
+}
+
+// Close closes the database file.
+func (l *Locator) Close() error {
+	if l.reader == nil {
+		return nil
+	}
+	return l.reader.Close()
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"urlSh/internal/domain/models"
+
+	pb "github.com/yerlans/us-protos/gen/us-service"
+	"github.com/yerlans/us-protos/jwks"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// userIDMetadataKey carries the ID of the authenticated user. It is set by the
+// API gateway after validating the user's token. Without a token verifier the
+// service trusts it as is.
+const userIDMetadataKey = "x-user-id"
+
+// Role, permissions and scopes of the user, comma separated, set by the
+// gateway next to the user ID. The organizations of the user are listed as
+// comma separated "id:role" pairs.
+const (
+	roleMetadataKey        = "x-user-role"
+	permissionsMetadataKey = "x-user-permissions"
+	orgsMetadataKey        = "x-user-orgs"
+	scopesMetadataKey      = "x-user-scopes"
+)
+
+// scopedMethods lists the only calls accepted from callers with a scoped
+// token, together with the scope the token must have been minted for.
+var scopedMethods = map[string]string{
+	pb.UrlShorteningService_ShortenUrl_FullMethodName:       models.ScopeLinksCreate,
+	pb.UrlShorteningService_DeleteUserLinks_FullMethodName:  models.ScopeAccountDelete,
+	pb.UrlShorteningService_TransferOrgLinks_FullMethodName: models.ScopeLinksTransfer,
+}
+
+// authorizationMetadataKey carries the user's bearer token forwarded by the gateway.
+const authorizationMetadataKey = "authorization"
+
+// OrgRoleSource returns the current organization roles of the user of a
+// token, see auth.Client.
+type OrgRoleSource interface {
+	OrgRoles(ctx context.Context, token string) (map[string]string, error)
+}
+
+type callerKey struct{}
+
+// callerFromContext returns the user the call is made on behalf of, the zero
+// Caller for anonymous calls.
+func callerFromContext(ctx context.Context) models.Caller {
+	caller, _ := ctx.Value(callerKey{}).(models.Caller)
+	return caller
+}
+
+// userIDFromContext returns the ID of the user the call is made on behalf of,
+// or an empty string for anonymous calls.
+func userIDFromContext(ctx context.Context) string {
+	return callerFromContext(ctx).UserID
+}
+
+// IdentityInterceptor resolves the user of a call. With a verifier the
+// forwarded bearer token is verified against the auth service's keys,
+// otherwise the user metadata of the gateway is used. The org roles of a
+// verified token are replaced with the current ones from roles, a member
+// removed or demoted since the token was issued mustn't keep the old role.
+// Callers with a scoped token are rejected on calls it wasn't minted for.
+func IdentityInterceptor(verifier *jwks.Verifier, roles OrgRoleSource) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var caller models.Caller
+		if verifier == nil {
+			caller.UserID = metadataValue(ctx, userIDMetadataKey)
+			if caller.UserID != "" {
+				caller.Role = metadataValue(ctx, roleMetadataKey)
+				caller.Permissions = splitPermissions(metadataValue(ctx, permissionsMetadataKey))
+				caller.Orgs = parseOrgs(metadataValue(ctx, orgsMetadataKey))
+				caller.Scopes = splitPermissions(metadataValue(ctx, scopesMetadataKey))
+			}
+		} else if token, ok := strings.CutPrefix(metadataValue(ctx, authorizationMetadataKey), "Bearer "); ok {
+			claims, err := verifier.Verify(ctx, token)
+			if err != nil {
+				if errors.Is(err, jwks.ErrUnavailable) {
+					return nil, status.Error(codes.Unavailable, "token keys unavailable")
+				}
+				return nil, status.Error(codes.Unauthenticated, "invalid token")
+			}
+			if len(claims.Orgs) > 0 && roles != nil {
+				claims.Orgs, err = roles.OrgRoles(ctx, token)
+				if err != nil {
+					if status.Code(err) == codes.Unauthenticated {
+						return nil, status.Error(codes.Unauthenticated, "invalid token")
+					}
+					return nil, status.Error(codes.Unavailable, "org roles unavailable")
+				}
+			}
+			caller = models.Caller{
+				UserID:      strconv.FormatInt(claims.UserID, 10),
+				Role:        claims.Role,
+				Permissions: claims.Permissions,
+				Orgs:        claims.Orgs,
+				Scopes:      claims.Scopes,
+			}
+		}
+		if caller.Scoped() && !caller.HasScope(scopedMethods[info.FullMethod]) {
+			return nil, status.Error(codes.PermissionDenied, "token not valid for this call")
+		}
+
+		return handler(context.WithValue(ctx, callerKey{}, caller), req)
+	}
+}
+
+// splitPermissions splits comma separated permissions or scopes.
+func splitPermissions(value string) []string {
+	var permissions []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+// parseOrgs parses the "id:role" pairs of the organizations metadata.
+func parseOrgs(value string) map[string]string {
+	var orgs map[string]string
+	for _, pair := range strings.Split(value, ",") {
+		id, role, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" || role == "" {
+			continue
+		}
+		if orgs == nil {
+			orgs = make(map[string]string)
+		}
+		orgs[id] = role
+	}
+	return orgs
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/yerlans/us-protos/gen/us-service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestIdentityInterceptorScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		scopes string
+		want   codes.Code
+	}{
+		{"unscoped caller", pb.UrlShorteningService_ListLinks_FullMethodName, "", codes.OK},
+		{"api key shortens", pb.UrlShorteningService_ShortenUrl_FullMethodName, "links:create", codes.OK},
+		{"api key lists links", pb.UrlShorteningService_ListLinks_FullMethodName, "links:create", codes.PermissionDenied},
+		{"api key deletes user links", pb.UrlShorteningService_DeleteUserLinks_FullMethodName, "links:create", codes.PermissionDenied},
+		{"account deletion", pb.UrlShorteningService_DeleteUserLinks_FullMethodName, "account:delete", codes.OK},
+		{"account deletion token deletes a link", pb.UrlShorteningService_DeleteLink_FullMethodName, "account:delete", codes.PermissionDenied},
+		{"link transfer", pb.UrlShorteningService_TransferOrgLinks_FullMethodName, "links:transfer", codes.OK},
+		{"link transfer token deletes user links", pb.UrlShorteningService_DeleteUserLinks_FullMethodName, "links:transfer", codes.PermissionDenied},
+	}
+
+	interceptor := IdentityInterceptor(nil, nil)
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				userIDMetadataKey, "42",
+				scopesMetadataKey, tt.scopes,
+			))
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
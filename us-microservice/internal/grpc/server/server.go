@@ -7,12 +7,24 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"net/url"
+	"time"
+	"urlSh/internal/domain/models"
+	"urlSh/internal/services"
 	"urlSh/internal/storage"
 )
 
 type URLShortener interface {
-	ShortenURL(ctx context.Context, originalURL string) (shortURL string, err error)
-	GetOriginalURL(ctx context.Context, shortURL string) (originalURL string, err error)
+	ShortenURL(ctx context.Context, caller models.Caller, link models.Link) (shortURL string, err error)
+	GetOriginalURL(ctx context.Context, shortURL string, visitor models.Visitor, peek bool) (link models.Link, err error)
+	LinkStats(ctx context.Context, caller models.Caller, shortURL string, from, to time.Time) (models.LinkStats, error)
+	ListLinks(ctx context.Context, caller models.Caller, query models.LinkQuery, limit, offset int64) ([]models.Link, int64, error)
+	GetLink(ctx context.Context, caller models.Caller, shortURL string) (models.Link, error)
+	UpdateLink(ctx context.Context, caller models.Caller, shortURL string, update models.LinkUpdate) (models.Link, error)
+	DeleteLink(ctx context.Context, caller models.Caller, shortURL string) error
+	DeleteUserLinks(ctx context.Context, caller models.Caller, anonymize bool) (int64, error)
+	TransferOrgLinks(ctx context.Context, caller models.Caller, orgID, fromOwnerID, toOwnerID string) (int64, error)
+	CacheStats(caller models.Caller) (models.CacheStats, error)
 }
 
 type serverAPI struct {
@@ -31,9 +43,39 @@ func (s *serverAPI) ShortenUrl(
 	if in.OriginalUrl == "" {
 		return nil, status.Error(codes.InvalidArgument, "original_url is required")
 	}
+	if !validURL(in.GetOriginalUrl()) {
+		return nil, status.Error(codes.InvalidArgument, "original_url must be an absolute http or https URL")
+	}
+
+	caller := callerFromContext(ctx)
+	link := models.Link{
+		Alias:     in.GetAlias(),
+		URL:       in.GetOriginalUrl(),
+		OwnerID:   caller.UserID,
+		OrgID:     in.GetOrgId(),
+		Permanent: in.GetPermanent(),
+		MaxClicks: in.GetMaxClicks(),
+	}
+	if in.GetExpiresAt() != 0 {
+		link.ExpiresAt = time.Unix(in.GetExpiresAt(), 0)
+	}
 
-	shortURL, err := s.shortener.ShortenURL(ctx, in.GetOriginalUrl())
+	shortURL, err := s.shortener.ShortenURL(ctx, caller, link)
 	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidExpiration), errors.Is(err, services.ErrInvalidMaxClicks):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, services.ErrInvalidAlias):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, services.ErrReservedAlias):
+			return nil, status.Error(codes.InvalidArgument, "alias is reserved")
+		case errors.Is(err, storage.ErrURLExists):
+			return nil, status.Error(codes.AlreadyExists, "alias is already taken")
+		case errors.Is(err, services.ErrAliasSpaceExhausted):
+			return nil, status.Error(codes.ResourceExhausted, "failed to allocate alias")
+		case errors.Is(err, services.ErrNotOrgMember):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
 		return nil, status.Error(codes.Internal, "failed to shorten URL")
 	}
 
@@ -48,13 +90,293 @@ func (s *serverAPI) GetOriginalUrl(
 		return nil, status.Error(codes.InvalidArgument, "short_url is required")
 	}
 
-	originalURL, err := s.shortener.GetOriginalURL(ctx, in.GetShortUrl())
+	link, err := s.shortener.GetOriginalURL(ctx, in.GetShortUrl(), models.Visitor{
+		Referrer:  in.GetReferrer(),
+		UserAgent: in.GetUserAgent(),
+		IP:        in.GetClientIp(),
+	}, in.GetPeek())
 	if err != nil {
 		if errors.Is(err, storage.ErrURLNotFound) {
 			return nil, status.Error(codes.NotFound, "short URL not found")
 		}
+		if errors.Is(err, services.ErrLinkDisabled) {
+			return nil, status.Error(codes.NotFound, "short URL disabled")
+		}
+		if errors.Is(err, storage.ErrURLExpired) {
+			// gRPC has no equivalent of HTTP 410 Gone, the gateway maps this code to it.
+			return nil, status.Error(codes.FailedPrecondition, "short URL expired")
+		}
 		return nil, status.Error(codes.Internal, "failed to get original URL")
 	}
 
-	return &pb.GetOriginalUrlResponse{OriginalUrl: originalURL}, nil
+	return &pb.GetOriginalUrlResponse{
+		OriginalUrl: link.URL,
+		Permanent:   link.Permanent,
+	}, nil
+}
+
+func (s *serverAPI) GetLinkStats(
+	ctx context.Context,
+	in *pb.GetLinkStatsRequest,
+) (*pb.GetLinkStatsResponse, error) {
+	if in.ShortUrl == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_url is required")
+	}
+
+	var from, to time.Time
+	if in.GetFrom() != 0 {
+		from = time.Unix(in.GetFrom(), 0)
+	}
+	if in.GetTo() != 0 {
+		to = time.Unix(in.GetTo(), 0)
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, status.Error(codes.InvalidArgument, "to must not be before from")
+	}
+
+	stats, err := s.shortener.LinkStats(ctx, callerFromContext(ctx), in.GetShortUrl(), from, to)
+	if err != nil {
+		if errors.Is(err, storage.ErrURLNotFound) {
+			return nil, status.Error(codes.NotFound, "short URL not found")
+		}
+		if errors.Is(err, services.ErrNotOwner) {
+			return nil, status.Error(codes.PermissionDenied, "short URL belongs to another user")
+		}
+		return nil, status.Error(codes.Internal, "failed to get link stats")
+	}
+
+	resp := &pb.GetLinkStatsResponse{TotalClicks: stats.TotalClicks}
+	if !stats.LastClickAt.IsZero() {
+		resp.LastClickAt = stats.LastClickAt.Unix()
+	}
+	for _, b := range stats.Buckets {
+		resp.Buckets = append(resp.Buckets, &pb.TimeBucket{Start: b.Start.Unix(), Clicks: b.Clicks})
+	}
+	for _, c := range stats.Countries {
+		resp.Countries = append(resp.Countries, &pb.Counter{Key: c.Key, Clicks: c.Clicks})
+	}
+	for _, r := range stats.Referrers {
+		resp.Referrers = append(resp.Referrers, &pb.Counter{Key: r.Key, Clicks: r.Clicks})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListLinks(
+	ctx context.Context,
+	in *pb.ListLinksRequest,
+) (*pb.ListLinksResponse, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	query := models.LinkQuery{All: in.GetAll(), OwnerID: in.GetOwnerId(), OrgID: in.GetOrgId()}
+	links, total, err := s.shortener.ListLinks(ctx, caller, query, in.GetLimit(), in.GetOffset())
+	if err != nil {
+		if errors.Is(err, services.ErrNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, "listing links of other users is not allowed")
+		}
+		if errors.Is(err, services.ErrNotOrgMember) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to list links")
+	}
+
+	resp := &pb.ListLinksResponse{Total: total}
+	for _, link := range links {
+		resp.Links = append(resp.Links, linkToProto(link))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) GetLink(
+	ctx context.Context,
+	in *pb.GetLinkRequest,
+) (*pb.Link, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if in.ShortUrl == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_url is required")
+	}
+
+	link, err := s.shortener.GetLink(ctx, caller, in.GetShortUrl())
+	if err != nil {
+		return nil, linkError(err, "failed to get link")
+	}
+
+	return linkToProto(link), nil
+}
+
+func (s *serverAPI) UpdateLink(
+	ctx context.Context,
+	in *pb.UpdateLinkRequest,
+) (*pb.Link, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if in.ShortUrl == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_url is required")
+	}
+	if in.OriginalUrl != nil && in.GetOriginalUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "original_url must not be empty")
+	}
+	if in.OriginalUrl != nil && !validURL(in.GetOriginalUrl()) {
+		return nil, status.Error(codes.InvalidArgument, "original_url must be an absolute http or https URL")
+	}
+
+	update := models.LinkUpdate{
+		URL:       in.OriginalUrl,
+		Permanent: in.Permanent,
+		MaxClicks: in.MaxClicks,
+		Disabled:  in.Disabled,
+	}
+	if in.ExpiresAt != nil {
+		var expiresAt time.Time
+		if in.GetExpiresAt() != 0 {
+			expiresAt = time.Unix(in.GetExpiresAt(), 0)
+		}
+		update.ExpiresAt = &expiresAt
+	}
+
+	link, err := s.shortener.UpdateLink(ctx, caller, in.GetShortUrl(), update)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidExpiration) || errors.Is(err, services.ErrInvalidMaxClicks) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, linkError(err, "failed to update link")
+	}
+
+	return linkToProto(link), nil
+}
+
+func (s *serverAPI) DeleteLink(
+	ctx context.Context,
+	in *pb.DeleteLinkRequest,
+) (*pb.DeleteLinkResponse, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if in.ShortUrl == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_url is required")
+	}
+
+	if err := s.shortener.DeleteLink(ctx, caller, in.GetShortUrl()); err != nil {
+		return nil, linkError(err, "failed to delete link")
+	}
+
+	return &pb.DeleteLinkResponse{}, nil
+}
+
+func (s *serverAPI) DeleteUserLinks(
+	ctx context.Context,
+	in *pb.DeleteUserLinksRequest,
+) (*pb.DeleteUserLinksResponse, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	count, err := s.shortener.DeleteUserLinks(ctx, caller, in.GetAnonymize())
+	if err != nil {
+		return nil, linkError(err, "failed to delete user links")
+	}
+
+	return &pb.DeleteUserLinksResponse{Count: count}, nil
+}
+
+func (s *serverAPI) TransferOrgLinks(
+	ctx context.Context,
+	in *pb.TransferOrgLinksRequest,
+) (*pb.TransferOrgLinksResponse, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if in.OrgId == "" || in.FromOwnerId == "" || in.ToOwnerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "org_id, from_owner_id and to_owner_id are required")
+	}
+
+	count, err := s.shortener.TransferOrgLinks(ctx, caller, in.GetOrgId(), in.GetFromOwnerId(), in.GetToOwnerId())
+	if err != nil {
+		return nil, linkError(err, "failed to transfer org links")
+	}
+
+	return &pb.TransferOrgLinksResponse{Count: count}, nil
+}
+
+func (s *serverAPI) GetCacheStats(
+	ctx context.Context,
+	in *pb.GetCacheStatsRequest,
+) (*pb.CacheStats, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	stats, err := s.shortener.CacheStats(caller)
+	if err != nil {
+		return nil, linkError(err, "failed to get cache stats")
+	}
+
+	return &pb.CacheStats{
+		LocalHits:            stats.LocalHits,
+		LocalMisses:          stats.LocalMisses,
+		RemoteHits:           stats.RemoteHits,
+		RemoteMisses:         stats.RemoteMisses,
+		NegativeHits:         stats.NegativeHits,
+		Loads:                stats.Loads,
+		LoadErrors:           stats.LoadErrors,
+		PendingInvalidations: int64(stats.PendingInvalidations),
+		LocalSize:            int64(stats.LocalSize),
+	}, nil
+}
+
+// validURL reports whether raw is an absolute http or https URL with a host,
+// the only URLs links may redirect to.
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// linkError converts errors of link management into gRPC status errors.
+func linkError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, storage.ErrURLNotFound):
+		return status.Error(codes.NotFound, "short URL not found")
+	case errors.Is(err, services.ErrNotOwner):
+		return status.Error(codes.PermissionDenied, "short URL belongs to another user")
+	case errors.Is(err, services.ErrNotAllowed), errors.Is(err, services.ErrNotOrgMember):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func linkToProto(link models.Link) *pb.Link {
+	resp := &pb.Link{
+		ShortUrl:    link.Alias,
+		OriginalUrl: link.URL,
+		OwnerId:     link.OwnerID,
+		OrgId:       link.OrgID,
+		Permanent:   link.Permanent,
+		MaxClicks:   link.MaxClicks,
+		Clicks:      link.Clicks,
+		TotalClicks: link.TotalClicks,
+		Disabled:    link.Disabled,
+	}
+	if !link.ExpiresAt.IsZero() {
+		resp.ExpiresAt = link.ExpiresAt.Unix()
+	}
+	if !link.CreatedAt.IsZero() {
+		resp.CreatedAt = link.CreatedAt.Unix()
+	}
+	return resp
 }
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"urlSh/internal/domain/models"
+
+	pb "github.com/yerlans/us-protos/gen/us-service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// linkShortener accepts every link, the other URLShortener methods aren't
+// used by the tests.
+type linkShortener struct {
+	URLShortener
+}
+
+func (linkShortener) ShortenURL(context.Context, models.Caller, models.Link) (string, error) {
+	return "abc", nil
+}
+
+func (linkShortener) UpdateLink(_ context.Context, _ models.Caller, shortURL string, update models.LinkUpdate) (models.Link, error) {
+	return models.Link{Alias: shortURL, URL: *update.URL}, nil
+}
+
+func TestOriginalURLValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want codes.Code
+	}{
+		{"https", "https://example.com/path?q=1", codes.OK},
+		{"http with port", "http://example.com:8080", codes.OK},
+		{"uppercase scheme", "HTTPS://example.com", codes.OK},
+		{"javascript", "javascript:alert(1)", codes.InvalidArgument},
+		{"data", "data:text/html,<script>alert(1)</script>", codes.InvalidArgument},
+		{"ftp", "ftp://example.com/file", codes.InvalidArgument},
+		{"relative", "/some/path", codes.InvalidArgument},
+		{"no scheme", "example.com", codes.InvalidArgument},
+		{"no host", "https:///path", codes.InvalidArgument},
+		{"malformed", "http://[::1", codes.InvalidArgument},
+	}
+
+	s := &serverAPI{shortener: linkShortener{}}
+	ctx := context.WithValue(context.Background(), callerKey{}, models.Caller{UserID: "42"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ShortenUrl(ctx, &pb.ShortenUrlRequest{OriginalUrl: tt.url})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("ShortenUrl() code = %v, want %v", got, tt.want)
+			}
+
+			url := tt.url
+			_, err = s.UpdateLink(ctx, &pb.UpdateLinkRequest{ShortUrl: "abc", OriginalUrl: &url})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("UpdateLink() code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
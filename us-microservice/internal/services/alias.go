@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidAlias  = errors.New("invalid alias")
+	ErrReservedAlias = errors.New("alias is reserved")
+)
+
+// defaultReservedAliases clash with routes served by the API gateway.
+var defaultReservedAliases = []string{
+	"api", "register", "login", "logout", "auth", "admin", "shorten", "static", "health",
+}
+
+// AliasPolicy describes which user-chosen aliases are accepted.
+type AliasPolicy struct {
+	MinLength int
+	MaxLength int
+	Reserved  []string
+}
+
+// Validate checks that alias fits the allowed length and character set
+// and is not one of the reserved words.
+func (p AliasPolicy) Validate(alias string) error {
+	if len(alias) < p.MinLength || len(alias) > p.MaxLength {
+		return fmt.Errorf("%w: length must be between %d and %d", ErrInvalidAlias, p.MinLength, p.MaxLength)
+	}
+
+	for _, r := range alias {
+		if !isAliasRune(r) {
+			return fmt.Errorf("%w: only letters, digits, '-' and '_' are allowed", ErrInvalidAlias)
+		}
+	}
+
+	if p.IsReserved(alias) {
+		return ErrReservedAlias
+	}
+
+	return nil
+}
+
+// IsReserved reports whether alias is one of the reserved words, ignoring case.
+func (p AliasPolicy) IsReserved(alias string) bool {
+	reserved := p.Reserved
+	if len(reserved) == 0 {
+		reserved = defaultReservedAliases
+	}
+
+	for _, word := range reserved {
+		if strings.EqualFold(alias, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAliasRune(r rune) bool {
+	return r >= 'a' && r <= 'z' ||
+		r >= 'A' && r <= 'Z' ||
+		r >= '0' && r <= '9' ||
+		r == '-' || r == '_'
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+	"urlSh/internal/domain/models"
+)
+
+// defaultStatsPeriod is the time range of statistics when the caller gives none.
+const defaultStatsPeriod = 30 * 24 * time.Hour
+
+type ClickStorage interface {
+	SaveClick(ctx context.Context, click models.Click) error
+	GetStats(ctx context.Context, alias string, from, to time.Time) (models.LinkStats, error)
+}
+
+type CountryLocator interface {
+	Country(ip string) string
+}
+
+// Analytics records click events in the background so that
+// resolving a short link never waits for the analytics storage.
+type Analytics struct {
+	log     *slog.Logger
+	storage ClickStorage
+	locator CountryLocator
+	ipSalt  string
+	timeout time.Duration
+
+	events chan clickEvent
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+type clickEvent struct {
+	linkID  string
+	alias   string
+	time    time.Time
+	visitor models.Visitor
+}
+
+// NewAnalytics starts workers that persist click events. Events are dropped
+// when more than bufferSize of them are waiting to be saved.
+func NewAnalytics(log *slog.Logger,
+	storage ClickStorage,
+	locator CountryLocator,
+	ipSalt string,
+	bufferSize int,
+	workers int,
+	timeout time.Duration) *Analytics {
+	a := &Analytics{
+		log:     log,
+		storage: storage,
+		locator: locator,
+		ipSalt:  ipSalt,
+		timeout: timeout,
+		events:  make(chan clickEvent, bufferSize),
+	}
+
+	for i := 0; i < workers; i++ {
+		a.wg.Add(1)
+		go a.run()
+	}
+
+	return a
+}
+
+// Record enqueues a click on the resolved link without blocking.
+func (a *Analytics) Record(link models.Link, visitor models.Visitor) {
+	select {
+	case a.events <- clickEvent{linkID: link.ID, alias: link.Alias, time: time.Now(), visitor: visitor}:
+	default:
+		a.log.Warn("click buffer is full, dropping event", slog.String("alias", link.Alias))
+	}
+}
+
+// Stats returns the click statistics of alias between from and to.
+// Zero bounds select the last 30 days.
+func (a *Analytics) Stats(ctx context.Context, alias string, from, to time.Time) (models.LinkStats, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultStatsPeriod)
+	}
+
+	return a.storage.GetStats(ctx, alias, from, to)
+}
+
+// Close stops accepting events and waits until the queued ones are saved.
+func (a *Analytics) Close() {
+	a.once.Do(func() {
+		close(a.events)
+	})
+	a.wg.Wait()
+}
+
+func (a *Analytics) run() {
+	defer a.wg.Done()
+
+	for event := range a.events {
+		click := models.Click{
+			LinkID:    event.linkID,
+			Alias:     event.alias,
+			Time:      event.time,
+			Referrer:  referrerHost(event.visitor.Referrer),
+			UserAgent: event.visitor.UserAgent,
+			IPHash:    a.hashIP(event.visitor.IP),
+			Country:   a.locator.Country(event.visitor.IP),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+		if err := a.storage.SaveClick(ctx, click); err != nil {
+			a.log.Error("failed to save click", slog.String("alias", click.Alias), slog.String("err", err.Error()))
+		}
+		cancel()
+	}
+}
+
+func (a *Analytics) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(a.ipSalt + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// referrerHost reduces a referrer to its host, an empty host means a direct visit.
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
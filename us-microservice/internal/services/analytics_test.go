@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+	"urlSh/internal/domain/models"
+)
+
+// clickRecorder keeps the saved clicks, GetStats isn't used by the tests.
+type clickRecorder struct {
+	ClickStorage
+	mu     sync.Mutex
+	clicks []models.Click
+}
+
+func (r *clickRecorder) SaveClick(_ context.Context, click models.Click) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clicks = append(r.clicks, click)
+	return nil
+}
+
+type noCountry struct{}
+
+func (noCountry) Country(string) string { return "" }
+
+func TestAnalyticsRecordKeepsResolvedLink(t *testing.T) {
+	storage := &clickRecorder{}
+	a := NewAnalytics(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, noCountry{}, "salt", 10, 2, time.Second)
+
+	a.Record(models.Link{ID: "old", Alias: "abc"}, models.Visitor{Referrer: "https://news.example.com/a"})
+	a.Record(models.Link{ID: "new", Alias: "abc"}, models.Visitor{})
+	a.Close()
+
+	got := map[string]bool{}
+	for _, click := range storage.clicks {
+		if click.Alias != "abc" {
+			t.Errorf("click alias = %q, want abc", click.Alias)
+		}
+		got[click.LinkID] = true
+	}
+	if len(storage.clicks) != 2 || !got["old"] || !got["new"] {
+		t.Errorf("saved clicks = %+v, want one for each link", storage.clicks)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const base62Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"abcdefghijklmnopqrstuvwxyz" +
+	"0123456789"
+
+// Alias generation strategies selectable in config.
+const (
+	StrategyRandom    = "random"
+	StrategySnowflake = "snowflake"
+	StrategyHash      = "hash"
+)
+
+// AliasGenerator produces candidate aliases for new short links.
+// attempt starts at 0 and grows on every collision so that deterministic
+// generators can derive a different candidate for the same URL.
+type AliasGenerator interface {
+	Generate(originalURL string, length int, attempt int) (string, error)
+}
+
+// NewAliasGenerator returns the generator for the given strategy name.
+func NewAliasGenerator(strategy string, nodeID int64) (AliasGenerator, error) {
+	switch strategy {
+	case "", StrategyRandom:
+		return RandomGenerator{}, nil
+	case StrategySnowflake:
+		return NewSnowflakeGenerator(nodeID)
+	case StrategyHash:
+		return HashGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown alias generation strategy %q", strategy)
+	}
+}
+
+// RandomGenerator draws aliases uniformly from the base62 alphabet using crypto/rand.
+type RandomGenerator struct{}
+
+func (RandomGenerator) Generate(_ string, length int, _ int) (string, error) {
+	max := big.NewInt(int64(len(base62Alphabet)))
+
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = base62Alphabet[n.Int64()]
+	}
+
+	return string(b), nil
+}
+
+// HashGenerator derives the alias from the SHA-256 of the original URL,
+// so the same URL maps to the same alias unless it collides.
+type HashGenerator struct{}
+
+func (HashGenerator) Generate(originalURL string, length int, attempt int) (string, error) {
+	input := originalURL
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(input))
+
+	alias := encodeBase62(new(big.Int).SetBytes(sum[:]))
+	if length < len(alias) {
+		alias = alias[:length]
+	}
+
+	return alias, nil
+}
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNode      = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch is the custom epoch the timestamp part is counted from.
+var snowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeGenerator encodes Snowflake-style 63-bit IDs (milliseconds since
+// the epoch, node ID and per-millisecond sequence) in base62. IDs are unique
+// per node, so the requested length is ignored.
+type SnowflakeGenerator struct {
+	mu       sync.Mutex
+	node     int64
+	lastTime int64
+	sequence int64
+}
+
+func NewSnowflakeGenerator(nodeID int64) (*SnowflakeGenerator, error) {
+	if nodeID < 0 || nodeID > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node id must be between 0 and %d", snowflakeMaxNode)
+	}
+	return &SnowflakeGenerator{node: nodeID}, nil
+}
+
+func (g *SnowflakeGenerator) Generate(_ string, _ int, _ int) (string, error) {
+	id, err := g.nextID()
+	if err != nil {
+		return "", err
+	}
+	return encodeBase62(new(big.Int).SetInt64(id)), nil
+}
+
+func (g *SnowflakeGenerator) nextID() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Since(snowflakeEpoch).Milliseconds()
+	if now < g.lastTime {
+		return 0, errors.New("clock moved backwards")
+	}
+
+	if now == g.lastTime {
+		g.sequence = (g.sequence + 1) & snowflakeMaxSequence
+		if g.sequence == 0 {
+			// Sequence exhausted for this millisecond, wait for the next one.
+			for now <= g.lastTime {
+				time.Sleep(time.Millisecond / 10)
+				now = time.Since(snowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTime = now
+
+	return now<<(snowflakeNodeBits+snowflakeSequenceBits) |
+		g.node<<snowflakeSequenceBits |
+		g.sequence, nil
+}
+
+func encodeBase62(n *big.Int) string {
+	if n.Sign() == 0 {
+		return base62Alphabet[:1]
+	}
+
+	base := big.NewInt(int64(len(base62Alphabet)))
+	mod := new(big.Int)
+	n = new(big.Int).Set(n)
+
+	var b []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		b = append(b, base62Alphabet[mod.Int64()])
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return string(b)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"urlSh/internal/domain/models"
+)
+
+var (
+	ErrNotOwner = errors.New("link belongs to another user")
+	// ErrNotAllowed is returned for administrative operations the caller lacks the permission for.
+	ErrNotAllowed = errors.New("operation not allowed")
+	// ErrLinkDisabled is returned when resolving a link an administrator disabled.
+	ErrLinkDisabled = errors.New("link is disabled")
+	ErrNotOrgMember = errors.New("not a member of the organization")
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// ListLinks returns a page of the caller's personal links, newest first, and
+// the total number of them. Members list the links of their organizations.
+// Callers allowed to read any link may list the links of another owner or
+// organization, or with all those of every owner.
+func (u *URLShortener) ListLinks(ctx context.Context, caller models.Caller, query models.LinkQuery, limit, offset int64) ([]models.Link, int64, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	if query.OrgID != "" {
+		if !caller.MemberOf(query.OrgID) && !caller.Can(models.PermLinksReadAny) {
+			return nil, 0, ErrNotOrgMember
+		}
+		return u.storage.ListOrgURLs(ctx, query.OrgID, limit, offset)
+	}
+	if !query.All && (query.OwnerID == "" || query.OwnerID == caller.UserID) {
+		return u.storage.ListURLs(ctx, caller.UserID, limit, offset)
+	}
+	if !caller.Can(models.PermLinksReadAny) {
+		return nil, 0, ErrNotAllowed
+	}
+	if query.All {
+		return u.storage.ListAllURLs(ctx, limit, offset)
+	}
+	return u.storage.ListURLs(ctx, query.OwnerID, limit, offset)
+}
+
+// GetLink returns the link stored under alias if the caller may read it.
+func (u *URLShortener) GetLink(ctx context.Context, caller models.Caller, alias string) (models.Link, error) {
+	return u.accessLink(ctx, caller, alias, false)
+}
+
+// accessLink returns the link stored under alias if the caller may read it,
+// or change it with write, see models.Caller.CanAccess.
+func (u *URLShortener) accessLink(ctx context.Context, caller models.Caller, alias string, write bool) (models.Link, error) {
+	link, err := u.storage.GetURL(ctx, alias)
+	if err != nil {
+		return models.Link{}, err
+	}
+	if !caller.CanAccess(link, write) {
+		return models.Link{}, ErrNotOwner
+	}
+
+	return link, nil
+}
+
+// UpdateLink changes the settings of a link the caller may change and drops
+// its cached copies. Only callers allowed to write any link may disable links.
+func (u *URLShortener) UpdateLink(ctx context.Context, caller models.Caller, alias string, update models.LinkUpdate) (models.Link, error) {
+	if update.ExpiresAt != nil && !update.ExpiresAt.IsZero() && !update.ExpiresAt.After(time.Now()) {
+		return models.Link{}, ErrInvalidExpiration
+	}
+	if update.MaxClicks != nil && *update.MaxClicks < 0 {
+		return models.Link{}, ErrInvalidMaxClicks
+	}
+	if update.URL != nil {
+		normalized := NormalizeURL(*update.URL)
+		update.NormalizedURL = &normalized
+	}
+
+	if update.Disabled != nil && !caller.Can(models.PermLinksWriteAny) {
+		return models.Link{}, ErrNotAllowed
+	}
+
+	old, err := u.accessLink(ctx, caller, alias, true)
+	if err != nil {
+		return models.Link{}, err
+	}
+
+	link, err := u.storage.UpdateURL(ctx, alias, old.OwnerID, update)
+	if err != nil {
+		return models.Link{}, err
+	}
+
+	u.invalidate(ctx, old)
+	if !caller.Owns(old) {
+		u.log.Info("link changed by administrator",
+			slog.String("alias", alias),
+			slog.String("owner_id", old.OwnerID),
+			slog.String("org_id", old.OrgID),
+			slog.String("by", caller.UserID),
+		)
+	}
+
+	return link, nil
+}
+
+// DeleteLink deletes a link the caller may change and drops its cached copies.
+func (u *URLShortener) DeleteLink(ctx context.Context, caller models.Caller, alias string) error {
+	old, err := u.accessLink(ctx, caller, alias, true)
+	if err != nil {
+		return err
+	}
+
+	if err := u.storage.DeleteURL(ctx, alias, old.OwnerID); err != nil {
+		return err
+	}
+
+	u.invalidate(ctx, old)
+	if !caller.Owns(old) {
+		u.log.Info("link deleted by administrator",
+			slog.String("alias", alias),
+			slog.String("owner_id", old.OwnerID),
+			slog.String("org_id", old.OrgID),
+			slog.String("by", caller.UserID),
+		)
+	}
+
+	return nil
+}
+
+// DeleteUserLinks deletes all links of the caller, or with anonymize keeps
+// them resolving without an owner, and drops their cached copies. It returns
+// the number of links affected. Only the auth service deleting the account
+// calls it, with a token scoped to that.
+func (u *URLShortener) DeleteUserLinks(ctx context.Context, caller models.Caller, anonymize bool) (int64, error) {
+	if caller.UserID == "" || !caller.HasScope(models.ScopeAccountDelete) {
+		return 0, ErrNotAllowed
+	}
+
+	var links []models.Link
+	var err error
+	if anonymize {
+		links, err = u.storage.AnonymizeOwnerURLs(ctx, caller.UserID)
+	} else {
+		links, err = u.storage.DeleteOwnerURLs(ctx, caller.UserID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, link := range links {
+		u.invalidate(ctx, link)
+	}
+	u.log.Info("user links removed",
+		slog.String("owner_id", caller.UserID),
+		slog.Int("count", len(links)),
+		slog.Bool("anonymized", anonymize),
+	)
+
+	return int64(len(links)), nil
+}
+
+// TransferOrgLinks hands the links a member created in the organization over
+// to another member and returns how many were handed over. Admins and owners
+// of the organization transfer anyone's links, members only their own. Only
+// the auth service removing the member calls it, with a token scoped to that.
+func (u *URLShortener) TransferOrgLinks(ctx context.Context, caller models.Caller, orgID, fromOwnerID, toOwnerID string) (int64, error) {
+	if orgID == "" || fromOwnerID == "" || toOwnerID == "" || !caller.HasScope(models.ScopeLinksTransfer) {
+		return 0, ErrNotAllowed
+	}
+	own := caller.UserID == fromOwnerID && caller.MemberOf(orgID)
+	if !own && !caller.ManagesOrg(orgID) {
+		return 0, ErrNotAllowed
+	}
+
+	count, err := u.storage.TransferOrgURLs(ctx, orgID, fromOwnerID, toOwnerID)
+	if err != nil {
+		return 0, err
+	}
+
+	u.log.Info("org links transferred",
+		slog.String("org_id", orgID),
+		slog.String("from", fromOwnerID),
+		slog.String("to", toOwnerID),
+		slog.String("by", caller.UserID),
+		slog.Int64("count", count),
+	)
+
+	return count, nil
+}
+
+// CacheStats returns the lookup counters of the link cache, the caller needs
+// the permission to read any link.
+func (u *URLShortener) CacheStats(caller models.Caller) (models.CacheStats, error) {
+	if !caller.Can(models.PermLinksReadAny) {
+		return models.CacheStats{}, ErrNotAllowed
+	}
+	return u.cache.Stats(), nil
+}
+
+// invalidate removes the cached link and its dedup reverse mapping. The
+// change is already stored, failed removals are retried by the cache.
+func (u *URLShortener) invalidate(ctx context.Context, link models.Link) {
+	if err := u.cache.DeleteURL(ctx, link.Alias); err != nil {
+		u.log.Warn("failed to invalidate cached link, retrying",
+			slog.String("alias", link.Alias), slog.String("err", err.Error()))
+	}
+	if link.NormalizedURL == "" {
+		return
+	}
+	if err := u.cache.DeleteAlias(ctx, dedupOwner(link), link.NormalizedURL); err != nil {
+		u.log.Warn("failed to invalidate cached alias, retrying",
+			slog.String("alias", link.Alias), slog.String("err", err.Error()))
+	}
+}
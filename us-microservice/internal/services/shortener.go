@@ -2,85 +2,308 @@ package services
 
 import (
 	"context"
+	"errors"
 	"log/slog"
-	"math/rand"
+	"sync/atomic"
 	"time"
+	"urlSh/internal/domain/models"
+	"urlSh/internal/storage"
 )
 
+var (
+	// ErrAliasSpaceExhausted is returned when no free alias was found within the allowed attempts.
+	ErrAliasSpaceExhausted = errors.New("failed to allocate a free alias")
+	ErrInvalidExpiration   = errors.New("expiration must be in the future")
+	ErrInvalidMaxClicks    = errors.New("max clicks must not be negative")
+)
+
+// collisionsPerLength is the number of collisions within one request
+// after which generated aliases become one character longer.
+const collisionsPerLength = 3
+
 type UrlStorage interface {
-	SaveURL(ctx context.Context, urlToSave, alias string) (string, error)
-	GetURL(ctx context.Context, alias string) (string, error)
+	SaveURL(ctx context.Context, link models.Link) (models.Link, error)
+	GetURL(ctx context.Context, alias string) (models.Link, error)
+	GetURLByNormalized(ctx context.Context, ownerID, orgID, normalizedURL string) (models.Link, error)
+	RegisterClick(ctx context.Context, alias string) (models.Link, error)
+	ListURLs(ctx context.Context, ownerID string, limit, offset int64) ([]models.Link, int64, error)
+	ListAllURLs(ctx context.Context, limit, offset int64) ([]models.Link, int64, error)
+	ListOrgURLs(ctx context.Context, orgID string, limit, offset int64) ([]models.Link, int64, error)
+	UpdateURL(ctx context.Context, alias, ownerID string, update models.LinkUpdate) (models.Link, error)
+	DeleteURL(ctx context.Context, alias, ownerID string) error
+	DeleteOwnerURLs(ctx context.Context, ownerID string) ([]models.Link, error)
+	AnonymizeOwnerURLs(ctx context.Context, ownerID string) ([]models.Link, error)
+	TransferOrgURLs(ctx context.Context, orgID, fromOwnerID, toOwnerID string) (int64, error)
 }
 
+// CacheStorage caches links by alias and the dedup reverse mappings. GetURL
+// returns an empty link on a miss, read-through caches load it instead and
+// fail with storage.ErrURLNotFound for unknown aliases.
 type CacheStorage interface {
-	SaveURL(ctx context.Context, originalURL string, alias string, expiration time.Duration) error
-	GetURL(ctx context.Context, alias string) (string, error)
+	SaveURL(ctx context.Context, link models.Link, expiration time.Duration) error
+	GetURL(ctx context.Context, alias string) (models.Link, error)
+	DeleteURL(ctx context.Context, alias string) error
+	SaveAlias(ctx context.Context, ownerID, normalizedURL, alias string, expiration time.Duration) error
+	GetAlias(ctx context.Context, ownerID, normalizedURL string) (string, error)
+	DeleteAlias(ctx context.Context, ownerID, normalizedURL string) error
+	Stats() models.CacheStats
+}
+
+type ClickAnalytics interface {
+	Record(link models.Link, visitor models.Visitor)
+	Stats(ctx context.Context, alias string, from, to time.Time) (models.LinkStats, error)
+}
+
+// GenerationPolicy controls how aliases are generated when the user did not choose one.
+type GenerationPolicy struct {
+	Generator   AliasGenerator
+	Length      int
+	MaxLength   int
+	MaxAttempts int
 }
 
 type URLShortener struct {
-	log     *slog.Logger
-	storage UrlStorage
-	cache   CacheStorage
-	ttl     time.Duration
+	log         *slog.Logger
+	storage     UrlStorage
+	cache       CacheStorage
+	ttl         time.Duration
+	aliasPolicy AliasPolicy
+	generation  GenerationPolicy
+	// dedup makes shortening a known URL return the owner's existing alias.
+	dedup     bool
+	analytics ClickAnalytics
+	// aliasLength is the current length of generated aliases,
+	// it grows as collisions show that the keyspace fills up.
+	aliasLength atomic.Int64
 }
 
 func New(log *slog.Logger,
 	storage UrlStorage,
 	cache CacheStorage,
-	ttl time.Duration) *URLShortener {
-	return &URLShortener{
-		log:     log,
-		storage: storage,
-		cache:   cache,
-		ttl:     ttl,
+	ttl time.Duration,
+	aliasPolicy AliasPolicy,
+	generation GenerationPolicy,
+	dedup bool,
+	analytics ClickAnalytics) *URLShortener {
+	u := &URLShortener{
+		log:         log,
+		storage:     storage,
+		cache:       cache,
+		ttl:         ttl,
+		aliasPolicy: aliasPolicy,
+		generation:  generation,
+		dedup:       dedup,
+		analytics:   analytics,
 	}
+	u.aliasLength.Store(int64(generation.Length))
+	return u
 }
 
-func (u *URLShortener) ShortenURL(ctx context.Context, originalURL string) (string, error) {
-	//TODO: check if url already exists, not it checks (url, alias) in db, but alias is random everytime
+// ShortenURL stores the link under its alias and returns the alias.
+// An alias is generated when link.Alias is empty, otherwise
+// the custom alias is validated against the alias policy.
+// In dedup mode a URL the owner has already shortened without
+// a custom alias, expiration or click limit returns the existing alias.
+// Links of an organization are deduplicated across its members, only
+// members may create them.
+func (u *URLShortener) ShortenURL(ctx context.Context, caller models.Caller, link models.Link) (string, error) {
 	u.log.Info("attempting to shorten URL")
-	alias := generateShortURL(5)
-	url, err := u.storage.SaveURL(ctx, originalURL, alias)
+
+	if link.OrgID != "" && !caller.MemberOf(link.OrgID) {
+		return "", ErrNotOrgMember
+	}
+	if !link.ExpiresAt.IsZero() && !link.ExpiresAt.After(time.Now()) {
+		return "", ErrInvalidExpiration
+	}
+	if link.MaxClicks < 0 {
+		return "", ErrInvalidMaxClicks
+	}
+
+	link.NormalizedURL = NormalizeURL(link.URL)
+	link.CreatedAt = time.Now()
+
+	limited := !link.ExpiresAt.IsZero() || link.MaxClicks > 0
+	if u.dedup && link.Alias == "" && !limited {
+		alias, err := u.findExisting(ctx, link)
+		if err != nil {
+			return "", err
+		}
+		if alias != "" {
+			u.log.Info("returning existing alias for known URL")
+			return alias, nil
+		}
+	}
+
+	var err error
+	if link.Alias == "" {
+		link, err = u.saveWithGeneratedAlias(ctx, link)
+	} else {
+		if err := u.aliasPolicy.Validate(link.Alias); err != nil {
+			return "", err
+		}
+		link, err = u.storage.SaveURL(ctx, link)
+	}
 	if err != nil {
 		return "", err
 	}
-	err = u.cache.SaveURL(ctx, originalURL, alias, u.ttl)
+
+	alias := link.Alias
+	err = u.cache.SaveURL(ctx, link, u.cacheTTL(link))
+	if err != nil {
+		return "", err
+	}
+	if u.dedup && !limited {
+		if err := u.cache.SaveAlias(ctx, dedupOwner(link), link.NormalizedURL, alias, u.ttl); err != nil {
+			return "", err
+		}
+	}
+	return alias, nil
+}
+
+// findExisting looks up the alias of an already shortened URL, first in the
+// cache and then in storage. It returns an empty alias when there is none.
+func (u *URLShortener) findExisting(ctx context.Context, link models.Link) (string, error) {
+	alias, err := u.cache.GetAlias(ctx, dedupOwner(link), link.NormalizedURL)
+	if err == nil && alias != "" {
+		return alias, nil
+	}
+
+	existing, err := u.storage.GetURLByNormalized(ctx, link.OwnerID, link.OrgID, link.NormalizedURL)
 	if err != nil {
+		if errors.Is(err, storage.ErrURLNotFound) {
+			return "", nil
+		}
 		return "", err
 	}
-	return url, nil
+
+	if err := u.cache.SaveAlias(ctx, dedupOwner(link), link.NormalizedURL, existing.Alias, u.ttl); err != nil {
+		u.log.Warn("failed to cache alias", slog.String("err", err.Error()))
+	}
+	return existing.Alias, nil
+}
+
+// dedupOwner is the owner the reverse mapping of the link is cached under.
+// Links of an organization are shared by its members, whoever created them.
+func dedupOwner(link models.Link) string {
+	if link.OrgID != "" {
+		return "org-" + link.OrgID
+	}
+	return link.OwnerID
 }
 
-// GetOriginalURL retrieves the original URL for a given short URL.
+// saveWithGeneratedAlias saves the link under a generated alias, retrying with
+// a new candidate on collision and growing the alias length as collisions pile up.
+func (u *URLShortener) saveWithGeneratedAlias(ctx context.Context, link models.Link) (models.Link, error) {
+	collisions := 0
+	for attempt := 0; attempt < u.generation.MaxAttempts; attempt++ {
+		length := int(u.aliasLength.Load())
+
+		alias, err := u.generation.Generator.Generate(link.URL, length, attempt)
+		if err != nil {
+			return models.Link{}, err
+		}
+		if u.aliasPolicy.IsReserved(alias) {
+			continue
+		}
+
+		link.Alias = alias
+		saved, err := u.storage.SaveURL(ctx, link)
+		if err == nil {
+			return saved, nil
+		}
+		if !errors.Is(err, storage.ErrURLExists) {
+			return models.Link{}, err
+		}
+
+		u.log.Warn("generated alias collision", slog.Int("length", length), slog.Int("attempt", attempt))
+
+		collisions++
+		if collisions%collisionsPerLength == 0 {
+			u.growAliasLength(length)
+		}
+	}
+
+	return models.Link{}, ErrAliasSpaceExhausted
+}
+
+// growAliasLength increments the generated alias length unless another
+// request already did so or the maximum length is reached.
+func (u *URLShortener) growAliasLength(current int) {
+	if current >= u.generation.MaxLength {
+		return
+	}
+	if u.aliasLength.CompareAndSwap(int64(current), int64(current+1)) {
+		u.log.Info("growing generated alias length", slog.Int("length", current+1))
+	}
+}
+
+// GetOriginalURL retrieves the link for a given short URL and records the click.
+// It returns ErrLinkDisabled for disabled links and storage.ErrURLExpired for
+// links past their expiration time or click limit; resolutions of
+// click-limited links are counted in storage. With peek the link is resolved
+// without counting or recording a click.
 func (u *URLShortener) GetOriginalURL(
 	ctx context.Context,
 	shortURL string,
-) (string, error) {
+	visitor models.Visitor,
+	peek bool,
+) (models.Link, error) {
 
 	u.log.Info("attempting to fetch original URL")
-	getURL, err := u.cache.GetURL(ctx, shortURL)
-	if err == nil && getURL != "" {
-		return getURL, nil
+	link, err := u.cache.GetURL(ctx, shortURL)
+	if errors.Is(err, storage.ErrURLNotFound) {
+		return models.Link{}, err
 	}
-	url, err := u.storage.GetURL(ctx, shortURL)
-	if err != nil {
-		return "", err
+	if err != nil || link.URL == "" {
+		link, err = u.storage.GetURL(ctx, shortURL)
+		if err != nil {
+			return models.Link{}, err
+		}
+	}
+
+	if link.Disabled {
+		return models.Link{}, ErrLinkDisabled
+	}
+	if link.Expired(time.Now()) {
+		return models.Link{}, storage.ErrURLExpired
+	}
+	if peek {
+		return link, nil
+	}
+
+	if link.MaxClicks > 0 {
+		link, err = u.storage.RegisterClick(ctx, shortURL)
+		if err != nil {
+			return models.Link{}, err
+		}
 	}
-	return url, nil
-}
 
-// Helper function to generate short URL
-func generateShortURL(size int) string {
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	u.analytics.Record(link, visitor)
 
-	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
-		"abcdefghijklmnopqrstuvwxyz" +
-		"0123456789")
+	return link, nil
+}
 
-	b := make([]rune, size)
-	for i := range b {
-		b[i] = chars[rnd.Intn(len(chars))]
+// LinkStats returns click statistics of an existing short URL between from and to.
+// Statistics of an owned link are only available to those who may read it.
+func (u *URLShortener) LinkStats(ctx context.Context, caller models.Caller, shortURL string, from, to time.Time) (models.LinkStats, error) {
+	link, err := u.storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return models.LinkStats{}, err
+	}
+	if (link.OwnerID != "" || link.OrgID != "") && !caller.CanAccess(link, false) {
+		return models.LinkStats{}, ErrNotOwner
 	}
 
-	return string(b)
+	return u.analytics.Stats(ctx, shortURL, from, to)
+}
+
+// cacheTTL returns the cache expiration for link, which never outlives the link itself.
+func (u *URLShortener) cacheTTL(link models.Link) time.Duration {
+	if link.ExpiresAt.IsZero() {
+		return u.ttl
+	}
+	if untilExpiry := time.Until(link.ExpiresAt); untilExpiry < u.ttl {
+		return untilExpiry
+	}
+	return u.ttl
 }
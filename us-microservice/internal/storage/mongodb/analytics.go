@@ -0,0 +1,273 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"urlSh/internal/domain/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// topCountersLimit is the number of countries and referrers returned with stats.
+const topCountersLimit = 10
+
+// AnalyticsStorage keeps raw click events for a retention period and
+// hourly aggregated click counters per link, country and referrer. Both are
+// keyed by the ID of the link document, so that a link created later under
+// the alias of a deleted or purged one starts without its clicks.
+type AnalyticsStorage struct {
+	links  *mongo.Collection
+	events *mongo.Collection
+	stats  *mongo.Collection
+}
+
+type ClickDocument struct {
+	LinkID    primitive.ObjectID `bson:"link_id"`
+	Time      time.Time          `bson:"time"`
+	Referrer  string             `bson:"referrer,omitempty"`
+	UserAgent string             `bson:"user_agent,omitempty"`
+	IPHash    string             `bson:"ip_hash,omitempty"`
+	Country   string             `bson:"country,omitempty"`
+}
+
+type StatsDocument struct {
+	LinkID   primitive.ObjectID `bson:"link_id"`
+	Bucket   time.Time          `bson:"bucket"`
+	Country  string             `bson:"country"`
+	Referrer string             `bson:"referrer"`
+	Clicks   int64              `bson:"clicks"`
+}
+
+// Analytics returns the storage of click analytics kept in the given collections
+// of the same database. Raw events are purged after retention.
+func (s *Storage) Analytics(eventsCollection, statsCollection string, retention time.Duration) (*AnalyticsStorage, error) {
+	const op = "storage.mongodb.Analytics"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a := &AnalyticsStorage{
+		links:  s.collection,
+		events: s.database.Collection(eventsCollection),
+		stats:  s.database.Collection(statsCollection),
+	}
+	if err := a.migrateLinkIDs(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err := a.events.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "link_id", Value: 1}, {Key: "time", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "time", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create events index: %w", op, err)
+	}
+
+	_, err = a.stats.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "link_id", Value: 1},
+			{Key: "bucket", Value: 1},
+			{Key: "country", Value: 1},
+			{Key: "referrer", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: create stats index: %w", op, err)
+	}
+
+	return a, nil
+}
+
+// migrateLinkIDs keys the clicks saved by alias, before they were keyed by
+// link, with the link now holding the alias. Clicks of aliases no link holds
+// anymore are removed, together with the indexes on the alias.
+func (s *AnalyticsStorage) migrateLinkIDs(ctx context.Context) error {
+	for _, coll := range []*mongo.Collection{s.events, s.stats} {
+		for _, index := range []string{"alias_1_time_1", "alias_1_bucket_1_country_1_referrer_1"} {
+			if err := dropIndex(ctx, coll, index); err != nil {
+				return err
+			}
+		}
+
+		unkeyed := bson.D{{Key: "link_id", Value: bson.D{{Key: "$exists", Value: false}}}}
+		aliases, err := coll.Distinct(ctx, "alias", unkeyed)
+		if err != nil {
+			return fmt.Errorf("find aliases: %w", err)
+		}
+		for _, alias := range aliases {
+			filter := append(bson.D{{Key: "alias", Value: alias}}, unkeyed...)
+
+			var link struct {
+				ID primitive.ObjectID `bson:"_id"`
+			}
+			err := s.links.FindOne(ctx, bson.D{{Key: "alias", Value: alias}}).Decode(&link)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				if _, err := coll.DeleteMany(ctx, filter); err != nil {
+					return fmt.Errorf("delete clicks: %w", err)
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("find link: %w", err)
+			}
+
+			_, err = coll.UpdateMany(ctx, filter, bson.D{
+				{Key: "$set", Value: bson.D{{Key: "link_id", Value: link.ID}}},
+				{Key: "$unset", Value: bson.D{{Key: "alias", Value: ""}}},
+			})
+			if err != nil {
+				return fmt.Errorf("key clicks by link: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// SaveClick updates the counters of the clicked link and stores the click
+// event and hourly counters. Clicks on links deleted meanwhile are dropped,
+// even when another link took over the alias.
+func (s *AnalyticsStorage) SaveClick(ctx context.Context, click models.Click) error {
+	const op = "storage.mongodb.SaveClick"
+
+	linkID, err := primitive.ObjectIDFromHex(click.LinkID)
+	if err != nil {
+		return fmt.Errorf("%s: invalid link id: %w", op, err)
+	}
+
+	result, err := s.links.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: linkID}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "total_clicks", Value: 1}}},
+			{Key: "$max", Value: bson.D{{Key: "last_click_at", Value: click.Time.UTC()}}},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: update link counters: %w", op, err)
+	}
+	if result.MatchedCount == 0 {
+		return nil
+	}
+
+	_, err = s.events.InsertOne(ctx, ClickDocument{
+		LinkID:    linkID,
+		Time:      click.Time.UTC(),
+		Referrer:  click.Referrer,
+		UserAgent: click.UserAgent,
+		IPHash:    click.IPHash,
+		Country:   click.Country,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: insert event: %w", op, err)
+	}
+
+	filter := bson.D{
+		{Key: "link_id", Value: linkID},
+		{Key: "bucket", Value: click.Time.UTC().Truncate(time.Hour)},
+		{Key: "country", Value: click.Country},
+		{Key: "referrer", Value: click.Referrer},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "clicks", Value: 1}}}}
+	_, err = s.stats.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("%s: update stats: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetStats returns the link counters together with hourly buckets and
+// the top countries and referrers between from and to.
+func (s *AnalyticsStorage) GetStats(ctx context.Context, alias string, from, to time.Time) (models.LinkStats, error) {
+	const op = "storage.mongodb.GetStats"
+
+	var link struct {
+		ID          primitive.ObjectID `bson:"_id"`
+		TotalClicks int64              `bson:"total_clicks"`
+		LastClickAt time.Time          `bson:"last_click_at"`
+	}
+	err := s.links.FindOne(ctx, bson.D{{Key: "alias", Value: alias}}).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.LinkStats{}, nil
+	}
+	if err != nil {
+		return models.LinkStats{}, fmt.Errorf("%s: find link: %w", op, err)
+	}
+
+	match := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "link_id", Value: link.ID},
+		{Key: "bucket", Value: bson.D{
+			{Key: "$gte", Value: from.UTC().Truncate(time.Hour)},
+			{Key: "$lte", Value: to.UTC()},
+		}},
+	}}}
+
+	buckets, err := s.aggregate(ctx, match, "$bucket", bson.D{{Key: "_id", Value: 1}}, 0)
+	if err != nil {
+		return models.LinkStats{}, fmt.Errorf("%s: aggregate buckets: %w", op, err)
+	}
+	countries, err := s.aggregate(ctx, match, "$country", bson.D{{Key: "clicks", Value: -1}}, topCountersLimit)
+	if err != nil {
+		return models.LinkStats{}, fmt.Errorf("%s: aggregate countries: %w", op, err)
+	}
+	referrers, err := s.aggregate(ctx, match, "$referrer", bson.D{{Key: "clicks", Value: -1}}, topCountersLimit)
+	if err != nil {
+		return models.LinkStats{}, fmt.Errorf("%s: aggregate referrers: %w", op, err)
+	}
+
+	stats := models.LinkStats{
+		TotalClicks: link.TotalClicks,
+		LastClickAt: link.LastClickAt,
+	}
+	for _, b := range buckets {
+		stats.Buckets = append(stats.Buckets, models.TimeBucket{Start: b.ID.Time(), Clicks: b.Clicks})
+	}
+	for _, c := range countries {
+		stats.Countries = append(stats.Countries, models.Counter{Key: c.ID.StringValue(), Clicks: c.Clicks})
+	}
+	for _, r := range referrers {
+		stats.Referrers = append(stats.Referrers, models.Counter{Key: r.ID.StringValue(), Clicks: r.Clicks})
+	}
+
+	return stats, nil
+}
+
+type groupResult struct {
+	ID     bson.RawValue `bson:"_id"`
+	Clicks int64         `bson:"clicks"`
+}
+
+func (s *AnalyticsStorage) aggregate(ctx context.Context, match bson.D, groupBy string, sort bson.D, limit int64) ([]groupResult, error) {
+	pipeline := mongo.Pipeline{
+		match,
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: groupBy},
+			{Key: "clicks", Value: bson.D{{Key: "$sum", Value: "$clicks"}}},
+		}}},
+		{{Key: "$sort", Value: sort}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	cursor, err := s.stats.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []groupResult
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
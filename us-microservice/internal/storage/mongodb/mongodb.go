@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"time"
+	"urlSh/internal/domain/models"
 	"urlSh/internal/storage"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -15,15 +17,39 @@ import (
 
 type Storage struct {
 	client     *mongo.Client
+	database   *mongo.Database
 	collection *mongo.Collection
+	// retention is how long expired links are kept before they are purged.
+	retention time.Duration
 }
 
 type URLDocument struct {
-	Alias string `bson:"alias"`
-	URL   string `bson:"url"`
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Alias         string             `bson:"alias"`
+	URL           string             `bson:"url"`
+	NormalizedURL string             `bson:"normalized_url,omitempty"`
+	OwnerID       string             `bson:"owner_id,omitempty"`
+	OrgID         string             `bson:"org_id,omitempty"`
+	Permanent     bool               `bson:"permanent"`
+	ExpiresAt     *time.Time         `bson:"expires_at,omitempty"`
+	MaxClicks     int64              `bson:"max_clicks,omitempty"`
+	Clicks        int64              `bson:"clicks"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	// PurgeAt is when the TTL index removes an expired link. Until then the
+	// alias keeps answering as expired and can't be claimed again.
+	PurgeAt *time.Time `bson:"purge_at,omitempty"`
+	// Exhausted marks an ExpiresAt set when the click limit was used up, a
+	// new limit removes it again.
+	Exhausted bool `bson:"exhausted,omitempty"`
+	// TotalClicks and LastClickAt are maintained by the click analytics.
+	TotalClicks int64      `bson:"total_clicks,omitempty"`
+	LastClickAt *time.Time `bson:"last_click_at,omitempty"`
+	Disabled    bool       `bson:"disabled,omitempty"`
 }
 
-func New(uri, database, collection string) (*Storage, error) {
+// New connects to the database. Expired links, by time or by click limit, are
+// kept as tombstones for retention before MongoDB purges them.
+func New(uri, database, collection string, retention time.Duration) (*Storage, error) {
 	const op = "storage.mongodb.New"
 
 	clientOptions := options.Client().ApplyURI(uri)
@@ -43,25 +69,102 @@ func New(uri, database, collection string) (*Storage, error) {
 	db := client.Database(database)
 	coll := db.Collection(collection)
 
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "alias", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "alias", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Secondary index used to find an existing link for the same URL and owner.
+			Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "normalized_url", Value: 1}},
+		},
+		{
+			// Index used to list the links of an owner, newest first.
+			Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			// Index used to list the links of an organization, newest first.
+			Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			// TTL index, MongoDB purges documents once purge_at has passed.
+			Keys:    bson.D{{Key: "purge_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
 	}
 
-	_, err = coll.Indexes().CreateOne(ctx, indexModel)
+	s := &Storage{client: client, database: db, collection: coll, retention: retention}
+	if err := s.migratePurge(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = coll.Indexes().CreateMany(ctx, indexModels)
 	if err != nil {
 		return nil, fmt.Errorf("%s: create index: %w", op, err)
 	}
 
-	return &Storage{client: client, collection: coll}, nil
+	return s, nil
+}
+
+// migratePurge replaces the former TTL index on expires_at, which purged
+// links the moment they expired, and schedules the purge of the links
+// created before.
+func (s *Storage) migratePurge(ctx context.Context) error {
+	if err := dropIndex(ctx, s.collection, "expires_at_1"); err != nil {
+		return err
+	}
+
+	_, err := s.collection.UpdateMany(ctx,
+		bson.D{
+			{Key: "expires_at", Value: bson.D{{Key: "$exists", Value: true}}},
+			{Key: "purge_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "purge_at", Value: bson.D{
+			{Key: "$add", Value: bson.A{"$expires_at", s.retention.Milliseconds()}},
+		}}}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("schedule purge: %w", err)
+	}
+	return nil
 }
 
-func (s *Storage) SaveURL(ctx context.Context, urlToSave, alias string) (string, error) {
+// dropIndex drops the index unless it, or the collection, doesn't exist.
+func dropIndex(ctx context.Context, coll *mongo.Collection, name string) error {
+	const (
+		codeNamespaceNotFound = 26
+		codeIndexNotFound     = 27
+	)
+
+	_, err := coll.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) &&
+		(cmdErr.Code == codeNamespaceNotFound || cmdErr.Code == codeIndexNotFound)) {
+		return fmt.Errorf("drop index %s: %w", name, err)
+	}
+	return nil
+}
+
+// SaveURL stores the link and returns it as saved, with its ID.
+func (s *Storage) SaveURL(ctx context.Context, link models.Link) (models.Link, error) {
 	const op = "storage.mongodb.SaveURL"
 
 	doc := URLDocument{
-		Alias: alias,
-		URL:   urlToSave,
+		ID:            primitive.NewObjectID(),
+		Alias:         link.Alias,
+		URL:           link.URL,
+		NormalizedURL: link.NormalizedURL,
+		OwnerID:       link.OwnerID,
+		OrgID:         link.OrgID,
+		Permanent:     link.Permanent,
+		MaxClicks:     link.MaxClicks,
+		CreatedAt:     link.CreatedAt.UTC(),
+	}
+	if !link.ExpiresAt.IsZero() {
+		expiresAt := link.ExpiresAt.UTC()
+		purgeAt := expiresAt.Add(s.retention)
+		doc.ExpiresAt = &expiresAt
+		doc.PurgeAt = &purgeAt
 	}
 
 	_, err := s.collection.InsertOne(ctx, doc)
@@ -70,17 +173,17 @@ func (s *Storage) SaveURL(ctx context.Context, urlToSave, alias string) (string,
 		if errors.As(err, &mongoWriteException) {
 			for _, writeError := range mongoWriteException.WriteErrors {
 				if writeError.Code == 11000 {
-					return "", fmt.Errorf("%s: %w", op, storage.ErrURLExists)
+					return models.Link{}, fmt.Errorf("%s: %w", op, storage.ErrURLExists)
 				}
 			}
 		}
-		return "", fmt.Errorf("%s: insert document: %w", op, err)
+		return models.Link{}, fmt.Errorf("%s: insert document: %w", op, err)
 	}
 
-	return doc.Alias, nil
+	return doc.toModel(), nil
 }
 
-func (s *Storage) GetURL(ctx context.Context, alias string) (string, error) {
+func (s *Storage) GetURL(ctx context.Context, alias string) (models.Link, error) {
 	const op = "storage.mongodb.GetURL"
 
 	var doc URLDocument
@@ -89,10 +192,383 @@ func (s *Storage) GetURL(ctx context.Context, alias string) (string, error) {
 	err := s.collection.FindOne(ctx, filter).Decode(&doc)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return "", storage.ErrURLNotFound
+			return models.Link{}, storage.ErrURLNotFound
+		}
+		return models.Link{}, fmt.Errorf("%s: find document: %w", op, err)
+	}
+
+	return doc.toModel(), nil
+}
+
+// GetURLByNormalized finds a personal link of the owner, or with orgID a link
+// of any member of the organization, without expiration or click limit that
+// points to the given normalized URL.
+func (s *Storage) GetURLByNormalized(ctx context.Context, ownerID, orgID, normalizedURL string) (models.Link, error) {
+	const op = "storage.mongodb.GetURLByNormalized"
+
+	var doc URLDocument
+	filter := bson.D{{Key: "org_id", Value: orgFilter(orgID)}}
+	if orgID == "" {
+		filter = append(filter, bson.E{Key: "owner_id", Value: ownerFilter(ownerID)})
+	}
+	filter = append(filter, bson.D{
+		{Key: "normalized_url", Value: normalizedURL},
+		{Key: "expires_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "max_clicks", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "disabled", Value: bson.D{{Key: "$ne", Value: true}}},
+	}...)
+
+	err := s.collection.FindOne(ctx, filter).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Link{}, storage.ErrURLNotFound
+		}
+		return models.Link{}, fmt.Errorf("%s: find document: %w", op, err)
+	}
+
+	return doc.toModel(), nil
+}
+
+// RegisterClick atomically counts a resolution of a click-limited link.
+// It returns storage.ErrURLExpired when the limit is already used up. The
+// document of a link that reaches its limit is marked expired so that the
+// TTL index purges it after the retention.
+func (s *Storage) RegisterClick(ctx context.Context, alias string) (models.Link, error) {
+	const op = "storage.mongodb.RegisterClick"
+
+	filter := bson.D{
+		{Key: "alias", Value: alias},
+		{Key: "$expr", Value: bson.D{{Key: "$lt", Value: bson.A{"$clicks", "$max_clicks"}}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "clicks", Value: 1}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var doc URLDocument
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Link{}, s.missingOrExpired(ctx, alias)
+		}
+		return models.Link{}, fmt.Errorf("%s: update document: %w", op, err)
+	}
+
+	if doc.MaxClicks > 0 && doc.Clicks >= doc.MaxClicks && doc.ExpiresAt == nil {
+		now := time.Now().UTC()
+		_, err := s.collection.UpdateOne(ctx,
+			bson.D{{Key: "alias", Value: alias}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "expires_at", Value: now},
+				{Key: "purge_at", Value: now.Add(s.retention)},
+				{Key: "exhausted", Value: true},
+			}}},
+		)
+		if err != nil {
+			return models.Link{}, fmt.Errorf("%s: mark expired: %w", op, err)
 		}
-		return "", fmt.Errorf("%s: find document: %w", op, err)
 	}
 
-	return doc.URL, nil
+	return doc.toModel(), nil
+}
+
+// missingOrExpired tells apart an unknown alias from one whose click limit is used up.
+func (s *Storage) missingOrExpired(ctx context.Context, alias string) error {
+	const op = "storage.mongodb.missingOrExpired"
+
+	count, err := s.collection.CountDocuments(ctx, bson.D{{Key: "alias", Value: alias}})
+	if err != nil {
+		return fmt.Errorf("%s: count documents: %w", op, err)
+	}
+	if count == 0 {
+		return storage.ErrURLNotFound
+	}
+	return storage.ErrURLExpired
+}
+
+// ListURLs returns a page of the owner's personal links, newest first, and the total number of them.
+func (s *Storage) ListURLs(ctx context.Context, ownerID string, limit, offset int64) ([]models.Link, int64, error) {
+	const op = "storage.mongodb.ListURLs"
+
+	filter := bson.D{{Key: "owner_id", Value: ownerID}, {Key: "org_id", Value: orgFilter("")}}
+	links, total, err := s.listURLs(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return links, total, nil
+}
+
+// ListOrgURLs returns a page of the organization's links, newest first, and the total number of them.
+func (s *Storage) ListOrgURLs(ctx context.Context, orgID string, limit, offset int64) ([]models.Link, int64, error) {
+	const op = "storage.mongodb.ListOrgURLs"
+
+	links, total, err := s.listURLs(ctx, bson.D{{Key: "org_id", Value: orgID}}, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return links, total, nil
+}
+
+// ListAllURLs returns a page of the links of all owners, newest first, and the total number of them.
+func (s *Storage) ListAllURLs(ctx context.Context, limit, offset int64) ([]models.Link, int64, error) {
+	const op = "storage.mongodb.ListAllURLs"
+
+	links, total, err := s.listURLs(ctx, bson.D{}, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return links, total, nil
+}
+
+func (s *Storage) listURLs(ctx context.Context, filter bson.D, limit, offset int64) ([]models.Link, int64, error) {
+	total, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count documents: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("find documents: %w", err)
+	}
+
+	var docs []URLDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, 0, fmt.Errorf("decode documents: %w", err)
+	}
+
+	links := make([]models.Link, 0, len(docs))
+	for _, doc := range docs {
+		links = append(links, doc.toModel())
+	}
+
+	return links, total, nil
+}
+
+// UpdateURL applies update to the owner's link and returns the updated link.
+// A new expiry reschedules the purge of the link. A new click limit revives a
+// link the former limit expired, unless the new one is used up as well.
+func (s *Storage) UpdateURL(ctx context.Context, alias, ownerID string, update models.LinkUpdate) (models.Link, error) {
+	const op = "storage.mongodb.UpdateURL"
+
+	// The update is a pipeline so that the click limit can depend on the
+	// clicks of the document, "$$REMOVE" unsets a field.
+	const remove = "$$REMOVE"
+	set := bson.D{}
+	if update.URL != nil {
+		set = append(set, bson.E{Key: "url", Value: literal(*update.URL)})
+	}
+	if update.NormalizedURL != nil {
+		set = append(set, bson.E{Key: "normalized_url", Value: literal(*update.NormalizedURL)})
+	}
+	if update.Permanent != nil {
+		set = append(set, bson.E{Key: "permanent", Value: *update.Permanent})
+	}
+	if update.MaxClicks != nil {
+		if *update.MaxClicks == 0 {
+			set = append(set, bson.E{Key: "max_clicks", Value: remove})
+		} else {
+			set = append(set, bson.E{Key: "max_clicks", Value: *update.MaxClicks})
+		}
+	}
+	if update.Disabled != nil {
+		if *update.Disabled {
+			set = append(set, bson.E{Key: "disabled", Value: true})
+		} else {
+			set = append(set, bson.E{Key: "disabled", Value: remove})
+		}
+	}
+
+	switch {
+	case update.ExpiresAt != nil && update.ExpiresAt.IsZero():
+		set = append(set,
+			bson.E{Key: "expires_at", Value: remove},
+			bson.E{Key: "purge_at", Value: remove},
+			bson.E{Key: "exhausted", Value: remove},
+		)
+	case update.ExpiresAt != nil:
+		expiresAt := update.ExpiresAt.UTC()
+		set = append(set,
+			bson.E{Key: "expires_at", Value: expiresAt},
+			bson.E{Key: "purge_at", Value: expiresAt.Add(s.retention)},
+			bson.E{Key: "exhausted", Value: remove},
+		)
+	case update.MaxClicks != nil:
+		revive := bson.A{"$exhausted"}
+		if *update.MaxClicks > 0 {
+			revive = append(revive, bson.D{{Key: "$lt", Value: bson.A{"$clicks", *update.MaxClicks}}})
+		}
+		for _, field := range []string{"expires_at", "purge_at", "exhausted"} {
+			set = append(set, bson.E{Key: field, Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$and", Value: revive}}, remove, "$" + field,
+			}}}})
+		}
+	}
+
+	filter := bson.D{{Key: "alias", Value: alias}, {Key: "owner_id", Value: ownerFilter(ownerID)}}
+
+	var doc URLDocument
+	var err error
+	if len(set) == 0 {
+		err = s.collection.FindOne(ctx, filter).Decode(&doc)
+	} else {
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err = s.collection.FindOneAndUpdate(ctx, filter, mongo.Pipeline{{{Key: "$set", Value: set}}}, opts).Decode(&doc)
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Link{}, storage.ErrURLNotFound
+		}
+		return models.Link{}, fmt.Errorf("%s: update document: %w", op, err)
+	}
+
+	return doc.toModel(), nil
+}
+
+// literal keeps a string value of a pipeline update from being read as a
+// field path or variable.
+func literal(v string) bson.D {
+	return bson.D{{Key: "$literal", Value: v}}
+}
+
+// DeleteURL deletes the owner's link.
+func (s *Storage) DeleteURL(ctx context.Context, alias, ownerID string) error {
+	const op = "storage.mongodb.DeleteURL"
+
+	filter := bson.D{{Key: "alias", Value: alias}, {Key: "owner_id", Value: ownerFilter(ownerID)}}
+
+	res, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("%s: delete document: %w", op, err)
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrURLNotFound
+	}
+
+	return nil
+}
+
+// DeleteOwnerURLs deletes all links of the owner and returns them.
+func (s *Storage) DeleteOwnerURLs(ctx context.Context, ownerID string) ([]models.Link, error) {
+	const op = "storage.mongodb.DeleteOwnerURLs"
+
+	links, filter, err := s.ownerURLs(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	if _, err := s.collection.DeleteMany(ctx, filter); err != nil {
+		return nil, fmt.Errorf("%s: delete documents: %w", op, err)
+	}
+
+	return links, nil
+}
+
+// AnonymizeOwnerURLs removes the owner from all their links, which keep
+// resolving as anonymous links, and returns the links as they were.
+func (s *Storage) AnonymizeOwnerURLs(ctx context.Context, ownerID string) ([]models.Link, error) {
+	const op = "storage.mongodb.AnonymizeOwnerURLs"
+
+	links, filter, err := s.ownerURLs(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	_, err = s.collection.UpdateMany(ctx, filter,
+		bson.D{{Key: "$unset", Value: bson.D{{Key: "owner_id", Value: ""}}}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: update documents: %w", op, err)
+	}
+
+	return links, nil
+}
+
+// TransferOrgURLs hands the links the owner created in the organization over
+// to another owner and returns how many were handed over.
+func (s *Storage) TransferOrgURLs(ctx context.Context, orgID, fromOwnerID, toOwnerID string) (int64, error) {
+	const op = "storage.mongodb.TransferOrgURLs"
+
+	res, err := s.collection.UpdateMany(ctx,
+		bson.D{{Key: "org_id", Value: orgID}, {Key: "owner_id", Value: fromOwnerID}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "owner_id", Value: toOwnerID}}}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: update documents: %w", op, err)
+	}
+
+	return res.ModifiedCount, nil
+}
+
+// ownerURLs returns the links of the owner and a filter matching exactly
+// them, so that links created meanwhile aren't changed without being returned.
+func (s *Storage) ownerURLs(ctx context.Context, ownerID string) ([]models.Link, bson.D, error) {
+	cursor, err := s.collection.Find(ctx, bson.D{{Key: "owner_id", Value: ownerID}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("find documents: %w", err)
+	}
+
+	var docs []URLDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, nil, fmt.Errorf("decode documents: %w", err)
+	}
+
+	links := make([]models.Link, 0, len(docs))
+	aliases := make(bson.A, 0, len(docs))
+	for _, doc := range docs {
+		links = append(links, doc.toModel())
+		aliases = append(aliases, doc.Alias)
+	}
+
+	filter := bson.D{
+		{Key: "owner_id", Value: ownerID},
+		{Key: "alias", Value: bson.D{{Key: "$in", Value: aliases}}},
+	}
+	return links, filter, nil
+}
+
+// orgFilter matches documents of the organization, or personal links, which
+// have no org_id field, for an empty orgID.
+func orgFilter(orgID string) interface{} {
+	if orgID == "" {
+		return bson.D{{Key: "$exists", Value: false}}
+	}
+	return orgID
+}
+
+// ownerFilter matches documents of an anonymous owner, which have no owner_id field at all.
+func ownerFilter(ownerID string) interface{} {
+	if ownerID == "" {
+		return bson.D{{Key: "$exists", Value: false}}
+	}
+	return ownerID
+}
+
+func (d URLDocument) toModel() models.Link {
+	link := models.Link{
+		ID:            d.ID.Hex(),
+		Alias:         d.Alias,
+		URL:           d.URL,
+		NormalizedURL: d.NormalizedURL,
+		OwnerID:       d.OwnerID,
+		OrgID:         d.OrgID,
+		Permanent:     d.Permanent,
+		MaxClicks:     d.MaxClicks,
+		Clicks:        d.Clicks,
+		TotalClicks:   d.TotalClicks,
+		CreatedAt:     d.CreatedAt,
+		Disabled:      d.Disabled,
+	}
+	if d.ExpiresAt != nil {
+		link.ExpiresAt = *d.ExpiresAt
+	}
+	return link
 }
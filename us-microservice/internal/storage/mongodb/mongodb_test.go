@@ -0,0 +1,141 @@
+package mongodb
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"urlSh/internal/domain/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const testRetention = time.Hour
+
+// testStorage connects to the MongoDB of MONGODB_TEST_URI with a collection
+// of the test's own, the test is skipped without one.
+func testStorage(t *testing.T) *Storage {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	collection := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	s, err := New(uri, "urlsh_test", collection, testRetention)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		_ = s.collection.Drop(ctx)
+		_ = s.client.Disconnect(ctx)
+	})
+	return s
+}
+
+func TestUpdateURLReschedulesPurge(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	soon := now.Add(time.Minute)
+	later := now.Add(24 * time.Hour)
+	int64p := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name string
+		link models.Link
+		// clicks are registered before the update.
+		clicks        int
+		update        models.LinkUpdate
+		wantExpiresAt time.Time
+		// wantPurge is whether the link is still scheduled for a purge.
+		wantPurge   bool
+		wantExpired bool
+	}{
+		{
+			name:          "extended expiry",
+			link:          models.Link{ExpiresAt: soon},
+			update:        models.LinkUpdate{ExpiresAt: &later},
+			wantExpiresAt: later,
+			wantPurge:     true,
+		},
+		{
+			name:   "cleared expiry",
+			link:   models.Link{ExpiresAt: soon},
+			update: models.LinkUpdate{ExpiresAt: &time.Time{}},
+		},
+		{
+			name:   "raised limit of a used up link",
+			link:   models.Link{MaxClicks: 2},
+			clicks: 2,
+			update: models.LinkUpdate{MaxClicks: int64p(5)},
+		},
+		{
+			name:   "removed limit of a used up link",
+			link:   models.Link{MaxClicks: 2},
+			clicks: 2,
+			update: models.LinkUpdate{MaxClicks: int64p(0)},
+		},
+		{
+			name:        "limit still used up",
+			link:        models.Link{MaxClicks: 2},
+			clicks:      2,
+			update:      models.LinkUpdate{MaxClicks: int64p(1)},
+			wantPurge:   true,
+			wantExpired: true,
+		},
+		{
+			name:          "raised limit keeps the expiry of the link",
+			link:          models.Link{ExpiresAt: later, MaxClicks: 2},
+			clicks:        2,
+			update:        models.LinkUpdate{MaxClicks: int64p(5)},
+			wantExpiresAt: later,
+			wantPurge:     true,
+		},
+	}
+
+	s := testStorage(t)
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := tt.link
+			link.Alias = strings.ReplaceAll(tt.name, " ", "-")
+			link.URL = "https://example.com"
+			link.CreatedAt = now
+			if _, err := s.SaveURL(ctx, link); err != nil {
+				t.Fatalf("SaveURL() error = %v", err)
+			}
+			for j := 0; j < tt.clicks; j++ {
+				if _, err := s.RegisterClick(ctx, link.Alias); err != nil {
+					t.Fatalf("RegisterClick() error = %v", err)
+				}
+			}
+
+			got, err := s.UpdateURL(ctx, link.Alias, "", tt.update)
+			if err != nil {
+				t.Fatalf("UpdateURL() error = %v", err)
+			}
+
+			// The expiry stamped by a used up limit is the time of the last click.
+			if !tt.wantExpired && !got.ExpiresAt.Equal(tt.wantExpiresAt) {
+				t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, tt.wantExpiresAt)
+			}
+			if expired := got.Expired(time.Now()); expired != tt.wantExpired {
+				t.Errorf("Expired() = %v, want %v", expired, tt.wantExpired)
+			}
+
+			var doc URLDocument
+			if err := s.collection.FindOne(ctx, bson.D{{Key: "alias", Value: link.Alias}}).Decode(&doc); err != nil {
+				t.Fatalf("find document: %v", err)
+			}
+			if (doc.PurgeAt != nil) != tt.wantPurge {
+				t.Fatalf("purge_at = %v, want scheduled %v", doc.PurgeAt, tt.wantPurge)
+			}
+			if doc.PurgeAt != nil && doc.ExpiresAt != nil && !doc.PurgeAt.Equal(doc.ExpiresAt.Add(testRetention)) {
+				t.Errorf("purge_at = %v, want %v", doc.PurgeAt, doc.ExpiresAt.Add(testRetention))
+			}
+		})
+	}
+}
@@ -2,40 +2,238 @@ package redis
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"github.com/redis/go-redis/v9"
+	"os"
 	"time"
+	"urlSh/internal/domain/models"
+	"urlSh/internal/storage"
 )
 
 type Cache struct {
-	client *redis.Client
+	client      redis.UniversalClient
+	dialTimeout time.Duration
 }
 
-func New(addr string) (*Cache, error) {
-	// TODO redis configuration
-	rdb := redis.NewClient(&redis.Options{
-		Addr: addr,
-	})
+// cachedLink is the JSON representation of a link stored in the cache.
+type cachedLink struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Permanent bool      `json:"permanent,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxClicks int64     `json:"max_clicks,omitempty"`
+	Disabled  bool      `json:"disabled,omitempty"`
+	// Missing marks an alias known not to exist.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Options configure the connection. With a sentinel master name the client
+// follows the master through the sentinels at SentinelAddrs, with ClusterAddrs
+// it talks to a cluster, otherwise to the single server at Addr.
+type Options struct {
+	Addr     string
+	Username string
+	Password string
+	// DB selects the database, clusters only have database 0.
+	DB int
+	// PoolSize and MinIdleConns keep the defaults of go-redis when zero.
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	TLS          TLSOptions
+
+	SentinelMaster   string
+	SentinelAddrs    []string
+	SentinelUsername string
+	SentinelPassword string
+
+	ClusterAddrs []string
+}
+
+// TLSOptions enable TLS. CAPath is a PEM bundle trusted besides the system
+// roots, ServerName overrides the name verified in the server certificate.
+type TLSOptions struct {
+	Enabled            bool
+	CAPath             string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// New creates the client, it connects on first use and reconnects on its
+// own. See Ping to check that Redis answers.
+func New(opts Options) (*Cache, error) {
+	const op = "storage.redis.New"
 
-	_, err := rdb.Ping(context.TODO()).Result()
+	tlsConfig, err := opts.TLS.config()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	universal := &redis.UniversalOptions{
+		Addrs:            []string{opts.Addr},
+		Username:         opts.Username,
+		Password:         opts.Password,
+		DB:               opts.DB,
+		PoolSize:         opts.PoolSize,
+		MinIdleConns:     opts.MinIdleConns,
+		DialTimeout:      opts.DialTimeout,
+		ReadTimeout:      opts.ReadTimeout,
+		WriteTimeout:     opts.WriteTimeout,
+		TLSConfig:        tlsConfig,
+		MasterName:       opts.SentinelMaster,
+		SentinelUsername: opts.SentinelUsername,
+		SentinelPassword: opts.SentinelPassword,
+	}
+
+	var rdb redis.UniversalClient
+	switch {
+	case opts.SentinelMaster != "":
+		if len(opts.SentinelAddrs) == 0 {
+			return nil, fmt.Errorf("%s: sentinel addresses are required", op)
+		}
+		universal.Addrs = opts.SentinelAddrs
+		rdb = redis.NewUniversalClient(universal)
+	case len(opts.ClusterAddrs) > 0:
+		if opts.DB != 0 {
+			return nil, fmt.Errorf("%s: clusters only have database 0", op)
+		}
+		universal.Addrs = opts.ClusterAddrs
+		// The universal client takes a single address for a single server.
+		rdb = redis.NewClusterClient(universal.Cluster())
+	default:
+		rdb = redis.NewUniversalClient(universal)
 	}
 
 	return &Cache{
-		client: rdb,
+		client:      rdb,
+		dialTimeout: opts.DialTimeout,
 	}, nil
 }
 
-// SaveURL stores the alias and original URL in the cache with an expiration time
-func (c *Cache) SaveURL(ctx context.Context, originalURL string, alias string, expiration time.Duration) error {
-	return c.client.Set(ctx, alias, originalURL, expiration).Err()
+// Ping checks that Redis answers within the dial timeout.
+func (c *Cache) Ping(ctx context.Context) error {
+	const op = "storage.redis.Ping"
+
+	ctx, cancel := context.WithTimeout(ctx, max(c.dialTimeout, time.Second))
+	defer cancel()
+
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
 }
 
-// GetURL retrieves the original URL from the cache by the alias
-func (c *Cache) GetURL(ctx context.Context, alias string) (string, error) {
-	result, err := c.client.Get(ctx, alias).Result()
+func (o TLSOptions) config() (*tls.Config, error) {
+	if !o.Enabled {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAPath != "" {
+		pem, err := os.ReadFile(o.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("read ca: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", o.CAPath)
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// SaveURL stores the link under its alias in the cache with an expiration time
+func (c *Cache) SaveURL(ctx context.Context, link models.Link, expiration time.Duration) error {
+	value, err := json.Marshal(cachedLink{
+		ID:        link.ID,
+		URL:       link.URL,
+		Permanent: link.Permanent,
+		ExpiresAt: link.ExpiresAt,
+		MaxClicks: link.MaxClicks,
+		Disabled:  link.Disabled,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.client.Set(ctx, link.Alias, value, expiration).Err()
+}
+
+// GetURL retrieves the link from the cache by the alias. Aliases saved as
+// missing fail with storage.ErrURLNotFound.
+func (c *Cache) GetURL(ctx context.Context, alias string) (models.Link, error) {
+	result, err := c.client.Get(ctx, alias).Bytes()
+	if err == redis.Nil {
+		return models.Link{}, nil // Alias not found in cache
+	} else if err != nil {
+		return models.Link{}, err
+	}
+
+	var cached cachedLink
+	if err := json.Unmarshal(result, &cached); err != nil {
+		return models.Link{}, err
+	}
+	if cached.Missing {
+		return models.Link{}, storage.ErrURLNotFound
+	}
+	// Links cached before they carried their ID are loaded again.
+	if cached.ID == "" {
+		return models.Link{}, nil
+	}
+
+	return models.Link{
+		ID:        cached.ID,
+		Alias:     alias,
+		URL:       cached.URL,
+		Permanent: cached.Permanent,
+		ExpiresAt: cached.ExpiresAt,
+		MaxClicks: cached.MaxClicks,
+		Disabled:  cached.Disabled,
+	}, nil
+}
+
+// SaveMissing remembers that the alias doesn't exist. A link cached under the
+// alias in the meantime is kept, and saving one replaces the entry.
+func (c *Cache) SaveMissing(ctx context.Context, alias string, expiration time.Duration) error {
+	value, err := json.Marshal(cachedLink{Missing: true})
+	if err != nil {
+		return err
+	}
+
+	return c.client.SetNX(ctx, alias, value, expiration).Err()
+}
+
+// DeleteURL removes the link stored under alias from the cache
+func (c *Cache) DeleteURL(ctx context.Context, alias string) error {
+	return c.client.Del(ctx, alias).Err()
+}
+
+// SaveAlias stores the reverse mapping from the owner's normalized URL to its alias
+func (c *Cache) SaveAlias(ctx context.Context, ownerID, normalizedURL, alias string, expiration time.Duration) error {
+	return c.client.Set(ctx, reverseKey(ownerID, normalizedURL), alias, expiration).Err()
+}
+
+// GetAlias retrieves the alias of the owner's normalized URL from the cache
+func (c *Cache) GetAlias(ctx context.Context, ownerID, normalizedURL string) (string, error) {
+	result, err := c.client.Get(ctx, reverseKey(ownerID, normalizedURL)).Result()
 	if err == redis.Nil {
-		return "", nil // Alias not found in cache
+		return "", nil // URL not found in cache
 	} else if err != nil {
 		return "", err
 	}
@@ -43,6 +241,18 @@ func (c *Cache) GetURL(ctx context.Context, alias string) (string, error) {
 	return result, nil
 }
 
+// DeleteAlias removes the reverse mapping of the owner's normalized URL from the cache
+func (c *Cache) DeleteAlias(ctx context.Context, ownerID, normalizedURL string) error {
+	return c.client.Del(ctx, reverseKey(ownerID, normalizedURL)).Err()
+}
+
+// reverseKey builds the key of a reverse lookup entry. The URL is hashed to keep
+// keys short and to avoid clashing with alias keys, which never contain ':'.
+func reverseKey(ownerID, normalizedURL string) string {
+	sum := sha256.Sum256([]byte(normalizedURL))
+	return "rev:" + ownerID + ":" + hex.EncodeToString(sum[:])
+}
+
 // Close closes the Redis client connection
 func (c *Cache) Close() error {
 	return c.client.Close()
@@ -7,4 +7,5 @@ import (
 var (
 	ErrURLNotFound = fmt.Errorf("url not found")
 	ErrURLExists   = fmt.Errorf("url already exists")
+	ErrURLExpired  = fmt.Errorf("url expired")
 )
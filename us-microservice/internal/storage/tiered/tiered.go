@@ -0,0 +1,404 @@
+// Package tiered is a read-through link cache in front of the database: a
+// bounded in-process LRU backed by a shared remote cache, usually Redis.
+// Unknown aliases are remembered for a short time in both tiers, so that
+// probing random aliases doesn't reach the database. Entries the remote tier
+// failed to remove are retried in the background, until then they are
+// neither read from nor backfilled into it by this instance.
+package tiered
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"urlSh/internal/domain/models"
+	"urlSh/internal/storage"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"golang.org/x/sync/singleflight"
+)
+
+// Remote is the shared cache tier, see redis.Cache.
+type Remote interface {
+	SaveURL(ctx context.Context, link models.Link, expiration time.Duration) error
+	// GetURL returns an empty link on a miss and storage.ErrURLNotFound for
+	// aliases saved as missing.
+	GetURL(ctx context.Context, alias string) (models.Link, error)
+	SaveMissing(ctx context.Context, alias string, expiration time.Duration) error
+	DeleteURL(ctx context.Context, alias string) error
+	SaveAlias(ctx context.Context, ownerID, normalizedURL, alias string, expiration time.Duration) error
+	GetAlias(ctx context.Context, ownerID, normalizedURL string) (string, error)
+	DeleteAlias(ctx context.Context, ownerID, normalizedURL string) error
+}
+
+// defaultLoadTimeout bounds the shared lookups of a miss when Options don't.
+const defaultLoadTimeout = 5 * time.Second
+
+// Loader loads a link missing from both tiers, typically from the database.
+type Loader func(ctx context.Context, alias string) (models.Link, error)
+
+// Options configure the cache. Changes made through another instance reach
+// the local tier only when its entries expire, keep LocalTTL short.
+type Options struct {
+	LocalSize int
+	LocalTTL  time.Duration
+	// RemoteTTL is the expiration of links backfilled into the remote tier,
+	// they never outlive the link itself.
+	RemoteTTL time.Duration
+	// NegativeTTL is how long unknown aliases are remembered, not at all when
+	// zero. Links created meanwhile through another instance stay unknown to
+	// its local tier until then.
+	NegativeTTL time.Duration
+	// StatsInterval is how often the lookup counters are logged, never when zero.
+	StatsInterval time.Duration
+	// RetryInterval is how often failed removals from the remote tier are
+	// retried.
+	RetryInterval time.Duration
+	// LoadTimeout bounds the remote lookup and load of a miss, which outlive
+	// the cancellation of the caller they were started by. Five seconds when
+	// zero.
+	LoadTimeout time.Duration
+	// Degrade logs failing saves to and reads from the remote tier instead of
+	// failing them, lookups fall through to the loader either way. Failing
+	// removals are always returned, they are retried in the background.
+	Degrade bool
+}
+
+type counters struct {
+	localHits, localMisses   atomic.Int64
+	remoteHits, remoteMisses atomic.Int64
+	negativeHits             atomic.Int64
+	loads, loadErrors        atomic.Int64
+}
+
+// invalidation is an entry to remove from the remote tier, the link of Alias
+// or, without one, the reverse mapping of OwnerID and NormalizedURL.
+type invalidation struct {
+	Alias         string
+	OwnerID       string
+	NormalizedURL string
+}
+
+type Cache struct {
+	log   *slog.Logger
+	local *expirable.LRU[string, models.Link]
+	// missing holds the unknown aliases apart from the links, so that
+	// probing random aliases can't evict cached links.
+	missing *expirable.LRU[string, struct{}]
+	remote  Remote
+	load    Loader
+	opts    Options
+	loads   singleflight.Group
+	stats   counters
+	done    chan struct{}
+
+	mu      sync.Mutex
+	pending map[invalidation]struct{}
+}
+
+// New creates the cache. Without a remote tier only the local one is used.
+func New(log *slog.Logger, remote Remote, load Loader, opts Options) *Cache {
+	if opts.LoadTimeout <= 0 {
+		opts.LoadTimeout = defaultLoadTimeout
+	}
+	c := &Cache{
+		log:     log,
+		local:   expirable.NewLRU[string, models.Link](opts.LocalSize, nil, opts.LocalTTL),
+		missing: expirable.NewLRU[string, struct{}](opts.LocalSize, nil, opts.NegativeTTL),
+		remote:  remote,
+		load:    load,
+		opts:    opts,
+		done:    make(chan struct{}),
+		pending: make(map[invalidation]struct{}),
+	}
+	if opts.StatsInterval > 0 {
+		go c.reportStats(opts.StatsInterval)
+	}
+	if remote != nil && opts.RetryInterval > 0 {
+		go c.retryInvalidations(opts.RetryInterval)
+	}
+	return c
+}
+
+// SaveURL stores the link in both tiers. When the remote tier fails the
+// alias is removed from it later, it may still be remembered as unknown.
+func (c *Cache) SaveURL(ctx context.Context, link models.Link, expiration time.Duration) error {
+	c.missing.Remove(link.Alias)
+	c.local.Add(link.Alias, link)
+	if c.remote == nil {
+		return nil
+	}
+	if err := c.remote.SaveURL(ctx, link, expiration); err != nil {
+		c.queue(invalidation{Alias: link.Alias})
+		return c.remoteErr(err)
+	}
+	return nil
+}
+
+// GetURL returns the link of the alias from the first tier holding it, or
+// loads it and backfills both tiers. Concurrent misses of an alias share one
+// remote lookup and load. Unknown aliases fail with the error of the loader.
+func (c *Cache) GetURL(ctx context.Context, alias string) (models.Link, error) {
+	if link, ok := c.local.Get(alias); ok {
+		c.stats.localHits.Add(1)
+		return link, nil
+	}
+	if c.missing.Contains(alias) {
+		c.stats.negativeHits.Add(1)
+		return models.Link{}, storage.ErrURLNotFound
+	}
+	c.stats.localMisses.Add(1)
+
+	// The first caller's cancellation must not fail the others waiting on it,
+	// the timeout keeps a hanging lookup from blocking them all for good.
+	v, err, _ := c.loads.Do(alias, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.opts.LoadTimeout)
+		defer cancel()
+		return c.fetch(ctx, alias)
+	})
+	if err != nil {
+		return models.Link{}, err
+	}
+	return v.(models.Link), nil
+}
+
+func (c *Cache) fetch(ctx context.Context, alias string) (models.Link, error) {
+	// The remote tier may hold a stale copy until the removal succeeds.
+	remote := c.remote != nil && !c.isPending(invalidation{Alias: alias})
+	if remote {
+		link, err := c.remote.GetURL(ctx, alias)
+		switch {
+		case errors.Is(err, storage.ErrURLNotFound):
+			c.stats.negativeHits.Add(1)
+			c.rememberMissing(alias)
+			return models.Link{}, err
+		case err != nil:
+			c.log.Warn("remote cache lookup failed", slog.String("err", err.Error()))
+		case link.URL != "":
+			c.stats.remoteHits.Add(1)
+			c.local.Add(alias, link)
+			return link, nil
+		}
+		c.stats.remoteMisses.Add(1)
+	}
+
+	c.stats.loads.Add(1)
+	link, err := c.load(ctx, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrURLNotFound) {
+			c.saveMissing(ctx, alias)
+			return models.Link{}, err
+		}
+		c.stats.loadErrors.Add(1)
+		return models.Link{}, err
+	}
+
+	c.local.Add(alias, link)
+	if remote {
+		if err := c.remote.SaveURL(ctx, link, c.expiration(link)); err != nil {
+			c.log.Warn("failed to backfill remote cache", slog.String("err", err.Error()))
+		}
+	}
+	return link, nil
+}
+
+// saveMissing remembers the unknown alias in both tiers.
+func (c *Cache) saveMissing(ctx context.Context, alias string) {
+	if c.opts.NegativeTTL <= 0 {
+		return
+	}
+	c.rememberMissing(alias)
+	if c.remote != nil && !c.isPending(invalidation{Alias: alias}) {
+		if err := c.remote.SaveMissing(ctx, alias, c.opts.NegativeTTL); err != nil {
+			c.log.Warn("failed to cache unknown alias", slog.String("err", err.Error()))
+		}
+	}
+}
+
+func (c *Cache) rememberMissing(alias string) {
+	if c.opts.NegativeTTL > 0 {
+		c.missing.Add(alias, struct{}{})
+	}
+}
+
+// DeleteURL removes the link from both tiers. When the remote tier fails the
+// error is returned and the removal is retried in the background.
+func (c *Cache) DeleteURL(ctx context.Context, alias string) error {
+	c.local.Remove(alias)
+	if c.remote == nil {
+		return nil
+	}
+	return c.invalidate(ctx, invalidation{Alias: alias})
+}
+
+// SaveAlias stores the reverse mapping in the remote tier only, it is read
+// on shortening, not on the hot path of resolving.
+func (c *Cache) SaveAlias(ctx context.Context, ownerID, normalizedURL, alias string, expiration time.Duration) error {
+	if c.remote == nil {
+		return nil
+	}
+	return c.remoteErr(c.remote.SaveAlias(ctx, ownerID, normalizedURL, alias, expiration))
+}
+
+func (c *Cache) GetAlias(ctx context.Context, ownerID, normalizedURL string) (string, error) {
+	if c.remote == nil || c.isPending(invalidation{OwnerID: ownerID, NormalizedURL: normalizedURL}) {
+		return "", nil
+	}
+	alias, err := c.remote.GetAlias(ctx, ownerID, normalizedURL)
+	return alias, c.remoteErr(err)
+}
+
+// DeleteAlias removes the reverse mapping, failures are retried like those
+// of DeleteURL.
+func (c *Cache) DeleteAlias(ctx context.Context, ownerID, normalizedURL string) error {
+	if c.remote == nil {
+		return nil
+	}
+	return c.invalidate(ctx, invalidation{OwnerID: ownerID, NormalizedURL: normalizedURL})
+}
+
+// invalidate removes the entry from the remote tier, or queues it for a
+// retry when that fails.
+func (c *Cache) invalidate(ctx context.Context, inv invalidation) error {
+	if err := c.remove(ctx, inv); err != nil {
+		c.queue(inv)
+		return err
+	}
+	return nil
+}
+
+func (c *Cache) remove(ctx context.Context, inv invalidation) error {
+	if inv.Alias != "" {
+		return c.remote.DeleteURL(ctx, inv.Alias)
+	}
+	return c.remote.DeleteAlias(ctx, inv.OwnerID, inv.NormalizedURL)
+}
+
+func (c *Cache) queue(inv invalidation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[inv] = struct{}{}
+}
+
+func (c *Cache) isPending(inv invalidation) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.pending[inv]
+	return ok
+}
+
+// retryInvalidations removes the queued entries from the remote tier until
+// it succeeds.
+func (c *Cache) retryInvalidations(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.retryPending(context.Background())
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Cache) retryPending(ctx context.Context) {
+	c.mu.Lock()
+	pending := make([]invalidation, 0, len(c.pending))
+	for inv := range c.pending {
+		pending = append(pending, inv)
+	}
+	c.mu.Unlock()
+
+	for _, inv := range pending {
+		if err := c.remove(ctx, inv); err != nil {
+			c.log.Warn("remote cache invalidation failed, retrying",
+				slog.Int("pending", len(pending)),
+				slog.String("err", err.Error()),
+			)
+			return
+		}
+		c.mu.Lock()
+		delete(c.pending, inv)
+		c.mu.Unlock()
+	}
+}
+
+// remoteErr returns err of the remote tier, or logs it and returns nil when
+// degrading.
+func (c *Cache) remoteErr(err error) error {
+	if err == nil || !c.opts.Degrade {
+		return err
+	}
+	c.log.Warn("remote cache unavailable", slog.String("err", err.Error()))
+	return nil
+}
+
+// Stats returns the lookup counters.
+func (c *Cache) Stats() models.CacheStats {
+	return models.CacheStats{
+		LocalHits:            c.stats.localHits.Load(),
+		LocalMisses:          c.stats.localMisses.Load(),
+		RemoteHits:           c.stats.remoteHits.Load(),
+		RemoteMisses:         c.stats.remoteMisses.Load(),
+		NegativeHits:         c.stats.negativeHits.Load(),
+		Loads:                c.stats.loads.Load(),
+		LoadErrors:           c.stats.loadErrors.Load(),
+		PendingInvalidations: c.pendingCount(),
+		LocalSize:            c.local.Len(),
+	}
+}
+
+func (c *Cache) pendingCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// LogStats logs the lookup counters.
+func (c *Cache) LogStats() {
+	s := c.Stats()
+	c.log.Info("link cache stats",
+		slog.Int64("local_hits", s.LocalHits),
+		slog.Int64("local_misses", s.LocalMisses),
+		slog.Int64("remote_hits", s.RemoteHits),
+		slog.Int64("remote_misses", s.RemoteMisses),
+		slog.Int64("negative_hits", s.NegativeHits),
+		slog.Int64("loads", s.Loads),
+		slog.Int64("load_errors", s.LoadErrors),
+		slog.Int("local_size", s.LocalSize),
+		slog.Int("pending_invalidations", s.PendingInvalidations),
+	)
+}
+
+func (c *Cache) reportStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.LogStats()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops logging the counters and retrying invalidations, and logs the
+// counters a last time.
+func (c *Cache) Close() {
+	close(c.done)
+	c.LogStats()
+}
+
+// expiration returns the remote expiration of a backfilled link.
+func (c *Cache) expiration(link models.Link) time.Duration {
+	if link.ExpiresAt.IsZero() {
+		return c.opts.RemoteTTL
+	}
+	return max(min(time.Until(link.ExpiresAt), c.opts.RemoteTTL), time.Second)
+}
@@ -0,0 +1,255 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"urlSh/internal/domain/models"
+	"urlSh/internal/storage"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// fakeRemote is an in-memory remote tier that fails every call while err is set.
+type fakeRemote struct {
+	links   map[string]models.Link
+	missing map[string]bool
+	err     error
+}
+
+func newFakeRemote() *fakeRemote {
+	return &fakeRemote{links: make(map[string]models.Link), missing: make(map[string]bool)}
+}
+
+func (r *fakeRemote) SaveURL(_ context.Context, link models.Link, _ time.Duration) error {
+	if r.err != nil {
+		return r.err
+	}
+	delete(r.missing, link.Alias)
+	r.links[link.Alias] = link
+	return nil
+}
+
+func (r *fakeRemote) GetURL(_ context.Context, alias string) (models.Link, error) {
+	if r.err != nil {
+		return models.Link{}, r.err
+	}
+	if r.missing[alias] {
+		return models.Link{}, storage.ErrURLNotFound
+	}
+	return r.links[alias], nil
+}
+
+func (r *fakeRemote) SaveMissing(_ context.Context, alias string, _ time.Duration) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.missing[alias] = true
+	return nil
+}
+
+func (r *fakeRemote) DeleteURL(_ context.Context, alias string) error {
+	if r.err != nil {
+		return r.err
+	}
+	delete(r.links, alias)
+	delete(r.missing, alias)
+	return nil
+}
+
+func (r *fakeRemote) SaveAlias(context.Context, string, string, string, time.Duration) error {
+	return r.err
+}
+
+func (r *fakeRemote) GetAlias(context.Context, string, string) (string, error) {
+	return "", r.err
+}
+
+func (r *fakeRemote) DeleteAlias(context.Context, string, string) error {
+	return r.err
+}
+
+func newTestCache(remote Remote, links map[string]models.Link, loadErr error) *Cache {
+	load := func(_ context.Context, alias string) (models.Link, error) {
+		if loadErr != nil {
+			return models.Link{}, loadErr
+		}
+		link, ok := links[alias]
+		if !ok {
+			return models.Link{}, storage.ErrURLNotFound
+		}
+		return link, nil
+	}
+
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), remote, load, Options{
+		LocalSize:   10,
+		LocalTTL:    time.Minute,
+		RemoteTTL:   time.Hour,
+		NegativeTTL: time.Minute,
+	})
+}
+
+func TestCacheGetURL(t *testing.T) {
+	link := models.Link{Alias: "abc", URL: "https://example.com"}
+	stale := models.Link{Alias: "abc", URL: "https://stale.example.com"}
+
+	tests := []struct {
+		name string
+		// noRemote runs the cache with the local tier only.
+		noRemote bool
+		setup    func(c *Cache, r *fakeRemote)
+		loadErr  error
+		// lookups is the number of times the alias is looked up, once when zero.
+		lookups    int
+		want       models.Link
+		wantErr    error
+		wantStats  models.CacheStats
+		wantRemote models.Link
+	}{
+		{
+			name:       "load and backfill",
+			want:       link,
+			wantStats:  models.CacheStats{LocalMisses: 1, RemoteMisses: 1, Loads: 1, LocalSize: 1},
+			wantRemote: link,
+		},
+		{
+			name:       "local hit",
+			lookups:    2,
+			want:       link,
+			wantStats:  models.CacheStats{LocalHits: 1, LocalMisses: 1, RemoteMisses: 1, Loads: 1, LocalSize: 1},
+			wantRemote: link,
+		},
+		{
+			name:       "remote hit",
+			setup:      func(c *Cache, r *fakeRemote) { r.links["abc"] = link },
+			want:       link,
+			wantStats:  models.CacheStats{LocalMisses: 1, RemoteHits: 1, LocalSize: 1},
+			wantRemote: link,
+		},
+		{
+			name:      "unknown alias",
+			loadErr:   storage.ErrURLNotFound,
+			lookups:   2,
+			wantErr:   storage.ErrURLNotFound,
+			wantStats: models.CacheStats{LocalMisses: 1, RemoteMisses: 1, Loads: 1, NegativeHits: 1},
+		},
+		{
+			name:      "alias remembered as unknown remotely",
+			setup:     func(c *Cache, r *fakeRemote) { r.missing["abc"] = true },
+			wantErr:   storage.ErrURLNotFound,
+			wantStats: models.CacheStats{LocalMisses: 1, NegativeHits: 1},
+		},
+		{
+			name:      "remote tier unavailable",
+			setup:     func(c *Cache, r *fakeRemote) { r.err = errUnavailable },
+			want:      link,
+			wantStats: models.CacheStats{LocalMisses: 1, RemoteMisses: 1, Loads: 1, LocalSize: 1},
+		},
+		{
+			name:      "load error",
+			loadErr:   errUnavailable,
+			wantErr:   errUnavailable,
+			wantStats: models.CacheStats{LocalMisses: 1, RemoteMisses: 1, Loads: 1, LoadErrors: 1},
+		},
+		{
+			name: "pending invalidation skips the remote tier",
+			setup: func(c *Cache, r *fakeRemote) {
+				r.links["abc"] = stale
+				c.queue(invalidation{Alias: "abc"})
+			},
+			want:       link,
+			wantStats:  models.CacheStats{LocalMisses: 1, Loads: 1, PendingInvalidations: 1, LocalSize: 1},
+			wantRemote: stale,
+		},
+		{
+			name:      "local tier only",
+			noRemote:  true,
+			lookups:   2,
+			want:      link,
+			wantStats: models.CacheStats{LocalHits: 1, LocalMisses: 1, Loads: 1, LocalSize: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeRemote()
+			var remote Remote = r
+			if tt.noRemote {
+				remote = nil
+			}
+			c := newTestCache(remote, map[string]models.Link{"abc": link}, tt.loadErr)
+			if tt.setup != nil {
+				tt.setup(c, r)
+			}
+
+			var got models.Link
+			var err error
+			for i := 0; i < max(tt.lookups, 1); i++ {
+				got, err = c.GetURL(context.Background(), "abc")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetURL() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetURL() = %+v, want %+v", got, tt.want)
+			}
+			if stats := c.Stats(); stats != tt.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", stats, tt.wantStats)
+			}
+			if r.links["abc"] != tt.wantRemote {
+				t.Errorf("remote link = %+v, want %+v", r.links["abc"], tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestCacheRetryPending(t *testing.T) {
+	link := models.Link{Alias: "abc", URL: "https://example.com"}
+	r := newFakeRemote()
+	r.links["abc"] = link
+	c := newTestCache(r, nil, nil)
+	ctx := context.Background()
+
+	r.err = errUnavailable
+	if err := c.DeleteURL(ctx, "abc"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("DeleteURL() error = %v, want %v", err, errUnavailable)
+	}
+	if got := c.Stats().PendingInvalidations; got != 1 {
+		t.Fatalf("pending invalidations = %d, want 1", got)
+	}
+
+	// The remote tier still holds the deleted link, lookups must not return it.
+	r.err = nil
+	if _, err := c.GetURL(ctx, "abc"); !errors.Is(err, storage.ErrURLNotFound) {
+		t.Fatalf("GetURL() error = %v, want %v", err, storage.ErrURLNotFound)
+	}
+
+	c.retryPending(ctx)
+	if got := c.Stats().PendingInvalidations; got != 0 {
+		t.Errorf("pending invalidations after retry = %d, want 0", got)
+	}
+	if _, ok := r.links["abc"]; ok {
+		t.Error("remote tier still holds the deleted link")
+	}
+}
+
+func TestCacheGetURLLoadTimeout(t *testing.T) {
+	load := func(ctx context.Context, alias string) (models.Link, error) {
+		<-ctx.Done()
+		return models.Link{}, ctx.Err()
+	}
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, load, Options{
+		LocalSize:   10,
+		LocalTTL:    time.Minute,
+		LoadTimeout: 10 * time.Millisecond,
+	})
+
+	// The caller's own context never ends, the load must not hang with it.
+	_, err := c.GetURL(context.Background(), "abc")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetURL() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,470 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.1
+// source: urlshortener.proto
+
+package urlShortener_microservice
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	UrlShorteningService_ShortenUrl_FullMethodName       = "/urlSh.UrlShorteningService/ShortenUrl"
+	UrlShorteningService_GetOriginalUrl_FullMethodName   = "/urlSh.UrlShorteningService/GetOriginalUrl"
+	UrlShorteningService_GetLinkStats_FullMethodName     = "/urlSh.UrlShorteningService/GetLinkStats"
+	UrlShorteningService_ListLinks_FullMethodName        = "/urlSh.UrlShorteningService/ListLinks"
+	UrlShorteningService_GetLink_FullMethodName          = "/urlSh.UrlShorteningService/GetLink"
+	UrlShorteningService_UpdateLink_FullMethodName       = "/urlSh.UrlShorteningService/UpdateLink"
+	UrlShorteningService_DeleteLink_FullMethodName       = "/urlSh.UrlShorteningService/DeleteLink"
+	UrlShorteningService_DeleteUserLinks_FullMethodName  = "/urlSh.UrlShorteningService/DeleteUserLinks"
+	UrlShorteningService_TransferOrgLinks_FullMethodName = "/urlSh.UrlShorteningService/TransferOrgLinks"
+	UrlShorteningService_GetCacheStats_FullMethodName    = "/urlSh.UrlShorteningService/GetCacheStats"
+)
+
+// UrlShorteningServiceClient is the client API for UrlShorteningService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UrlShorteningServiceClient interface {
+	// Shortens a given original URL and returns the shortened URL.
+	ShortenUrl(ctx context.Context, in *ShortenUrlRequest, opts ...grpc.CallOption) (*ShortenUrlResponse, error)
+	// Retrieves the original URL for a given shortened URL.
+	GetOriginalUrl(ctx context.Context, in *GetOriginalUrlRequest, opts ...grpc.CallOption) (*GetOriginalUrlResponse, error)
+	// Returns click statistics of a shortened URL.
+	GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*GetLinkStatsResponse, error)
+	// Lists the links owned by the calling user.
+	ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error)
+	// Returns a link owned by the calling user.
+	GetLink(ctx context.Context, in *GetLinkRequest, opts ...grpc.CallOption) (*Link, error)
+	// Updates a link owned by the calling user.
+	UpdateLink(ctx context.Context, in *UpdateLinkRequest, opts ...grpc.CallOption) (*Link, error)
+	// Deletes a link owned by the calling user.
+	DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error)
+	// Deletes all links owned by the calling user, or with anonymize keeps them
+	// resolving without an owner. Called when the user deletes their account.
+	DeleteUserLinks(ctx context.Context, in *DeleteUserLinksRequest, opts ...grpc.CallOption) (*DeleteUserLinksResponse, error)
+	// Hands the links a member created in an organization over to another
+	// member. Called when the member leaves, it needs the admin or owner role
+	// in the organization unless the member leaves on their own.
+	TransferOrgLinks(ctx context.Context, in *TransferOrgLinksRequest, opts ...grpc.CallOption) (*TransferOrgLinksResponse, error)
+	// Returns the lookup counters of the link cache of the instance answering,
+	// it needs the links:read:any permission.
+	GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*CacheStats, error)
+}
+
+type urlShorteningServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUrlShorteningServiceClient(cc grpc.ClientConnInterface) UrlShorteningServiceClient {
+	return &urlShorteningServiceClient{cc}
+}
+
+func (c *urlShorteningServiceClient) ShortenUrl(ctx context.Context, in *ShortenUrlRequest, opts ...grpc.CallOption) (*ShortenUrlResponse, error) {
+	out := new(ShortenUrlResponse)
+	err := c.cc.Invoke(ctx, UrlShorteningService_ShortenUrl_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) GetOriginalUrl(ctx context.Context, in *GetOriginalUrlRequest, opts ...grpc.CallOption) (*GetOriginalUrlResponse, error) {
+	out := new(GetOriginalUrlResponse)
+	err := c.cc.Invoke(ctx, UrlShorteningService_GetOriginalUrl_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*GetLinkStatsResponse, error) {
+	out := new(GetLinkStatsResponse)
+	err := c.cc.Invoke(ctx, UrlShorteningService_GetLinkStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error) {
+	out := new(ListLinksResponse)
+	err := c.cc.Invoke(ctx, UrlShorteningService_ListLinks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) GetLink(ctx context.Context, in *GetLinkRequest, opts ...grpc.CallOption) (*Link, error) {
+	out := new(Link)
+	err := c.cc.Invoke(ctx, UrlShorteningService_GetLink_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) UpdateLink(ctx context.Context, in *UpdateLinkRequest, opts ...grpc.CallOption) (*Link, error) {
+	out := new(Link)
+	err := c.cc.Invoke(ctx, UrlShorteningService_UpdateLink_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error) {
+	out := new(DeleteLinkResponse)
+	err := c.cc.Invoke(ctx, UrlShorteningService_DeleteLink_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) DeleteUserLinks(ctx context.Context, in *DeleteUserLinksRequest, opts ...grpc.CallOption) (*DeleteUserLinksResponse, error) {
+	out := new(DeleteUserLinksResponse)
+	err := c.cc.Invoke(ctx, UrlShorteningService_DeleteUserLinks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) TransferOrgLinks(ctx context.Context, in *TransferOrgLinksRequest, opts ...grpc.CallOption) (*TransferOrgLinksResponse, error) {
+	out := new(TransferOrgLinksResponse)
+	err := c.cc.Invoke(ctx, UrlShorteningService_TransferOrgLinks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShorteningServiceClient) GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*CacheStats, error) {
+	out := new(CacheStats)
+	err := c.cc.Invoke(ctx, UrlShorteningService_GetCacheStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UrlShorteningServiceServer is the server API for UrlShorteningService service.
+// All implementations must embed UnimplementedUrlShorteningServiceServer
+// for forward compatibility
+type UrlShorteningServiceServer interface {
+	// Shortens a given original URL and returns the shortened URL.
+	ShortenUrl(context.Context, *ShortenUrlRequest) (*ShortenUrlResponse, error)
+	// Retrieves the original URL for a given shortened URL.
+	GetOriginalUrl(context.Context, *GetOriginalUrlRequest) (*GetOriginalUrlResponse, error)
+	// Returns click statistics of a shortened URL.
+	GetLinkStats(context.Context, *GetLinkStatsRequest) (*GetLinkStatsResponse, error)
+	// Lists the links owned by the calling user.
+	ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error)
+	// Returns a link owned by the calling user.
+	GetLink(context.Context, *GetLinkRequest) (*Link, error)
+	// Updates a link owned by the calling user.
+	UpdateLink(context.Context, *UpdateLinkRequest) (*Link, error)
+	// Deletes a link owned by the calling user.
+	DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error)
+	// Deletes all links owned by the calling user, or with anonymize keeps them
+	// resolving without an owner. Called when the user deletes their account.
+	DeleteUserLinks(context.Context, *DeleteUserLinksRequest) (*DeleteUserLinksResponse, error)
+	// Hands the links a member created in an organization over to another
+	// member. Called when the member leaves, it needs the admin or owner role
+	// in the organization unless the member leaves on their own.
+	TransferOrgLinks(context.Context, *TransferOrgLinksRequest) (*TransferOrgLinksResponse, error)
+	// Returns the lookup counters of the link cache of the instance answering,
+	// it needs the links:read:any permission.
+	GetCacheStats(context.Context, *GetCacheStatsRequest) (*CacheStats, error)
+	mustEmbedUnimplementedUrlShorteningServiceServer()
+}
+
+// UnimplementedUrlShorteningServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedUrlShorteningServiceServer struct {
+}
+
+func (UnimplementedUrlShorteningServiceServer) ShortenUrl(context.Context, *ShortenUrlRequest) (*ShortenUrlResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ShortenUrl not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) GetOriginalUrl(context.Context, *GetOriginalUrlRequest) (*GetOriginalUrlResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOriginalUrl not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) GetLinkStats(context.Context, *GetLinkStatsRequest) (*GetLinkStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkStats not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLinks not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) GetLink(context.Context, *GetLinkRequest) (*Link, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLink not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) UpdateLink(context.Context, *UpdateLinkRequest) (*Link, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateLink not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLink not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) DeleteUserLinks(context.Context, *DeleteUserLinksRequest) (*DeleteUserLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUserLinks not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) TransferOrgLinks(context.Context, *TransferOrgLinksRequest) (*TransferOrgLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferOrgLinks not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) GetCacheStats(context.Context, *GetCacheStatsRequest) (*CacheStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCacheStats not implemented")
+}
+func (UnimplementedUrlShorteningServiceServer) mustEmbedUnimplementedUrlShorteningServiceServer() {}
+
+// UnsafeUrlShorteningServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UrlShorteningServiceServer will
+// result in compilation errors.
+type UnsafeUrlShorteningServiceServer interface {
+	mustEmbedUnimplementedUrlShorteningServiceServer()
+}
+
+func RegisterUrlShorteningServiceServer(s grpc.ServiceRegistrar, srv UrlShorteningServiceServer) {
+	s.RegisterService(&UrlShorteningService_ServiceDesc, srv)
+}
+
+func _UrlShorteningService_ShortenUrl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShortenUrlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).ShortenUrl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_ShortenUrl_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).ShortenUrl(ctx, req.(*ShortenUrlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_GetOriginalUrl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOriginalUrlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).GetOriginalUrl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_GetOriginalUrl_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).GetOriginalUrl(ctx, req.(*GetOriginalUrlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_GetLinkStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).GetLinkStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_GetLinkStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).GetLinkStats(ctx, req.(*GetLinkStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_ListLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).ListLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_ListLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).ListLinks(ctx, req.(*ListLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_GetLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).GetLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_GetLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).GetLink(ctx, req.(*GetLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_UpdateLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).UpdateLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_UpdateLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).UpdateLink(ctx, req.(*UpdateLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_DeleteLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).DeleteLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_DeleteLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).DeleteLink(ctx, req.(*DeleteLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_DeleteUserLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUserLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).DeleteUserLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_DeleteUserLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).DeleteUserLinks(ctx, req.(*DeleteUserLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_TransferOrgLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferOrgLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).TransferOrgLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_TransferOrgLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).TransferOrgLinks(ctx, req.(*TransferOrgLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShorteningService_GetCacheStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCacheStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShorteningServiceServer).GetCacheStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UrlShorteningService_GetCacheStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShorteningServiceServer).GetCacheStats(ctx, req.(*GetCacheStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UrlShorteningService_ServiceDesc is the grpc.ServiceDesc for UrlShorteningService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UrlShorteningService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "urlSh.UrlShorteningService",
+	HandlerType: (*UrlShorteningServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ShortenUrl",
+			Handler:    _UrlShorteningService_ShortenUrl_Handler,
+		},
+		{
+			MethodName: "GetOriginalUrl",
+			Handler:    _UrlShorteningService_GetOriginalUrl_Handler,
+		},
+		{
+			MethodName: "GetLinkStats",
+			Handler:    _UrlShorteningService_GetLinkStats_Handler,
+		},
+		{
+			MethodName: "ListLinks",
+			Handler:    _UrlShorteningService_ListLinks_Handler,
+		},
+		{
+			MethodName: "GetLink",
+			Handler:    _UrlShorteningService_GetLink_Handler,
+		},
+		{
+			MethodName: "UpdateLink",
+			Handler:    _UrlShorteningService_UpdateLink_Handler,
+		},
+		{
+			MethodName: "DeleteLink",
+			Handler:    _UrlShorteningService_DeleteLink_Handler,
+		},
+		{
+			MethodName: "DeleteUserLinks",
+			Handler:    _UrlShorteningService_DeleteUserLinks_Handler,
+		},
+		{
+			MethodName: "TransferOrgLinks",
+			Handler:    _UrlShorteningService_TransferOrgLinks_Handler,
+		},
+		{
+			MethodName: "GetCacheStats",
+			Handler:    _UrlShorteningService_GetCacheStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "urlshortener.proto",
+}
@@ -0,0 +1,254 @@
+// Package jwks verifies tokens issued by the auth service locally, using the
+// public keys it publishes as a JWKS document.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+	// ErrUnavailable is returned when the key set or the revocation list
+	// can't be fetched.
+	ErrUnavailable = errors.New("key set unavailable")
+)
+
+// minRefreshInterval limits how often tokens with unknown key ids may
+// trigger a refetch of the key set.
+const minRefreshInterval = 10 * time.Second
+
+// Claims are the claims of tokens issued by the auth service.
+type Claims struct {
+	Email       string   `json:"email"`
+	UserID      int64    `json:"userId"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions,omitempty"`
+	// Orgs maps the IDs of the organizations of the user to their role in it.
+	Orgs map[string]string `json:"orgs,omitempty"`
+	// Scopes are set on tokens the auth service mints for API keys.
+	Scopes []string `json:"scopes,omitempty"`
+	jwt.StandardClaims
+}
+
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// Options configure a Verifier.
+type Options struct {
+	// URL is the JWKS document, refetched every Refresh.
+	URL     string
+	Issuer  string
+	Refresh time.Duration
+	// Timeout bounds the requests to the auth service.
+	Timeout time.Duration
+	// RevocationsURL lists the revoked tokens, it is synced every
+	// RevocationsRefresh. Without it revoked tokens pass until they expire.
+	RevocationsURL     string
+	RevocationsRefresh time.Duration
+}
+
+// Verifier verifies tokens against a JWKS document fetched over HTTP. The
+// document is refetched every refresh interval and whenever a token refers
+// to a key id that isn't known yet, which picks up rotated keys. Tokens are
+// checked against the revocation list of the auth service too.
+type Verifier struct {
+	url         string
+	issuer      string
+	refresh     time.Duration
+	client      *http.Client
+	revocations *revocationList
+
+	mu        sync.RWMutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+	// fetching serializes fetches so a burst of unknown key ids costs one request.
+	fetching sync.Mutex
+}
+
+func NewVerifier(opts Options) *Verifier {
+	v := &Verifier{
+		url:     opts.URL,
+		issuer:  opts.Issuer,
+		refresh: opts.Refresh,
+		client:  &http.Client{Timeout: opts.Timeout},
+	}
+	if opts.RevocationsURL != "" {
+		v.revocations = newRevocationList(opts.RevocationsURL, opts.RevocationsRefresh, v.client)
+	}
+	return v
+}
+
+// Verify checks the signature, expiry, issuer and revocation of the token and
+// returns its claims.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.alg {
+			return nil, ErrInvalidToken
+		}
+		return key.key, nil
+	})
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && errors.Is(validationErr.Inner, ErrUnavailable) {
+			return Claims{}, validationErr.Inner
+		}
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !token.Valid || !claims.VerifyIssuer(v.issuer, v.issuer != "") || claims.UserID == 0 {
+		return Claims{}, ErrInvalidToken
+	}
+	if v.revocations != nil {
+		revoked, err := v.revocations.revoked(ctx, claims)
+		if err != nil {
+			return Claims{}, err
+		}
+		if revoked {
+			return Claims{}, fmt.Errorf("%w: revoked", ErrInvalidToken)
+		}
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (publicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetchedAt) > v.refresh
+	v.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+
+	if err := v.fetch(ctx, ok); err != nil {
+		// A known key keeps working while the auth service is unreachable.
+		if ok {
+			return key, nil
+		}
+		return publicKey{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	key, ok = v.keys[kid]
+	if !ok {
+		return publicKey{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// fetch refetches the key set unless another caller just did. known tells
+// whether the fetch refreshes a stale set or looks for an unknown key id.
+func (v *Verifier) fetch(ctx context.Context, known bool) error {
+	const op = "jwks.fetch"
+
+	v.fetching.Lock()
+	defer v.fetching.Unlock()
+
+	v.mu.RLock()
+	since := time.Since(v.fetchedAt)
+	v.mu.RUnlock()
+	if (known && since <= v.refresh) || (!known && since < minRefreshInterval) {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("%s: decode: %w", op, err)
+	}
+
+	keys := make(map[string]publicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			// Skip keys of unsupported types rather than failing the whole set.
+			continue
+		}
+		keys[k.KeyID] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+}
+
+func (k jwk) publicKey() (publicKey, error) {
+	switch {
+	case k.KeyType == "RSA" && k.Algorithm == "RS256":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return publicKey{}, err
+		}
+		return publicKey{alg: k.Algorithm, key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	case k.KeyType == "OKP" && k.Curve == "Ed25519" && k.Algorithm == "EdDSA":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errors.New("invalid Ed25519 key size")
+		}
+		return publicKey{alg: k.Algorithm, key: ed25519.PublicKey(x)}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key %s/%s", k.KeyType, k.Algorithm)
+	}
+}
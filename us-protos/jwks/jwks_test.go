@@ -0,0 +1,226 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const testIssuer = "auth"
+
+func TestVerifierVerify(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	_, otherPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+
+	keySet := func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string][]jwk{"keys": {
+			{
+				KeyType:   "OKP",
+				KeyID:     "ed",
+				Algorithm: "EdDSA",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(edPublic),
+			},
+			{
+				KeyType:   "RSA",
+				KeyID:     "rsa",
+				Algorithm: "RS256",
+				N:         base64.RawURLEncoding.EncodeToString(rsaPrivate.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaPrivate.E)).Bytes()),
+			},
+		}})
+	}
+	available := httptest.NewServer(http.HandlerFunc(keySet))
+	defer available.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	valid := func() Claims {
+		return Claims{
+			UserID: 42,
+			Email:  "a@example.com",
+			Role:   "user",
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    testIssuer,
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key crypto.PrivateKey, claims Claims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return s
+	}
+
+	expired := valid()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	otherIssuer := valid()
+	otherIssuer.Issuer = "someone-else"
+	noUser := valid()
+	noUser.UserID = 0
+
+	tests := []struct {
+		name    string
+		url     string
+		token   string
+		wantErr error
+	}{
+		{"ed25519 key", available.URL, sign(jwt.SigningMethodEdDSA, "ed", edPrivate, valid()), nil},
+		{"rsa key", available.URL, sign(jwt.SigningMethodRS256, "rsa", rsaPrivate, valid()), nil},
+		{"expired", available.URL, sign(jwt.SigningMethodEdDSA, "ed", edPrivate, expired), ErrInvalidToken},
+		{"other issuer", available.URL, sign(jwt.SigningMethodEdDSA, "ed", edPrivate, otherIssuer), ErrInvalidToken},
+		{"no user", available.URL, sign(jwt.SigningMethodEdDSA, "ed", edPrivate, noUser), ErrInvalidToken},
+		{"unknown key id", available.URL, sign(jwt.SigningMethodEdDSA, "gone", edPrivate, valid()), ErrInvalidToken},
+		{"signed by another key", available.URL, sign(jwt.SigningMethodEdDSA, "ed", otherPrivate, valid()), ErrInvalidToken},
+		{"algorithm of another key", available.URL, sign(jwt.SigningMethodRS256, "ed", rsaPrivate, valid()), ErrInvalidToken},
+		{"malformed", available.URL, "not.a.token", ErrInvalidToken},
+		{"key set unavailable", unavailable.URL, sign(jwt.SigningMethodEdDSA, "ed", edPrivate, valid()), ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(Options{URL: tt.url, Issuer: testIssuer, Refresh: time.Minute, Timeout: time.Second})
+
+			claims, err := v.Verify(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims.UserID != 42 {
+				t.Errorf("Verify() user = %d, want 42", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestVerifierRevocations(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute).Unix()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string][]jwk{"keys": {{
+			KeyType:   "OKP",
+			KeyID:     "ed",
+			Algorithm: "EdDSA",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(public),
+		}}})
+	})
+	mux.HandleFunc("/revocations", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Revocations{
+			AsOf: now.Unix(),
+			Tokens: []RevokedToken{
+				{ID: "logged-out", ExpiresAt: now.Add(time.Hour).Unix()},
+			},
+			Users: []UserRevocation{
+				{UserID: 7, NotBefore: revokedAt, ExpiresAt: now.Add(time.Hour).Unix()},
+			},
+		})
+	})
+	mux.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	token := func(jti string, userID, issuedAt int64) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, Claims{
+			UserID: userID,
+			StandardClaims: jwt.StandardClaims{
+				Id:        jti,
+				Issuer:    testIssuer,
+				IssuedAt:  issuedAt,
+				ExpiresAt: now.Add(time.Hour).Unix(),
+			},
+		})
+		tok.Header["kid"] = "ed"
+		s, err := tok.SignedString(private)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name        string
+		revocations string
+		token       string
+		wantErr     error
+	}{
+		{"not revoked", "/revocations", token("fresh", 42, now.Unix()), nil},
+		{"revoked token", "/revocations", token("logged-out", 42, now.Unix()), ErrInvalidToken},
+		{"token of a revoked user", "/revocations", token("old", 7, revokedAt-1), ErrInvalidToken},
+		{"token issued after the revocation", "/revocations", token("new", 7, revokedAt), nil},
+		{"revocations unavailable", "/unavailable", token("fresh", 42, now.Unix()), ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(Options{
+				URL:                srv.URL + "/jwks",
+				Issuer:             testIssuer,
+				Refresh:            time.Minute,
+				Timeout:            time.Second,
+				RevocationsURL:     srv.URL + tt.revocations,
+				RevocationsRefresh: time.Minute,
+			})
+
+			if _, err := v.Verify(context.Background(), tt.token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRevocationListSync(t *testing.T) {
+	var sinces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sinces = append(sinces, r.URL.Query().Get("since"))
+		_ = json.NewEncoder(w).Encode(Revocations{AsOf: int64(100 * len(sinces))})
+	}))
+	defer srv.Close()
+
+	l := newRevocationList(srv.URL, time.Millisecond, srv.Client())
+	for i := 0; i < 2; i++ {
+		if err := l.sync(context.Background()); err != nil {
+			t.Fatalf("sync() error = %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if len(sinces) != 2 || sinces[0] != "0" || sinces[1] != "100" {
+		t.Errorf("since parameters = %v, want [0 100]", sinces)
+	}
+}
@@ -0,0 +1,197 @@
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// staleRevocations is the number of refresh intervals the revocation list may
+// miss before tokens can't be verified anymore.
+const staleRevocations = 3
+
+// Revocations is the document of revoked access tokens published by the auth
+// service. A request with the since parameter lists what was revoked since
+// then, times are Unix timestamps in seconds.
+type Revocations struct {
+	// AsOf is the since parameter of the next request, listings overlap.
+	AsOf   int64            `json:"as_of"`
+	Tokens []RevokedToken   `json:"tokens"`
+	Users  []UserRevocation `json:"users"`
+}
+
+// RevokedToken is an access token revoked by its ID, e.g. on logout.
+type RevokedToken struct {
+	ID        string `json:"jti"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// UserRevocation revokes the access tokens of the user issued before
+// NotBefore, e.g. when the user is disabled or their role changes.
+type UserRevocation struct {
+	UserID    int64 `json:"user_id"`
+	NotBefore int64 `json:"nbf"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+// revocationList mirrors the revocations published by the auth service. It
+// is synced when a verification finds it older than the refresh interval,
+// only revocations since the previous sync are fetched.
+type revocationList struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu          sync.RWMutex
+	tokens      map[string]int64
+	users       map[int64]UserRevocation
+	asOf        int64
+	syncedAt    time.Time
+	attemptedAt time.Time
+	// syncing serializes syncs so a burst of verifications costs one request.
+	syncing sync.Mutex
+}
+
+func newRevocationList(url string, refresh time.Duration, client *http.Client) *revocationList {
+	return &revocationList{
+		url:     url,
+		refresh: refresh,
+		client:  client,
+		tokens:  make(map[string]int64),
+		users:   make(map[int64]UserRevocation),
+	}
+}
+
+// revoked reports whether the token of the claims was revoked. It fails with
+// ErrUnavailable once the list couldn't be synced for too long.
+func (l *revocationList) revoked(ctx context.Context, claims Claims) (bool, error) {
+	if err := l.sync(ctx); err != nil {
+		return false, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if _, ok := l.tokens[claims.Id]; ok {
+		return true, nil
+	}
+	if r, ok := l.users[claims.UserID]; ok && claims.IssuedAt < r.NotBefore {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (l *revocationList) sync(ctx context.Context) error {
+	if l.age() <= l.refresh {
+		return nil
+	}
+
+	// Verifications go on with a list that is still usable while another
+	// one syncs it.
+	if !l.syncing.TryLock() {
+		if l.age() <= staleRevocations*l.refresh {
+			return nil
+		}
+		l.syncing.Lock()
+	}
+	defer l.syncing.Unlock()
+
+	l.mu.RLock()
+	attemptedAt := l.attemptedAt
+	l.mu.RUnlock()
+
+	// Failed syncs are retried once per refresh interval, not by every
+	// verification.
+	var err error
+	if time.Since(attemptedAt) >= l.refresh {
+		if err = l.fetch(ctx); err == nil {
+			return nil
+		}
+	}
+	if l.age() <= staleRevocations*l.refresh {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("revocation list not synced since %s", l.syncedAtTime().Format(time.RFC3339))
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+func (l *revocationList) age() time.Duration {
+	return time.Since(l.syncedAtTime())
+}
+
+func (l *revocationList) syncedAtTime() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.syncedAt
+}
+
+func (l *revocationList) fetch(ctx context.Context) error {
+	const op = "jwks.revocationList.fetch"
+
+	l.mu.Lock()
+	l.attemptedAt = time.Now()
+	since := l.asOf
+	l.mu.Unlock()
+
+	u, err := url.Parse(l.url)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	query := u.Query()
+	query.Set("since", strconv.FormatInt(since, 10))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	var doc Revocations
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("%s: decode: %w", op, err)
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, t := range doc.Tokens {
+		l.tokens[t.ID] = t.ExpiresAt
+	}
+	for _, r := range doc.Users {
+		if r.NotBefore > l.users[r.UserID].NotBefore {
+			l.users[r.UserID] = r
+		}
+	}
+	// Entries of expired tokens don't revoke anything anymore.
+	for id, exp := range l.tokens {
+		if exp < now.Unix() {
+			delete(l.tokens, id)
+		}
+	}
+	for id, r := range l.users {
+		if r.ExpiresAt < now.Unix() {
+			delete(l.users, id)
+		}
+	}
+	l.asOf = doc.AsOf
+	l.syncedAt = now
+
+	return nil
+}